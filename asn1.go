@@ -0,0 +1,171 @@
+package skipjack
+
+import (
+	"crypto/cipher"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+)
+
+/*
+
+   ASN.1 algorithm identifiers, from:
+   RFC 2876, "Use of the KEA and SKIPJACK Algorithms in CMS"
+   http://tools.ietf.org/html/rfc2876
+
+   SKIPJACK in CBC mode is identified by id-fortezzaConfidentialityAlgorithm
+   with the parameters
+
+      Skipjack-Parm ::= SEQUENCE { initialization-vector OCTET STRING }
+
+   holding the 8-byte IV.  The content is given PKCS #5 padding, as in
+   RFC 2630 section 6.3.
+
+*/
+
+// OIDFortezzaConfidentialityAlgorithm is id-fortezzaConfidentialityAlgorithm,
+// SKIPJACK in CBC mode.
+var OIDFortezzaConfidentialityAlgorithm = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 2, 1, 1, 4}
+
+type skipjackParm struct {
+	IV []byte
+}
+
+var (
+	errNotSkipjackCBC = errors.New("skipjack: algorithm is not id-fortezzaConfidentialityAlgorithm")
+	errParmIVSize     = errors.New("skipjack: invalid Skipjack-Parm IV length")
+	errParmTrailing   = errors.New("skipjack: trailing data after ASN.1 structure")
+	errPadding        = errors.New("skipjack: invalid padding")
+)
+
+// AlgorithmIdentifier returns the SKIPJACK-CBC AlgorithmIdentifier for the
+// 8-byte iv.
+func AlgorithmIdentifier(iv []byte) (pkix.AlgorithmIdentifier, error) {
+	if len(iv) != 8 {
+		return pkix.AlgorithmIdentifier{}, errParmIVSize
+	}
+
+	params, err := asn1.Marshal(skipjackParm{iv})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  OIDFortezzaConfidentialityAlgorithm,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}, nil
+}
+
+// MarshalAlgorithmIdentifier returns the DER SKIPJACK-CBC AlgorithmIdentifier
+// for the 8-byte iv.
+func MarshalAlgorithmIdentifier(iv []byte) ([]byte, error) {
+	ai, err := AlgorithmIdentifier(iv)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(ai)
+}
+
+// AlgorithmIV returns the IV from a SKIPJACK-CBC AlgorithmIdentifier.
+func AlgorithmIV(ai pkix.AlgorithmIdentifier) ([]byte, error) {
+	if !ai.Algorithm.Equal(OIDFortezzaConfidentialityAlgorithm) {
+		return nil, errNotSkipjackCBC
+	}
+
+	var p skipjackParm
+
+	rest, err := asn1.Unmarshal(ai.Parameters.FullBytes, &p)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errParmTrailing
+	}
+
+	if len(p.IV) != 8 {
+		return nil, errParmIVSize
+	}
+
+	return p.IV, nil
+}
+
+// ParseAlgorithmIdentifier parses a DER SKIPJACK-CBC AlgorithmIdentifier and
+// returns its IV.
+func ParseAlgorithmIdentifier(der []byte) ([]byte, error) {
+	var ai pkix.AlgorithmIdentifier
+
+	rest, err := asn1.Unmarshal(der, &ai)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errParmTrailing
+	}
+
+	return AlgorithmIV(ai)
+}
+
+// NewCBCEncrypterFromAlgorithm returns a CBC encrypter under the 10-byte key
+// and the IV of the DER SKIPJACK-CBC AlgorithmIdentifier.
+func NewCBCEncrypterFromAlgorithm(der, key []byte) (cipher.BlockMode, error) {
+	b, iv, err := fromAlgorithm(der, key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCBCEncrypter(b, iv), nil
+}
+
+// NewCBCDecrypterFromAlgorithm returns a CBC decrypter under the 10-byte key
+// and the IV of the DER SKIPJACK-CBC AlgorithmIdentifier.
+func NewCBCDecrypterFromAlgorithm(der, key []byte) (cipher.BlockMode, error) {
+	b, iv, err := fromAlgorithm(der, key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCBCDecrypter(b, iv), nil
+}
+
+func fromAlgorithm(der, key []byte) (cipher.Block, []byte, error) {
+	iv, err := ParseAlgorithmIdentifier(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := New(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return b, iv, nil
+}
+
+// Pad returns a copy of b with PKCS #5 padding, which always adds between 1
+// and 8 bytes.
+func Pad(b []byte) []byte {
+	n := 8 - len(b)%8
+	p := make([]byte, len(b)+n)
+	copy(p, b)
+	for i := len(b); i < len(p); i++ {
+		p[i] = byte(n)
+	}
+	return p
+}
+
+// Unpad checks and removes the PKCS #5 padding of b, returning a subslice.
+func Unpad(b []byte) ([]byte, error) {
+	if len(b) == 0 || len(b)%8 != 0 {
+		return nil, errPadding
+	}
+
+	n := int(b[len(b)-1])
+	if n == 0 || n > 8 {
+		return nil, errPadding
+	}
+	for _, c := range b[len(b)-n:] {
+		if int(c) != n {
+			return nil, errPadding
+		}
+	}
+
+	return b[:len(b)-n], nil
+}
@@ -0,0 +1,106 @@
+package skipjack
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"testing"
+)
+
+func TestAlgorithmIdentifier(t *testing.T) {
+
+	iv := unhex("0001020304050607")
+	want := unhex("3017" + "0609608648016502010104" + "300a0408" + "0001020304050607")
+
+	der, err := MarshalAlgorithmIdentifier(iv)
+	if err != nil || !bytes.Equal(der, want) {
+		t.Errorf("skipjack algorithm identifier failed: got %x wanted %x (%v)\n", der, want, err)
+	}
+
+	if got, err := ParseAlgorithmIdentifier(der); err != nil || !bytes.Equal(got, iv) {
+		t.Errorf("skipjack algorithm identifier parse failed: got %x wanted %x (%v)\n", got, iv, err)
+	}
+
+	var bad = []string{
+		"3017" + "0609608648016502010105" + "300a0408" + "0001020304050607", // wrong OID
+		"3016" + "0609608648016502010104" + "30090407" + "00010203040506",   // short IV
+		"300b" + "0609608648016502010104",                                   // no parameters
+		"3017" + "0609608648016502010104" + "300a0408" + "0001020304050607" + "00",
+	}
+
+	for _, v := range bad {
+		if _, err := ParseAlgorithmIdentifier(unhex(v)); err == nil {
+			t.Errorf("skipjack parsed a bad algorithm identifier %s\n", v)
+		}
+	}
+
+	if _, err := MarshalAlgorithmIdentifier(iv[:7]); err == nil {
+		t.Errorf("skipjack marshalled a short IV\n")
+	}
+}
+
+func TestCBCFromAlgorithm(t *testing.T) {
+
+	key := skipjackTestVectors[0].key
+	iv := unhex("0001020304050607")
+	der, _ := MarshalAlgorithmIdentifier(iv)
+
+	plain := bytes.Repeat([]byte("skipjack"), 3)
+
+	enc, err := NewCBCEncrypterFromAlgorithm(der, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := make([]byte, len(plain))
+	enc.CryptBlocks(ct, plain)
+
+	b, _ := New(key)
+	want := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(b, iv).CryptBlocks(want, plain)
+
+	if !bytes.Equal(ct, want) {
+		t.Errorf("skipjack cbc from algorithm failed: got %x wanted %x\n", ct, want)
+	}
+
+	dec, err := NewCBCDecrypterFromAlgorithm(der, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec.CryptBlocks(ct, ct)
+	if !bytes.Equal(ct, plain) {
+		t.Errorf("skipjack cbc from algorithm round trip failed: got %x wanted %x\n", ct, plain)
+	}
+
+	if _, err := NewCBCDecrypterFromAlgorithm(der, key[:8]); err == nil {
+		t.Errorf("skipjack accepted a short key\n")
+	}
+}
+
+func TestPad(t *testing.T) {
+
+	for n := 0; n <= 16; n++ {
+		b := bytes.Repeat([]byte{0xaa}, n)
+
+		p := Pad(b)
+		if len(p)%8 != 0 || len(p)-n < 1 || len(p)-n > 8 || int(p[len(p)-1]) != len(p)-n {
+			t.Errorf("skipjack pad of %d bytes failed: got %x\n", n, p)
+		}
+
+		if u, err := Unpad(p); err != nil || !bytes.Equal(u, b) {
+			t.Errorf("skipjack unpad of %d bytes failed: got %x (%v)\n", n, u, err)
+		}
+	}
+
+	for _, p := range [][]byte{
+		nil,
+		unhex("aaaaaaaaaaaaaa"),
+		unhex("aaaaaaaaaaaaaa00"),
+		unhex("aaaaaaaaaaaaaa09"),
+		unhex("aaaaaaaaaaaa0303"),
+	} {
+		if _, err := Unpad(p); err == nil {
+			t.Errorf("skipjack unpadded invalid padding %x\n", p)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Package capstone simulates the message flow of the Capstone (and, for the
+// encryption half, Clipper) escrowed encryption devices: KEA key agreement,
+// LEAF generation and checking, and SKIPJACK in a FIPS 81 mode.
+/*
+
+   References:
+   http://csrc.nist.gov/groups/ST/toolkit/documents/skipjack/skipjack.pdf
+   FIPS 81, "DES Modes of Operation"
+   FIPS 185, "Escrowed Encryption Standard"
+
+   Two devices, each holding a static KEA key pair, exchange ephemeral
+   public keys and agree on an 80-bit session key.  The sending device then
+   generates an IV and the LEAF binding the session key to its unit ID, and
+   sends both ahead of the ciphertext.  The receiving device refuses to
+   decrypt until it has been given a LEAF whose escrow authenticator matches
+   the session key and IV.
+
+*/
+package capstone
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"github.com/Phraxos/go-skipjack"
+	"github.com/Phraxos/go-skipjack/kea"
+	"github.com/Phraxos/go-skipjack/leaf"
+)
+
+// Mode is a FIPS 81 mode of operation.
+type Mode int
+
+// The supported modes.  CFB and OFB use 64-bit feedback.
+const (
+	CBC Mode = iota
+	CFB
+	OFB
+)
+
+func (m Mode) String() string {
+	switch m {
+	case CBC:
+		return "CBC"
+	case CFB:
+		return "CFB"
+	case OFB:
+		return "OFB"
+	}
+	return "unknown"
+}
+
+// ErrLEAF is returned when a receiving device rejects a LEAF.
+var ErrLEAF = errors.New("capstone: LEAF rejected")
+
+var (
+	errMode      = errors.New("capstone: unknown mode")
+	errIVSize    = errors.New("capstone: invalid IV length")
+	errBlockSize = errors.New("capstone: CBC input not a multiple of the block size")
+)
+
+// Device is an escrowed encryption device with its escrowed unit key, the
+// family key and a static KEA key pair.
+type Device struct {
+	unit      *leaf.Unit
+	familyKey []byte
+	static    *kea.PrivateKey
+
+	// Rand is the source of ephemeral keys and IVs.  If nil, crypto/rand
+	// is used.
+	Rand io.Reader
+}
+
+// NewDevice returns a device with the given unit ID, 10-byte unit and family
+// keys, and static KEA key pair.
+func NewDevice(id uint32, unitKey, familyKey []byte, static *kea.PrivateKey) (*Device, error) {
+	u, err := leaf.NewUnit(id, unitKey, familyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Device{
+		unit:      u,
+		familyKey: append([]byte(nil), familyKey...),
+		static:    static,
+	}, nil
+}
+
+func (d *Device) rand() io.Reader {
+	if d.Rand == nil {
+		return rand.Reader
+	}
+	return d.Rand
+}
+
+// ID returns the device's unit ID.
+func (d *Device) ID() uint32 {
+	return d.unit.ID
+}
+
+// PublicKey returns the device's static KEA public key.
+func (d *Device) PublicKey() *kea.PublicKey {
+	return &d.static.PublicKey
+}
+
+// Exchange is one side of a KEA exchange in progress.
+type Exchange struct {
+	d         *Device
+	ephemeral *kea.PrivateKey
+}
+
+// NewExchange generates an ephemeral key pair for a new session.
+func (d *Device) NewExchange() (*Exchange, error) {
+	r, err := kea.GenerateKey(&d.static.Parameters, d.rand())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Exchange{d: d, ephemeral: r}, nil
+}
+
+// PublicKey returns the ephemeral public key to send to the peer.
+func (e *Exchange) PublicKey() *kea.PublicKey {
+	return &e.ephemeral.PublicKey
+}
+
+// Session completes the exchange with the peer's static and ephemeral public
+// keys and returns a session using mode.
+func (e *Exchange) Session(peerStatic, peerEphemeral *kea.PublicKey, mode Mode) (*Session, error) {
+	if mode != CBC && mode != CFB && mode != OFB {
+		return nil, errMode
+	}
+
+	key, err := kea.Agree(e.d.static, e.ephemeral, peerStatic, peerEphemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	// key is always kea.KeySize bytes
+	b, _ := skipjack.New(key)
+
+	return &Session{d: e.d, key: key, block: b, mode: mode}, nil
+}
+
+// Session is an agreed session key loaded into a device.
+type Session struct {
+	d     *Device
+	key   []byte
+	block cipher.Block
+	mode  Mode
+}
+
+// Mode returns the session's mode of operation.
+func (s *Session) Mode() Mode {
+	return s.mode
+}
+
+// Header is what a sending device emits ahead of the ciphertext.
+type Header struct {
+	IV   []byte
+	LEAF []byte
+}
+
+// Crypter encrypts or decrypts traffic in the session's mode.  Successive
+// calls continue the same chain.
+type Crypter struct {
+	mode   cipher.BlockMode
+	stream cipher.Stream
+}
+
+// Crypt processes src into dst, which may overlap entirely.  In CBC mode
+// len(src) must be a multiple of the block size.
+func (c *Crypter) Crypt(dst, src []byte) error {
+	if c.mode != nil {
+		if len(src)%c.mode.BlockSize() != 0 {
+			return errBlockSize
+		}
+		c.mode.CryptBlocks(dst, src)
+		return nil
+	}
+
+	c.stream.XORKeyStream(dst, src)
+	return nil
+}
+
+// NewEncrypter generates a fresh IV and LEAF and returns them with a Crypter
+// encrypting under them.
+func (s *Session) NewEncrypter() (*Header, *Crypter, error) {
+	iv := make([]byte, leaf.IVSize)
+	if _, err := io.ReadFull(s.d.rand(), iv); err != nil {
+		return nil, nil, err
+	}
+
+	l, err := s.d.unit.Generate(s.key, iv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &Crypter{}
+	switch s.mode {
+	case CBC:
+		c.mode = cipher.NewCBCEncrypter(s.block, iv)
+	case CFB:
+		c.stream, _ = skipjack.NewCFBEncrypter(s.block, iv, 64)
+	case OFB:
+		c.stream, _ = skipjack.NewOFB(s.block, iv)
+	}
+
+	return &Header{IV: iv, LEAF: l}, c, nil
+}
+
+// NewDecrypter checks the LEAF in h and returns a Crypter decrypting under
+// its IV.  It returns ErrLEAF if the escrow authenticator does not match.
+func (s *Session) NewDecrypter(h *Header) (*Crypter, error) {
+	if len(h.IV) != leaf.IVSize {
+		return nil, errIVSize
+	}
+
+	r, err := leaf.NewReceiver(s.d.familyKey, s.key, h.IV)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.Accept(h.LEAF) {
+		return nil, ErrLEAF
+	}
+
+	c := &Crypter{}
+	switch s.mode {
+	case CBC:
+		c.mode = cipher.NewCBCDecrypter(s.block, h.IV)
+	case CFB:
+		c.stream, _ = skipjack.NewCFBDecrypter(s.block, h.IV, 64)
+	case OFB:
+		c.stream, _ = skipjack.NewOFB(s.block, h.IV)
+	}
+
+	return c, nil
+}
+
+// Encrypt encrypts a whole message under a fresh IV and LEAF.
+func (s *Session) Encrypt(plaintext []byte) (*Header, []byte, error) {
+	h, c, err := s.NewEncrypter()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ciphertext := make([]byte, len(plaintext))
+	if err := c.Crypt(ciphertext, plaintext); err != nil {
+		return nil, nil, err
+	}
+
+	return h, ciphertext, nil
+}
+
+// Decrypt checks the LEAF in h and decrypts a whole message.
+func (s *Session) Decrypt(h *Header, ciphertext []byte) ([]byte, error) {
+	c, err := s.NewDecrypter(h)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	if err := c.Crypt(plaintext, ciphertext); err != nil {
+		return nil, err
+	}
+
+	return plaintext, nil
+}
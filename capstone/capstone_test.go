@@ -0,0 +1,164 @@
+package capstone
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/Phraxos/go-skipjack/kea"
+	"github.com/Phraxos/go-skipjack/leaf"
+)
+
+func fromHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("bad hex: " + s)
+	}
+	return n
+}
+
+var testParameters = kea.Parameters{
+	P: fromHex("a07377e4d4eae2231e2329aad6e0ad41015d12b4791fd3fb1ca22c4d3667be43d09c91917f4106b9843247182c6662a7db0f529a0a184a6b7f2b6f4e53e9c30471b5adeaed57f2f4d494f839978fe245a4a00a9a9e18e32f5ad8a66a9bd45a41b30fa9acda5dcad72df214bc64cf43ff5483721f2d5aa6b809da64e963863b7f"),
+	Q: fromHex("e9d6762f5173237c26b61ee6efa8a4df7cddc11b"),
+	G: fromHex("23afd9da2f7e1337006c5d32fcc28502263442bfbf07e967d0e9b8adce6f7f013986c5900a5dbc8daae7a3a02d6e06680bd476315c47f8d521c3e060879d93656405dddf19f800078ccf68cf798e493dba27775de1100179c0ab0c5144361a1b0ca438e3f2ac99b821308e03f3f723c2fa9bbe00201aa82f0c9ba90ab5969e78"),
+}
+
+var (
+	familyKey = []byte{0xf0, 0xe1, 0xd2, 0xc3, 0xb4, 0xa5, 0x96, 0x87, 0x78, 0x69}
+	unitKeyA  = []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23}
+	unitKeyB  = []byte{0x32, 0x10, 0xfe, 0xdc, 0xba, 0x98, 0x76, 0x54, 0x32, 0x10}
+)
+
+func device(t *testing.T, id uint32, unitKey []byte) *Device {
+	static, err := kea.GenerateKey(&testParameters, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDevice(id, unitKey, familyKey, static)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+// connect runs the KEA exchange between a and b
+func connect(t *testing.T, a, b *Device, mode Mode) (sa, sb *Session) {
+	ea, err := a.NewExchange()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eb, err := b.NewExchange()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sa, err = ea.Session(b.PublicKey(), eb.PublicKey(), mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb, err = eb.Session(a.PublicKey(), ea.PublicKey(), mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sa, sb
+}
+
+func TestSession(t *testing.T) {
+
+	a, b := device(t, 0x00c11990, unitKeyA), device(t, 0x00c11991, unitKeyB)
+
+	msg := bytes.Repeat([]byte("capstone"), 6)
+
+	for _, mode := range []Mode{CBC, CFB, OFB} {
+		sa, sb := connect(t, a, b, mode)
+
+		h, ct, err := sa.Encrypt(msg)
+		if err != nil {
+			t.Fatalf("%v: %v\n", mode, err)
+		}
+
+		if len(h.IV) != leaf.IVSize || len(h.LEAF) != leaf.Size || bytes.Equal(ct, msg) {
+			t.Errorf("%v: bad header or ciphertext\n", mode)
+		}
+
+		pt, err := sb.Decrypt(h, ct)
+		if err != nil || !bytes.Equal(pt, msg) {
+			t.Errorf("%v: decrypt failed: got %q wanted %q (%v)\n", mode, pt, msg, err)
+		}
+
+		// the LEAF names the sender and carries the session key for escrow
+		f, _ := leaf.Decrypt(familyKey, h.LEAF)
+		if k, _ := f.SessionKey(unitKeyA); f.UnitID != a.ID() || !bytes.Equal(k, sa.key) {
+			t.Errorf("%v: LEAF does not escrow the session key\n", mode)
+		}
+
+		// the receiver refuses a damaged LEAF
+		bad := &Header{IV: h.IV, LEAF: append([]byte(nil), h.LEAF...)}
+		bad.LEAF[15] ^= 1
+		if _, err := sb.Decrypt(bad, ct); err != ErrLEAF {
+			t.Errorf("%v: damaged LEAF accepted: %v\n", mode, err)
+		}
+
+		// or a genuine LEAF with a different IV
+		bad = &Header{IV: append([]byte(nil), h.IV...), LEAF: h.LEAF}
+		bad.IV[0] ^= 1
+		if _, err := sb.Decrypt(bad, ct); err != ErrLEAF {
+			t.Errorf("%v: LEAF accepted with the wrong IV: %v\n", mode, err)
+		}
+
+		// traffic flows the other way too
+		h, ct, _ = sb.Encrypt(msg)
+		if pt, err := sa.Decrypt(h, ct); err != nil || !bytes.Equal(pt, msg) {
+			t.Errorf("%v: reverse decrypt failed: %v\n", mode, err)
+		}
+	}
+}
+
+func TestCrypter(t *testing.T) {
+
+	a, b := device(t, 1, unitKeyA), device(t, 2, unitKeyB)
+
+	msg := make([]byte, 64)
+	rand.Read(msg)
+
+	for _, mode := range []Mode{CBC, CFB, OFB} {
+		sa, sb := connect(t, a, b, mode)
+
+		h, enc, _ := sa.NewEncrypter()
+		dec, err := sb.NewDecrypter(h)
+		if err != nil {
+			t.Fatalf("%v: %v\n", mode, err)
+		}
+
+		// successive calls continue the chain
+		ct := make([]byte, len(msg))
+		enc.Crypt(ct[:24], msg[:24])
+		enc.Crypt(ct[24:], msg[24:])
+
+		pt := make([]byte, len(ct))
+		dec.Crypt(pt[:40], ct[:40])
+		dec.Crypt(pt[40:], ct[40:])
+
+		if !bytes.Equal(pt, msg) {
+			t.Errorf("%v: chained crypt failed\n", mode)
+		}
+
+		if _, ct2, _ := sa.Encrypt(msg); bytes.Equal(ct2, ct) {
+			t.Errorf("%v: IV was reused\n", mode)
+		}
+	}
+
+	sa, _ := connect(t, a, b, CBC)
+	if _, _, err := sa.Encrypt(msg[:7]); err == nil {
+		t.Errorf("CBC accepted a partial block\n")
+	}
+
+	ea, _ := a.NewExchange()
+	if _, err := ea.Session(b.PublicKey(), b.PublicKey(), Mode(7)); err == nil {
+		t.Errorf("session accepted an unknown mode\n")
+	}
+}
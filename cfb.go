@@ -0,0 +1,85 @@
+package skipjack
+
+import (
+	"crypto/cipher"
+	"errors"
+)
+
+/*
+
+   CFB with a feedback size smaller than the block, from:
+   NIST SP 800-38A, "Recommendation for Block Cipher Modes of Operation"
+   http://csrc.nist.gov/publications/nistpubs/800-38a/sp800-38a.pdf
+
+   crypto/cipher only provides full-block feedback.  FIPS 81 and the
+   FORTEZZA interfaces also use 8, 16 and 32-bit feedback: each s-bit
+   segment of ciphertext is shifted into the input block before the next
+   segment is processed.
+
+*/
+
+type cfb struct {
+	b       cipher.Block
+	in      []byte // input block
+	out     []byte // encryption of in
+	seg     []byte // ciphertext of the current segment
+	pos     int
+	decrypt bool
+}
+
+// NewCFBEncrypter returns a cipher.Stream which encrypts with b in CFB mode
+// with segmentBits of feedback.  segmentBits must be a multiple of 8 no
+// larger than the block size, and the iv must be one block long.
+func NewCFBEncrypter(b cipher.Block, iv []byte, segmentBits int) (cipher.Stream, error) {
+	return newCFB(b, iv, segmentBits, false)
+}
+
+// NewCFBDecrypter returns a cipher.Stream which decrypts with b in CFB mode
+// with segmentBits of feedback.
+func NewCFBDecrypter(b cipher.Block, iv []byte, segmentBits int) (cipher.Stream, error) {
+	return newCFB(b, iv, segmentBits, true)
+}
+
+func newCFB(b cipher.Block, iv []byte, segmentBits int, decrypt bool) (cipher.Stream, error) {
+	n := b.BlockSize()
+	if len(iv) != n {
+		return nil, errors.New("skipjack: CFB IV length must equal block size")
+	}
+	if segmentBits <= 0 || segmentBits%8 != 0 || segmentBits > 8*n {
+		return nil, errors.New("skipjack: invalid CFB segment size")
+	}
+
+	c := &cfb{
+		b:       b,
+		in:      append([]byte(nil), iv...),
+		out:     make([]byte, n),
+		seg:     make([]byte, segmentBits/8),
+		decrypt: decrypt,
+	}
+	b.Encrypt(c.out, c.in)
+
+	return c, nil
+}
+
+func (c *cfb) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("skipjack: output smaller than input")
+	}
+
+	for i, v := range src {
+		if c.decrypt {
+			c.seg[c.pos] = v
+		}
+		dst[i] = v ^ c.out[c.pos]
+		if !c.decrypt {
+			c.seg[c.pos] = dst[i]
+		}
+
+		if c.pos++; c.pos == len(c.seg) {
+			copy(c.in, c.in[len(c.seg):])
+			copy(c.in[len(c.in)-len(c.seg):], c.seg)
+			c.b.Encrypt(c.out, c.in)
+			c.pos = 0
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package skipjack
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+func TestCFB8Vector(t *testing.T) {
+
+	// SP 800-38A F.3.7, CFB8-AES128.Encrypt
+	b, _ := aes.NewCipher(unhex("2b7e151628aed2a6abf7158809cf4f3c"))
+	iv := unhex("000102030405060708090a0b0c0d0e0f")
+	pt := unhex("6bc1bee22e409f96e93d7e117393172aae2d")
+	want := unhex("3b79424c9c0dd436bace9e0ed4586a4f32b9")
+
+	enc, _ := NewCFBEncrypter(b, iv, 8)
+	ct := make([]byte, len(pt))
+	enc.XORKeyStream(ct, pt)
+
+	if !bytes.Equal(ct, want) {
+		t.Errorf("cfb8 encrypt failed: got %x wanted %x\n", ct, want)
+	}
+
+	dec, _ := NewCFBDecrypter(b, iv, 8)
+	dec.XORKeyStream(ct, ct)
+
+	if !bytes.Equal(ct, pt) {
+		t.Errorf("cfb8 decrypt failed: got %x wanted %x\n", ct, pt)
+	}
+}
+
+func TestCFBSegments(t *testing.T) {
+
+	b, _ := New(unhex("00998877665544332211"))
+	iv := unhex("0123456789abcdef")
+
+	msg := make([]byte, 61)
+	for i := range msg {
+		msg[i] = byte(i * 7)
+	}
+
+	// full-block feedback matches crypto/cipher
+	want := make([]byte, len(msg))
+	cipher.NewCFBEncrypter(b, iv).XORKeyStream(want, msg)
+
+	enc, _ := NewCFBEncrypter(b, iv, 64)
+	got := make([]byte, len(msg))
+	enc.XORKeyStream(got, msg)
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("cfb64 failed: got %x wanted %x\n", got, want)
+	}
+
+	for _, s := range []int{8, 16, 32, 64} {
+		enc, _ := NewCFBEncrypter(b, iv, s)
+		ct := make([]byte, len(msg))
+
+		// uneven pieces split segments
+		enc.XORKeyStream(ct[:3], msg[:3])
+		enc.XORKeyStream(ct[3:], msg[3:])
+
+		dec, _ := NewCFBDecrypter(b, iv, s)
+		pt := make([]byte, len(msg))
+		dec.XORKeyStream(pt[:5], ct[:5])
+		dec.XORKeyStream(pt[5:], ct[5:])
+
+		if !bytes.Equal(pt, msg) {
+			t.Errorf("cfb%d round trip failed: got %x wanted %x\n", s, pt, msg)
+		}
+	}
+
+	for _, s := range []int{0, 4, 72} {
+		if _, err := NewCFBEncrypter(b, iv, s); err == nil {
+			t.Errorf("cfb accepted a %d-bit segment\n", s)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package skipjack
+
+import (
+	"crypto/cipher"
+	"errors"
+)
+
+// cmac implements CMAC (OMAC1) from NIST SP 800-38B for 64- and 128-bit
+// block ciphers.
+type cmac struct {
+	b      cipher.Block
+	k1, k2 []byte
+}
+
+func newCMAC(b cipher.Block) (*cmac, error) {
+	var rb byte
+
+	switch b.BlockSize() {
+	case 8:
+		rb = 0x1b
+	case 16:
+		rb = 0x87
+	default:
+		return nil, errors.New("skipjack: unsupported block size for CMAC")
+	}
+
+	l := make([]byte, b.BlockSize())
+	b.Encrypt(l, l)
+
+	k1 := dbl(l, rb)
+	k2 := dbl(k1, rb)
+
+	return &cmac{b: b, k1: k1, k2: k2}, nil
+}
+
+// dbl multiplies x by 2 in GF(2^n), reducing with rb
+func dbl(x []byte, rb byte) []byte {
+	r := make([]byte, len(x))
+
+	var carry byte
+	for i := len(x) - 1; i >= 0; i-- {
+		r[i] = x[i]<<1 | carry
+		carry = x[i] >> 7
+	}
+
+	// constant-time conditional reduction
+	r[len(r)-1] ^= rb & -carry
+
+	return r
+}
+
+// sum returns the CMAC of the concatenation of the given parts
+func (c *cmac) sum(parts ...[]byte) []byte {
+	bs := c.b.BlockSize()
+
+	var msg []byte
+	for _, p := range parts {
+		msg = append(msg, p...)
+	}
+
+	x := make([]byte, bs)
+
+	// all but the last (possibly partial) block
+	for len(msg) > bs {
+		for i := 0; i < bs; i++ {
+			x[i] ^= msg[i]
+		}
+		c.b.Encrypt(x, x)
+		msg = msg[bs:]
+	}
+
+	if len(msg) == bs {
+		for i := 0; i < bs; i++ {
+			x[i] ^= msg[i] ^ c.k1[i]
+		}
+	} else {
+		for i := 0; i < len(msg); i++ {
+			x[i] ^= msg[i]
+		}
+		x[len(msg)] ^= 0x80
+		for i := 0; i < bs; i++ {
+			x[i] ^= c.k2[i]
+		}
+	}
+
+	c.b.Encrypt(x, x)
+
+	return x
+}
@@ -0,0 +1,99 @@
+// Command leafforge reproduces Matt Blaze's LEAF forgery attack against a
+// simulated escrowed encryption device.
+//
+// It sets up a device with random unit, family and session keys, searches
+// for a bogus LEAF that the receiving device accepts, and shows that the
+// escrow agents cannot recover the session key from it.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/Phraxos/go-skipjack/leaf"
+)
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return b
+}
+
+func main() {
+	workers := flag.Int("workers", runtime.NumCPU(), "number of search goroutines")
+	runs := flag.Int("runs", 1, "number of forgeries to search for")
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix("leafforge: ")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	familyKey := randomBytes(leaf.KeySize)
+	unitKey := randomBytes(leaf.KeySize)
+
+	u, err := leaf.NewUnit(0x00c11990, unitKey, familyKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("expected trials per forgery: %d\n", leaf.ExpectedTrials)
+
+	var total uint64
+
+	for i := 0; i < *runs; i++ {
+		sessionKey := randomBytes(leaf.KeySize)
+		iv := randomBytes(leaf.IVSize)
+
+		genuine, err := u.Generate(sessionKey, iv)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		r, err := leaf.NewReceiver(familyKey, sessionKey, iv)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		start := time.Now()
+
+		f, err := leaf.Forge(ctx, r, *workers, rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		total += f.Trials
+
+		fmt.Printf("\nrun %d: forged after %d trials in %v\n", i+1, f.Trials, time.Since(start).Round(time.Millisecond))
+		fmt.Printf("  genuine LEAF: %x\n", genuine)
+		fmt.Printf("  forged LEAF:  %x\n", f.LEAF)
+		fmt.Printf("  receiver accepts forged LEAF: %v\n", r.Accept(f.LEAF))
+
+		fields, err := leaf.Decrypt(familyKey, f.LEAF)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		escrowed, err := fields.SessionKey(unitKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("  escrow sees unit %08x (real unit %08x)\n", fields.UnitID, u.ID)
+		fmt.Printf("  escrow recovers session key: %v\n", string(escrowed) == string(sessionKey))
+	}
+
+	if *runs > 1 {
+		fmt.Printf("\nmean trials: %d (expected %d)\n", total/uint64(*runs), leaf.ExpectedTrials)
+	}
+}
@@ -0,0 +1,364 @@
+// Command skipjack encrypts and decrypts files in the container format of
+// package container.
+//
+// Usage:
+//
+//	skipjack keygen [-out key.pem]
+//	skipjack kcv -key key.pem
+//	skipjack encrypt (-key key.pem | -passfile file) [-iter n] [-segment n] [-in file] [-out file]
+//	skipjack decrypt (-key key.pem | -passfile file) [-in file] [-out file]
+//	skipjack inspect [-in file]
+//
+// Input and output default to stdin and stdout.  A passphrase is read from
+// the first line of the -passfile file.  Key files carry a key check value,
+// which is verified whenever they are read; kcv prints it for comparison
+// during key entry.  inspect prints the container header and does not need
+// the key.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/Phraxos/go-skipjack"
+	"github.com/Phraxos/go-skipjack/container"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: skipjack keygen|kcv|encrypt|decrypt|inspect [flags]\n")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("skipjack: ")
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd, args := os.Args[1], os.Args[2:]
+
+	var err error
+	switch cmd {
+	case "keygen":
+		err = keygen(args)
+	case "encrypt":
+		err = encrypt(args)
+	case "decrypt":
+		err = decrypt(args)
+	case "inspect":
+		err = inspect(args)
+	case "kcv":
+		err = kcv(args)
+	default:
+		usage()
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// keyFlags are the flags choosing the key
+type keyFlags struct {
+	key      *string
+	passfile *string
+}
+
+func addKeyFlags(fs *flag.FlagSet) keyFlags {
+	return keyFlags{
+		key:      fs.String("key", "", "key `file` from keygen"),
+		passfile: fs.String("passfile", "", "read the passphrase from `file`"),
+	}
+}
+
+func (k keyFlags) check() error {
+	if (*k.key == "") == (*k.passfile == "") {
+		return errors.New("exactly one of -key and -passfile is required")
+	}
+	return nil
+}
+
+func readKey(name string) (*container.Key, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return container.ParseKeyPEM(data)
+}
+
+func readPassphrase(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+
+	return line, nil
+}
+
+func openInput(name string) (io.ReadCloser, error) {
+	if name == "" || name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+// output writes to a file, or stdout, and removes a partly written file
+// on failure
+type output struct {
+	f    *os.File
+	name string
+}
+
+func createOutput(name string, perm os.FileMode) (*output, error) {
+	if name == "" || name == "-" {
+		return &output{f: os.Stdout}, nil
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &output{f: f, name: name}, nil
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	return o.f.Write(p)
+}
+
+// finish closes the output, removing it if err is set
+func (o *output) finish(err error) error {
+	if o.name == "" {
+		return err
+	}
+
+	if cerr := o.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(o.name)
+	}
+
+	return err
+}
+
+func keygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("out", "", "write the key to `file`")
+	fs.Parse(args)
+
+	k, err := container.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	p, err := k.MarshalPEM()
+	if err != nil {
+		return err
+	}
+
+	o, err := createOutput(*out, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = o.Write(p)
+
+	return o.finish(err)
+}
+
+func kcv(args []string) error {
+	fs := flag.NewFlagSet("kcv", flag.ExitOnError)
+	keyFile := fs.String("key", "", "key `file` from keygen")
+	fs.Parse(args)
+
+	if *keyFile == "" {
+		return errors.New("-key is required")
+	}
+
+	// ParseKeyPEM has checked the KCV header
+	k, err := readKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	v, _ := skipjack.KCV(k.Value)
+	c, _ := skipjack.CMACKCV(k.Value)
+
+	fmt.Printf("key id:   %s\n", hex.EncodeToString(k.ID))
+	fmt.Printf("kcv:      %s\n", hex.EncodeToString(v))
+	fmt.Printf("cmac kcv: %s\n", hex.EncodeToString(c))
+
+	return nil
+}
+
+func encrypt(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	kf := addKeyFlags(fs)
+	iter := fs.Int("iter", container.DefaultIterations, "PBKDF2 iteration `count`")
+	segment := fs.Int("segment", 0, "plaintext segment size in `bytes` (default 65536)")
+	in := fs.String("in", "", "read plaintext from `file`")
+	out := fs.String("out", "", "write the container to `file`")
+	fs.Parse(args)
+
+	if err := kf.check(); err != nil {
+		return err
+	}
+
+	var h *container.Header
+	var key []byte
+
+	if *kf.key != "" {
+		k, err := readKey(*kf.key)
+		if err != nil {
+			return err
+		}
+		h, key = container.KeyHeader(k), k.Value
+	} else {
+		pass, err := readPassphrase(*kf.passfile)
+		if err != nil {
+			return err
+		}
+		if h, key, err = container.PassphraseHeader(pass, *iter); err != nil {
+			return err
+		}
+	}
+	h.SegmentSize = *segment
+
+	r, err := openInput(*in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	o, err := createOutput(*out, 0644)
+	if err != nil {
+		return err
+	}
+
+	w, err := container.NewWriter(o, h, key)
+	if err == nil {
+		if _, err = io.Copy(w, r); err == nil {
+			err = w.Close()
+		}
+	}
+
+	return o.finish(err)
+}
+
+func decrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	kf := addKeyFlags(fs)
+	in := fs.String("in", "", "read the container from `file`")
+	out := fs.String("out", "", "write plaintext to `file`")
+	fs.Parse(args)
+
+	if err := kf.check(); err != nil {
+		return err
+	}
+
+	r, err := openInput(*in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	h, err := container.ReadHeader(r)
+	if err != nil {
+		return err
+	}
+
+	var key []byte
+
+	if *kf.key != "" {
+		k, err := readKey(*kf.key)
+		if err != nil {
+			return err
+		}
+		if h.KDF != container.KDFNone {
+			return errors.New("container was encrypted with a passphrase")
+		}
+		if !bytes.Equal(k.ID, h.KeyID) {
+			return fmt.Errorf("container needs key %x, not %x", h.KeyID, k.ID)
+		}
+		key = k.Value
+	} else {
+		pass, err := readPassphrase(*kf.passfile)
+		if err != nil {
+			return err
+		}
+		if key, err = h.PassphraseKey(pass); err != nil {
+			return err
+		}
+	}
+
+	pr, err := container.NewReader(r, h, key)
+	if err != nil {
+		return err
+	}
+
+	o, err := createOutput(*out, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(o, pr)
+
+	return o.finish(err)
+}
+
+func inspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	in := fs.String("in", "", "read the container from `file`")
+	fs.Parse(args)
+
+	r, err := openInput(*in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	h, err := container.ReadHeader(r)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version:      %d\n", h.Version)
+
+	switch h.KDF {
+	case container.KDFNone:
+		fmt.Printf("kdf:          none (key file)\n")
+		fmt.Printf("key id:       %s\n", hex.EncodeToString(h.KeyID))
+	case container.KDFPBKDF2:
+		fmt.Printf("kdf:          PBKDF2-HMAC-SHA256\n")
+		fmt.Printf("iterations:   %d\n", h.Iterations)
+		fmt.Printf("salt:         %s\n", hex.EncodeToString(h.Salt))
+	}
+
+	fmt.Printf("mode:         SKIPJACK-EAX STREAM\n")
+	fmt.Printf("segment size: %d\n", h.SegmentSize)
+	fmt.Printf("nonce:        %s\n", hex.EncodeToString(h.Nonce))
+
+	return nil
+}
@@ -0,0 +1,479 @@
+// Package cms implements CMS EnvelopedData using KEA and SKIPJACK.
+/*
+
+   References:
+   RFC 2876, "Use of the KEA and SKIPJACK Algorithms in CMS"
+   http://tools.ietf.org/html/rfc2876
+   RFC 5652, "Cryptographic Message Syntax (CMS)"
+   http://tools.ietf.org/html/rfc5652
+
+   Each message has a single KeyAgreeRecipientInfo.  The originator
+   generates an ephemeral KEA key pair Ra, carried in the ukm field as an
+   OCTET STRING holding the big-endian value of Ra padded to the length of
+   p, and identifies its static KEA key by certificate.  For each recipient
+   KEA is run with the recipient's static key in place of its ephemeral key,
+   and the resulting key-encryption key wraps the content-encryption key
+   with id-fortezzaWrap80.  The content is encrypted with
+   skipjack.OIDFortezzaConfidentialityAlgorithm, SKIPJACK in CBC mode with
+   CMS padding.
+
+   The wrap80 algorithm itself has not been published, so it is not
+   implemented: Encrypt and Decrypt build and parse everything around it,
+   then fail with ErrWrap80 where the content-encryption key would be
+   wrapped or unwrapped.
+
+   Messages must be DER (or at least definite-length BER) encoded.
+
+*/
+package cms
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/Phraxos/go-skipjack"
+	"github.com/Phraxos/go-skipjack/kea"
+)
+
+// Object identifiers used by RFC 2876 messages.
+var (
+	OIDData                      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	OIDEnvelopedData             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	OIDFortezzaWrap80            = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 2, 1, 1, 23}
+	OIDKEAKeyEncryptionAlgorithm = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 2, 1, 1, 24}
+)
+
+// ErrNotRecipient is returned by Decrypt when the message is not addressed
+// to the given key.
+var ErrNotRecipient = errors.New("cms: message has no recipient info for this key")
+
+// ErrWrap80 is returned by Encrypt and Decrypt in place of wrapping or
+// unwrapping a key with id-fortezzaWrap80, which is not implemented.
+var ErrWrap80 = errors.New("cms: id-fortezzaWrap80 key wrap is not implemented")
+
+// wrap80 and unwrap80 stand for the id-fortezzaWrap80 key wrap
+var (
+	wrap80   = func(kek, cek []byte) ([]byte, error) { return nil, ErrWrap80 }
+	unwrap80 = func(kek, wrapped []byte) ([]byte, error) { return nil, ErrWrap80 }
+)
+
+var (
+	errNotEnveloped   = errors.New("cms: not EnvelopedData")
+	errAlgorithm      = errors.New("cms: unsupported algorithm")
+	errTrailingData   = errors.New("cms: trailing data after ASN.1 structure")
+	errPadding        = errors.New("cms: invalid content padding")
+	errIdentifier     = errors.New("cms: invalid key identifier")
+	errNoOriginator   = errors.New("cms: no originator key lookup given")
+	errNoRecipients   = errors.New("cms: no recipients")
+	errEphemeralValue = errors.New("cms: invalid originator ephemeral key")
+)
+
+// KeyIdentifier identifies a KEA key, either by the issuer and serial number
+// of its certificate or by a subject key identifier.
+type KeyIdentifier struct {
+	// Issuer is the DER encoded issuer Name.
+	Issuer       []byte
+	SerialNumber *big.Int
+
+	SubjectKeyID []byte
+}
+
+// CertificateIdentifier returns the issuer and serial number of cert.
+func CertificateIdentifier(cert *x509.Certificate) KeyIdentifier {
+	return KeyIdentifier{Issuer: cert.RawIssuer, SerialNumber: cert.SerialNumber}
+}
+
+// Equal reports whether id and o identify the same key.
+func (id KeyIdentifier) Equal(o KeyIdentifier) bool {
+	if id.SubjectKeyID != nil || o.SubjectKeyID != nil {
+		return bytes.Equal(id.SubjectKeyID, o.SubjectKeyID)
+	}
+	return id.SerialNumber != nil && o.SerialNumber != nil &&
+		bytes.Equal(id.Issuer, o.Issuer) && id.SerialNumber.Cmp(o.SerialNumber) == 0
+}
+
+// Originator is the sender of a message and its static KEA key pair.
+type Originator struct {
+	ID  KeyIdentifier
+	Key *kea.PrivateKey
+}
+
+// Recipient is a recipient of a message and its static KEA public key.
+type Recipient struct {
+	ID  KeyIdentifier
+	Key *kea.PublicKey
+}
+
+// OriginatorKeys resolves the static KEA public key of a message's
+// originator, normally by finding its certificate.
+type OriginatorKeys func(id KeyIdentifier) (*kea.PublicKey, error)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type envelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+	UnprotectedAttrs     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm asn1.RawValue
+	EncryptedContent           []byte `asn1:"optional,tag:0"`
+}
+
+// keyAgreeRecipientInfo is encoded with an IMPLICIT [1] tag
+type keyAgreeRecipientInfo struct {
+	Version                int
+	Originator             asn1.RawValue `asn1:"explicit,tag:0"`
+	UKM                    []byte        `asn1:"explicit,optional,tag:1"`
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	RecipientEncryptedKeys []recipientEncryptedKey
+}
+
+type recipientEncryptedKey struct {
+	RID          asn1.RawValue
+	EncryptedKey []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type recipientKeyIdentifier struct {
+	SubjectKeyIdentifier []byte
+}
+
+func marshalIssuerAndSerial(id KeyIdentifier) ([]byte, error) {
+	if id.SerialNumber == nil || len(id.Issuer) == 0 {
+		return nil, errIdentifier
+	}
+	return asn1.Marshal(issuerAndSerialNumber{asn1.RawValue{FullBytes: id.Issuer}, id.SerialNumber})
+}
+
+func parseIssuerAndSerial(der []byte) (KeyIdentifier, error) {
+	var ias issuerAndSerialNumber
+	if rest, err := asn1.Unmarshal(der, &ias); err != nil {
+		return KeyIdentifier{}, err
+	} else if len(rest) != 0 {
+		return KeyIdentifier{}, errTrailingData
+	}
+	return KeyIdentifier{Issuer: ias.Issuer.FullBytes, SerialNumber: ias.SerialNumber}, nil
+}
+
+// originatorID encodes OriginatorIdentifierOrKey inside its [0] EXPLICIT tag
+func originatorID(id KeyIdentifier) (asn1.RawValue, error) {
+	var inner []byte
+	var err error
+
+	if id.SubjectKeyID != nil {
+		inner, err = asn1.MarshalWithParams(id.SubjectKeyID, "tag:0")
+	} else {
+		inner, err = marshalIssuerAndSerial(id)
+	}
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner}, nil
+}
+
+func parseOriginatorID(raw asn1.RawValue) (KeyIdentifier, error) {
+	var v asn1.RawValue
+	if rest, err := asn1.Unmarshal(raw.Bytes, &v); err != nil {
+		return KeyIdentifier{}, err
+	} else if len(rest) != 0 {
+		return KeyIdentifier{}, errTrailingData
+	}
+
+	switch {
+	case v.Class == asn1.ClassUniversal && v.Tag == asn1.TagSequence:
+		return parseIssuerAndSerial(v.FullBytes)
+	case v.Class == asn1.ClassContextSpecific && v.Tag == 0 && !v.IsCompound:
+		return KeyIdentifier{SubjectKeyID: v.Bytes}, nil
+	}
+
+	// originatorKey is not allowed: the originator's KEA key must be certified
+	return KeyIdentifier{}, errIdentifier
+}
+
+// recipientID encodes KeyAgreeRecipientIdentifier
+func recipientID(id KeyIdentifier) (asn1.RawValue, error) {
+	var der []byte
+	var err error
+
+	if id.SubjectKeyID != nil {
+		der, err = asn1.MarshalWithParams(recipientKeyIdentifier{id.SubjectKeyID}, "tag:0")
+	} else {
+		der, err = marshalIssuerAndSerial(id)
+	}
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+
+	return asn1.RawValue{FullBytes: der}, nil
+}
+
+func parseRecipientID(raw asn1.RawValue) (KeyIdentifier, error) {
+	switch {
+	case raw.Class == asn1.ClassUniversal && raw.Tag == asn1.TagSequence:
+		return parseIssuerAndSerial(raw.FullBytes)
+
+	case raw.Class == asn1.ClassContextSpecific && raw.Tag == 0 && raw.IsCompound:
+		var rkid recipientKeyIdentifier
+		// the optional date and other fields are ignored
+		if _, err := asn1.UnmarshalWithParams(raw.FullBytes, &rkid, "tag:0"); err != nil {
+			return KeyIdentifier{}, err
+		}
+		return KeyIdentifier{SubjectKeyID: rkid.SubjectKeyIdentifier}, nil
+	}
+
+	return KeyIdentifier{}, errIdentifier
+}
+
+func keyEncryptionAlgorithm() (pkix.AlgorithmIdentifier, error) {
+	wrap, err := asn1.Marshal(pkix.AlgorithmIdentifier{Algorithm: OIDFortezzaWrap80})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  OIDKEAKeyEncryptionAlgorithm,
+		Parameters: asn1.RawValue{FullBytes: wrap},
+	}, nil
+}
+
+func checkKeyEncryptionAlgorithm(algo pkix.AlgorithmIdentifier) error {
+	if !algo.Algorithm.Equal(OIDKEAKeyEncryptionAlgorithm) {
+		return errAlgorithm
+	}
+
+	var wrap pkix.AlgorithmIdentifier
+	if _, err := asn1.Unmarshal(algo.Parameters.FullBytes, &wrap); err != nil {
+		return err
+	}
+	if !wrap.Algorithm.Equal(OIDFortezzaWrap80) {
+		return errAlgorithm
+	}
+
+	return nil
+}
+
+// Encrypt returns a DER ContentInfo holding content as EnvelopedData,
+// readable by each of the recipients.  All the keys must share the same
+// domain parameters.  Until id-fortezzaWrap80 is implemented it returns
+// ErrWrap80.
+func Encrypt(rand io.Reader, content []byte, originator *Originator, recipients []Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errNoRecipients
+	}
+
+	cek := make([]byte, kea.KeySize)
+	iv := make([]byte, 8)
+	if _, err := io.ReadFull(rand, cek); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return nil, err
+	}
+
+	ra, err := kea.GenerateKey(&originator.Key.Parameters, rand)
+	if err != nil {
+		return nil, err
+	}
+
+	kari := keyAgreeRecipientInfo{
+		Version: 3,
+		UKM:     ra.Y.FillBytes(make([]byte, (ra.P.BitLen()+7)/8)),
+	}
+
+	if kari.Originator, err = originatorID(originator.ID); err != nil {
+		return nil, err
+	}
+	if kari.KeyEncryptionAlgorithm, err = keyEncryptionAlgorithm(); err != nil {
+		return nil, err
+	}
+
+	for _, r := range recipients {
+		// the recipient's static key stands in for its ephemeral key
+		kek, err := kea.Agree(originator.Key, ra, r.Key, r.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		wrapped, err := wrap80(kek, cek)
+		if err != nil {
+			return nil, err
+		}
+
+		rid, err := recipientID(r.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		kari.RecipientEncryptedKeys = append(kari.RecipientEncryptedKeys, recipientEncryptedKey{rid, wrapped})
+	}
+
+	ri, err := asn1.MarshalWithParams(kari, "tag:1")
+	if err != nil {
+		return nil, err
+	}
+
+	eci, err := encryptContent(content, cek, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	ed, err := asn1.Marshal(envelopedData{
+		Version:              2,
+		RecipientInfos:       []asn1.RawValue{{FullBytes: ri}},
+		EncryptedContentInfo: eci,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: OIDEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: ed},
+	})
+}
+
+func encryptContent(content, cek, iv []byte) (encryptedContentInfo, error) {
+	algo, err := skipjack.MarshalAlgorithmIdentifier(iv)
+	if err != nil {
+		return encryptedContentInfo{}, err
+	}
+
+	mode, err := skipjack.NewCBCEncrypterFromAlgorithm(algo, cek)
+	if err != nil {
+		return encryptedContentInfo{}, err
+	}
+
+	ct := skipjack.Pad(content)
+	mode.CryptBlocks(ct, ct)
+
+	return encryptedContentInfo{
+		ContentType:                OIDData,
+		ContentEncryptionAlgorithm: asn1.RawValue{FullBytes: algo},
+		EncryptedContent:           ct,
+	}, nil
+}
+
+func decryptContent(eci *encryptedContentInfo, cek []byte) ([]byte, error) {
+	mode, err := skipjack.NewCBCDecrypterFromAlgorithm(eci.ContentEncryptionAlgorithm.FullBytes, cek)
+	if err != nil {
+		return nil, err
+	}
+
+	ct := eci.EncryptedContent
+	if len(ct) == 0 || len(ct)%mode.BlockSize() != 0 {
+		return nil, errPadding
+	}
+
+	pt := make([]byte, len(ct))
+	mode.CryptBlocks(pt, ct)
+
+	if pt, err = skipjack.Unpad(pt); err != nil {
+		return nil, errPadding
+	}
+
+	return pt, nil
+}
+
+// Decrypt decrypts DER ContentInfo holding EnvelopedData addressed to the
+// recipient identified by id with static key priv.  originatorKeys resolves
+// the sender's static public key.  Until id-fortezzaWrap80 is implemented
+// it returns ErrWrap80 once the recipient's key has been agreed.
+func Decrypt(der []byte, id KeyIdentifier, priv *kea.PrivateKey, originatorKeys OriginatorKeys) ([]byte, error) {
+	if originatorKeys == nil {
+		return nil, errNoOriginator
+	}
+
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errTrailingData
+	}
+
+	if !ci.ContentType.Equal(OIDEnvelopedData) {
+		return nil, errNotEnveloped
+	}
+
+	var ed envelopedData
+	if rest, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errTrailingData
+	}
+
+	for _, ri := range ed.RecipientInfos {
+		// skip the other kinds of RecipientInfo
+		if ri.Class != asn1.ClassContextSpecific || ri.Tag != 1 {
+			continue
+		}
+
+		var kari keyAgreeRecipientInfo
+		if _, err := asn1.UnmarshalWithParams(ri.FullBytes, &kari, "tag:1"); err != nil {
+			return nil, err
+		}
+
+		if err := checkKeyEncryptionAlgorithm(kari.KeyEncryptionAlgorithm); err != nil {
+			continue
+		}
+
+		for _, rek := range kari.RecipientEncryptedKeys {
+			rid, err := parseRecipientID(rek.RID)
+			if err != nil || !rid.Equal(id) {
+				continue
+			}
+
+			cek, err := unwrapCEK(&kari, rek.EncryptedKey, priv, originatorKeys)
+			if err != nil {
+				return nil, err
+			}
+
+			return decryptContent(&ed.EncryptedContentInfo, cek)
+		}
+	}
+
+	return nil, ErrNotRecipient
+}
+
+func unwrapCEK(kari *keyAgreeRecipientInfo, wrapped []byte, priv *kea.PrivateKey, originatorKeys OriginatorKeys) ([]byte, error) {
+	oid, err := parseOriginatorID(kari.Originator)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := originatorKeys(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kari.UKM) != (priv.P.BitLen()+7)/8 {
+		return nil, errEphemeralValue
+	}
+
+	ra := &kea.PublicKey{Parameters: priv.Parameters, Y: new(big.Int).SetBytes(kari.UKM)}
+
+	// this party's static key stands in for its ephemeral key
+	kek, err := kea.Agree(priv, priv, pub, ra)
+	if err != nil {
+		return nil, err
+	}
+
+	return unwrap80(kek, wrapped)
+}
@@ -0,0 +1,185 @@
+package cms
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/Phraxos/go-skipjack"
+	"github.com/Phraxos/go-skipjack/internal/keywrap"
+	"github.com/Phraxos/go-skipjack/kea"
+)
+
+func fromHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("bad hex: " + s)
+	}
+	return n
+}
+
+var testParameters = kea.Parameters{
+	P: fromHex("a07377e4d4eae2231e2329aad6e0ad41015d12b4791fd3fb1ca22c4d3667be43d09c91917f4106b9843247182c6662a7db0f529a0a184a6b7f2b6f4e53e9c30471b5adeaed57f2f4d494f839978fe245a4a00a9a9e18e32f5ad8a66a9bd45a41b30fa9acda5dcad72df214bc64cf43ff5483721f2d5aa6b809da64e963863b7f"),
+	Q: fromHex("e9d6762f5173237c26b61ee6efa8a4df7cddc11b"),
+	G: fromHex("23afd9da2f7e1337006c5d32fcc28502263442bfbf07e967d0e9b8adce6f7f013986c5900a5dbc8daae7a3a02d6e06680bd476315c47f8d521c3e060879d93656405dddf19f800078ccf68cf798e493dba27775de1100179c0ab0c5144361a1b0ca438e3f2ac99b821308e03f3f723c2fa9bbe00201aa82f0c9ba90ab5969e78"),
+}
+
+func generate(t *testing.T) *kea.PrivateKey {
+	k, err := kea.GenerateKey(&testParameters, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func issuer(t *testing.T, cn string) []byte {
+	der, err := asn1.Marshal(pkix.Name{CommonName: cn}.ToRDNSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// standInWrap80 replaces the missing id-fortezzaWrap80 with a different
+// 12-byte wrap for the length of a test, so that everything around it can
+// be checked
+func standInWrap80(t *testing.T) {
+	wrap, unwrap := wrap80, unwrap80
+	wrap80, unwrap80 = keywrap.Wrap, keywrap.Unwrap
+	t.Cleanup(func() { wrap80, unwrap80 = wrap, unwrap })
+}
+
+func TestWrap80(t *testing.T) {
+
+	alice := &Originator{ID: KeyIdentifier{SubjectKeyID: []byte{1}}, Key: generate(t)}
+	bobKey := generate(t)
+	bob := Recipient{ID: KeyIdentifier{SubjectKeyID: []byte{2}}, Key: &bobKey.PublicKey}
+	lookup := func(KeyIdentifier) (*kea.PublicKey, error) { return &alice.Key.PublicKey, nil }
+
+	if _, err := Encrypt(rand.Reader, []byte("attack at dawn"), alice, []Recipient{bob}); err != ErrWrap80 {
+		t.Errorf("cms encrypted without wrap80: %v\n", err)
+	}
+
+	// a message from an implementation that has it
+	wrap := wrap80
+	wrap80 = keywrap.Wrap
+	der, err := Encrypt(rand.Reader, []byte("attack at dawn"), alice, []Recipient{bob})
+	wrap80 = wrap
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decrypt(der, bob.ID, bobKey, lookup); err != ErrWrap80 {
+		t.Errorf("cms decrypted without wrap80: %v\n", err)
+	}
+}
+
+func TestEnvelopedData(t *testing.T) {
+
+	standInWrap80(t)
+
+	ca := issuer(t, "MISSI CA")
+
+	alice := &Originator{ID: KeyIdentifier{Issuer: ca, SerialNumber: big.NewInt(1)}, Key: generate(t)}
+
+	bobKey, carolKey := generate(t), generate(t)
+	bob := Recipient{ID: KeyIdentifier{Issuer: ca, SerialNumber: big.NewInt(2)}, Key: &bobKey.PublicKey}
+	carol := Recipient{ID: KeyIdentifier{SubjectKeyID: []byte{0xca, 0x20, 0x1e}}, Key: &carolKey.PublicKey}
+
+	lookup := func(id KeyIdentifier) (*kea.PublicKey, error) {
+		if id.Equal(alice.ID) {
+			return &alice.Key.PublicKey, nil
+		}
+		return nil, errors.New("unknown originator")
+	}
+
+	for _, msg := range [][]byte{nil, []byte("12345678"), []byte("attack at dawn")} {
+		der, err := Encrypt(rand.Reader, msg, alice, []Recipient{bob, carol})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pt, err := Decrypt(der, bob.ID, bobKey, lookup); err != nil || !bytes.Equal(pt, msg) {
+			t.Errorf("cms decrypt (issuer and serial) failed: got %q wanted %q (%v)\n", pt, msg, err)
+		}
+
+		if pt, err := Decrypt(der, carol.ID, carolKey, lookup); err != nil || !bytes.Equal(pt, msg) {
+			t.Errorf("cms decrypt (key id) failed: got %q wanted %q (%v)\n", pt, msg, err)
+		}
+	}
+
+	der, _ := Encrypt(rand.Reader, []byte("attack at dawn"), alice, []Recipient{bob})
+
+	if _, err := Decrypt(der, carol.ID, carolKey, lookup); err != ErrNotRecipient {
+		t.Errorf("cms decrypted for a key it was not addressed to: %v\n", err)
+	}
+
+	// the wrong originator key gives the wrong KEK
+	wrong := func(KeyIdentifier) (*kea.PublicKey, error) { return &carolKey.PublicKey, nil }
+	if _, err := Decrypt(der, bob.ID, bobKey, wrong); err == nil {
+		t.Errorf("cms decrypted with the wrong originator key\n")
+	}
+
+	if _, err := Decrypt(append(der, 0), bob.ID, bobKey, lookup); err == nil {
+		t.Errorf("cms decrypted a message with trailing data\n")
+	}
+}
+
+func TestEnvelopedDataEncoding(t *testing.T) {
+
+	standInWrap80(t)
+
+	ca := issuer(t, "MISSI CA")
+	alice := &Originator{ID: KeyIdentifier{SubjectKeyID: []byte{1, 2, 3}}, Key: generate(t)}
+	bob := Recipient{ID: KeyIdentifier{Issuer: ca, SerialNumber: big.NewInt(2)}, Key: &generate(t).PublicKey}
+
+	der, err := Encrypt(rand.Reader, []byte("attack at dawn"), alice, []Recipient{bob})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ci contentInfo
+	var ed envelopedData
+	var kari keyAgreeRecipientInfo
+
+	if _, err := asn1.Unmarshal(der, &ci); err != nil || !ci.ContentType.Equal(OIDEnvelopedData) {
+		t.Fatalf("cms content info: %v\n", err)
+	}
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil || ed.Version != 2 || len(ed.RecipientInfos) != 1 {
+		t.Fatalf("cms enveloped data: %v\n", err)
+	}
+
+	ri := ed.RecipientInfos[0]
+	if ri.Class != asn1.ClassContextSpecific || ri.Tag != 1 {
+		t.Errorf("cms recipient info is not a KeyAgreeRecipientInfo: %+v\n", ri)
+	}
+	if _, err := asn1.UnmarshalWithParams(ri.FullBytes, &kari, "tag:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if kari.Version != 3 || len(kari.UKM) != 128 || len(kari.RecipientEncryptedKeys) != 1 {
+		t.Errorf("cms key agreement info: version %d, ukm %d bytes\n", kari.Version, len(kari.UKM))
+	}
+
+	if err := checkKeyEncryptionAlgorithm(kari.KeyEncryptionAlgorithm); err != nil {
+		t.Errorf("cms key encryption algorithm: %v\n", err)
+	}
+
+	if id, err := parseOriginatorID(kari.Originator); err != nil || !id.Equal(alice.ID) {
+		t.Errorf("cms originator id: got %+v wanted %+v (%v)\n", id, alice.ID, err)
+	}
+
+	rek := kari.RecipientEncryptedKeys[0]
+	if id, err := parseRecipientID(rek.RID); err != nil || !id.Equal(bob.ID) || len(rek.EncryptedKey) != 12 {
+		t.Errorf("cms recipient id: got %+v wanted %+v (%v)\n", id, bob.ID, err)
+	}
+
+	eci := ed.EncryptedContentInfo
+	if _, err := skipjack.ParseAlgorithmIdentifier(eci.ContentEncryptionAlgorithm.FullBytes); err != nil || len(eci.EncryptedContent) != 16 {
+		t.Errorf("cms content encryption: %d bytes (%v)\n", len(eci.EncryptedContent), err)
+	}
+}
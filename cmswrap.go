@@ -0,0 +1,120 @@
+package skipjack
+
+import (
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/subtle"
+	"errors"
+	"io"
+)
+
+/*
+
+   CMS key wrapping, from:
+   RFC 3217, "Triple-DES and RC2 Key Wrapping"
+   http://tools.ietf.org/html/rfc3217
+
+   This is the RC2 variant of the algorithm with SKIPJACK as the block
+   cipher.  The RC2 variant carries a length octet and random padding, which
+   is what a 10-byte key needs with a 64-bit block.
+
+*/
+
+var cmsWrapIV = []byte{0x4a, 0xdd, 0xa2, 0x2c, 0x79, 0xe8, 0x21, 0x05}
+
+// WrapCMS wraps the content-encryption key cek under the 10-byte kek.  The
+// random IV and padding are read from rand.
+func WrapCMS(rand io.Reader, kek, cek []byte) ([]byte, error) {
+	if len(cek) == 0 || len(cek) > 255 {
+		return nil, errors.New("skipjack: invalid CMS content-encryption key length")
+	}
+
+	b, err := New(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	return cmsWrap(rand, b, cek)
+}
+
+// UnwrapCMS reverses WrapCMS, returning an error if the checksum does not
+// match.
+func UnwrapCMS(kek, wrapped []byte) ([]byte, error) {
+	b, err := New(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	return cmsUnwrap(b, wrapped)
+}
+
+func cmsWrap(rand io.Reader, b cipher.Block, cek []byte) ([]byte, error) {
+	bs := b.BlockSize()
+
+	// LCEKPAD = LENGTH || CEK || PAD
+	n := (1 + len(cek) + bs - 1) / bs * bs
+	lcekpad := make([]byte, n, n+bs)
+	lcekpad[0] = byte(len(cek))
+	copy(lcekpad[1:], cek)
+	if _, err := io.ReadFull(rand, lcekpad[1+len(cek):]); err != nil {
+		return nil, err
+	}
+
+	// LCEKPADICV = LCEKPAD || ICV
+	lcekpadicv := append(lcekpad, cmsChecksum(lcekpad)...)
+
+	// TEMP2 = IV || TEMP1
+	temp2 := make([]byte, bs+len(lcekpadicv))
+	if _, err := io.ReadFull(rand, temp2[:bs]); err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(b, temp2[:bs]).CryptBlocks(temp2[bs:], lcekpadicv)
+
+	reverseBytes(temp2)
+	cipher.NewCBCEncrypter(b, cmsWrapIV).CryptBlocks(temp2, temp2)
+
+	return temp2, nil
+}
+
+func cmsUnwrap(b cipher.Block, wrapped []byte) ([]byte, error) {
+	bs := b.BlockSize()
+
+	// IV, at least one block of LCEKPAD, and the checksum
+	if len(wrapped)%bs != 0 || len(wrapped) < 3*bs {
+		return nil, errors.New("skipjack: invalid CMS wrapped key length")
+	}
+
+	temp2 := make([]byte, len(wrapped))
+	cipher.NewCBCDecrypter(b, cmsWrapIV).CryptBlocks(temp2, wrapped)
+	reverseBytes(temp2)
+
+	lcekpadicv := make([]byte, len(temp2)-bs)
+	cipher.NewCBCDecrypter(b, temp2[:bs]).CryptBlocks(lcekpadicv, temp2[bs:])
+
+	lcekpad := lcekpadicv[:len(lcekpadicv)-bs]
+	icv := lcekpadicv[len(lcekpad):]
+
+	if subtle.ConstantTimeCompare(cmsChecksum(lcekpad), icv) != 1 {
+		return nil, errUnwrap
+	}
+
+	// the padding is less than a block
+	n := int(lcekpad[0])
+	if n == 0 || 1+n > len(lcekpad) || len(lcekpad)-(1+n) >= bs {
+		return nil, errUnwrap
+	}
+
+	return lcekpad[1 : 1+n], nil
+}
+
+// cmsChecksum is the RFC 3217 key checksum: the first 8 octets of SHA-1
+func cmsChecksum(b []byte) []byte {
+	h := sha1.Sum(b)
+	return h[:8]
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
@@ -0,0 +1,73 @@
+package skipjack
+
+import (
+	"bytes"
+	"testing"
+)
+
+// fixedReader returns an endless stream of b
+type fixedReader byte
+
+func (r fixedReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func TestCMSWrap(t *testing.T) {
+
+	kek := skipjackTestVectors[0].key
+	cek := []byte{0xb7, 0x0a, 0x25, 0xfb, 0xc9, 0xd8, 0x6a, 0x86, 0x05, 0x0c}
+
+	w, err := WrapCMS(fixedReader(0x42), kek, cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// IV + LENGTH || CEK || PAD + ICV
+	if len(w) != 8+16+8 {
+		t.Errorf("cms wrap length: got %d wanted 32\n", len(w))
+	}
+
+	w2, _ := WrapCMS(fixedReader(0x42), kek, cek)
+	if !bytes.Equal(w, w2) {
+		t.Errorf("cms wrap is not reproducible with a fixed reader\n")
+	}
+
+	w3, _ := WrapCMS(fixedReader(0x43), kek, cek)
+	if bytes.Equal(w, w3) {
+		t.Errorf("cms wrap ignored the random reader\n")
+	}
+
+	k, err := UnwrapCMS(kek, w)
+	if err != nil || !bytes.Equal(k, cek) {
+		t.Errorf("cms unwrap failed: got %#v (%v) wanted %#v\n", k, err, cek)
+	}
+
+	for i := range w {
+		w[i] ^= 0x80
+		if _, err := UnwrapCMS(kek, w); err == nil {
+			t.Errorf("cms unwrap accepted a modification of byte %d\n", i)
+		}
+		w[i] ^= 0x80
+	}
+
+	if _, err := UnwrapCMS(skipjackTestVectors[0].plain[:2], w); err == nil {
+		t.Errorf("cms unwrap accepted a short kek\n")
+	}
+
+	other := append([]byte{}, kek...)
+	other[0] ^= 1
+	if _, err := UnwrapCMS(other, w); err == nil {
+		t.Errorf("cms unwrap accepted the wrong kek\n")
+	}
+
+	for n := 1; n <= 24; n++ {
+		cek := bytes.Repeat([]byte{byte(n)}, n)
+		w, _ := WrapCMS(fixedReader(0), kek, cek)
+		if k, err := UnwrapCMS(kek, w); err != nil || !bytes.Equal(k, cek) {
+			t.Errorf("cms round trip failed for length %d: %v\n", n, err)
+		}
+	}
+}
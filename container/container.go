@@ -0,0 +1,262 @@
+// Package container implements a versioned file format for data encrypted
+// with SKIPJACK.
+/*
+
+   A container is a header followed by the payload.  All integers are big
+   endian.
+
+     offset  size  field
+     0       4     magic "SJCF"
+     4       1     version, 1
+     5       1     KDF: 0 = key file, 1 = PBKDF2-HMAC-SHA256
+     6       4     KDF iteration count, 0 for a key file
+     10      1     salt length n, 0 for a key file
+     11      n     salt
+     11+n    8     key ID, all zero for a passphrase
+     19+n    1     mode: 1 = SKIPJACK-EAX STREAM
+     20+n    4     plaintext segment size
+     24+n    7     nonce prefix
+
+   The nonce prefix begins the payload, which is the output of
+   skipjack.NewEncryptWriter: each plaintext segment is sealed with
+   SKIPJACK-EAX and carries an 8-byte tag, and the last segment is marked
+   so that truncation is detected.  The header up to the nonce prefix is
+   the associated data of every segment, so any change to it makes
+   decryption fail.
+
+   Decryption returns each segment once it has been authenticated, so a
+   damaged file can yield some plaintext before the error.
+
+*/
+package container
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// Magic starts every container.
+const Magic = "SJCF"
+
+// Version is the format version written by NewWriter.
+const Version = 1
+
+// Key derivation functions.
+const (
+	KDFNone   = 0
+	KDFPBKDF2 = 1
+)
+
+// ModeEAXStream is SKIPJACK-EAX in the STREAM construction.
+const ModeEAXStream = 1
+
+// NonceSize is the length of the nonce prefix.
+const NonceSize = 7
+
+// KeyIDSize is the length of a key ID.
+const KeyIDSize = 8
+
+const (
+	// DefaultIterations is the PBKDF2 iteration count used by
+	// PassphraseHeader when none is given.
+	DefaultIterations = skipjack.DefaultIterations
+
+	// MaxIterations is the largest PBKDF2 iteration count accepted, so
+	// that a crafted header cannot make PassphraseKey run for hours.
+	MaxIterations = 16 * DefaultIterations
+
+	saltSize       = 16
+	maxSaltSize    = 64
+	maxSegmentSize = 16 << 20
+)
+
+var (
+	errHeader     = errors.New("container: malformed header")
+	errIterations = errors.New("container: too many PBKDF2 iterations")
+)
+
+// Header is a container header.
+type Header struct {
+	Version     int
+	KDF         int
+	Iterations  int
+	Salt        []byte
+	KeyID       []byte
+	Mode        int
+	SegmentSize int
+	Nonce       []byte
+
+	// the encoding of the fields before the nonce
+	raw []byte
+}
+
+// KeyHeader returns a header for data encrypted directly under k.
+func KeyHeader(k *Key) *Header {
+	return &Header{KDF: KDFNone, KeyID: append([]byte(nil), k.ID...)}
+}
+
+// PassphraseHeader returns a header for a key derived from passphrase with
+// PBKDF2, and the key.  If iterations is 0, DefaultIterations is used;
+// it may not exceed MaxIterations.
+func PassphraseHeader(passphrase []byte, iterations int) (*Header, []byte, error) {
+	if iterations == 0 {
+		iterations = DefaultIterations
+	}
+
+	h := &Header{
+		KDF:        KDFPBKDF2,
+		Iterations: iterations,
+		Salt:       make([]byte, saltSize),
+		KeyID:      make([]byte, KeyIDSize),
+	}
+	if _, err := io.ReadFull(rand.Reader, h.Salt); err != nil {
+		return nil, nil, err
+	}
+
+	key, err := h.PassphraseKey(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return h, key, nil
+}
+
+// PassphraseKey derives the key for a container encrypted with a
+// passphrase.
+func (h *Header) PassphraseKey(passphrase []byte) ([]byte, error) {
+	if h.KDF != KDFPBKDF2 {
+		return nil, errors.New("container: not encrypted with a passphrase")
+	}
+	if h.Iterations <= 0 || len(h.Salt) == 0 {
+		return nil, errHeader
+	}
+	if h.Iterations > MaxIterations {
+		return nil, errIterations
+	}
+
+	return skipjack.DeriveKey(passphrase, h.Salt, &skipjack.KDFParams{KDF: skipjack.PBKDF2, Iterations: h.Iterations})
+}
+
+func (h *Header) marshal() ([]byte, error) {
+	if len(h.Salt) > maxSaltSize || len(h.KeyID) != KeyIDSize || h.Iterations < 0 || uint64(h.Iterations) > math.MaxUint32 ||
+		h.SegmentSize <= 0 || h.SegmentSize > maxSegmentSize {
+		return nil, errHeader
+	}
+
+	b := []byte(Magic)
+	b = append(b, byte(h.Version), byte(h.KDF))
+	b = binary.BigEndian.AppendUint32(b, uint32(h.Iterations))
+	b = append(b, byte(len(h.Salt)))
+	b = append(b, h.Salt...)
+	b = append(b, h.KeyID...)
+	b = append(b, byte(h.Mode))
+	b = binary.BigEndian.AppendUint32(b, uint32(h.SegmentSize))
+
+	return b, nil
+}
+
+// ReadHeader reads a container header, including the nonce prefix, from
+// r.  It does not need the key.  A header asking for more than
+// MaxIterations is rejected.
+func ReadHeader(r io.Reader) (*Header, error) {
+	fixed := make([]byte, 11)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, errHeader
+	}
+	if string(fixed[:4]) != Magic {
+		return nil, errors.New("container: not a SKIPJACK container")
+	}
+
+	h := &Header{
+		Version:    int(fixed[4]),
+		KDF:        int(fixed[5]),
+		Iterations: int(binary.BigEndian.Uint32(fixed[6:])),
+	}
+	if h.Version != Version {
+		return nil, errors.New("container: unsupported version")
+	}
+
+	rest := make([]byte, int(fixed[10])+KeyIDSize+1+4+NonceSize)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, errHeader
+	}
+
+	h.Salt, rest = rest[:fixed[10]], rest[fixed[10]:]
+	h.KeyID, rest = rest[:KeyIDSize], rest[KeyIDSize:]
+	h.Mode = int(rest[0])
+	h.SegmentSize = int(binary.BigEndian.Uint32(rest[1:]))
+	h.Nonce = rest[5:]
+
+	switch {
+	case h.KDF == KDFNone && (h.Iterations != 0 || len(h.Salt) != 0):
+		return nil, errHeader
+	case h.KDF == KDFPBKDF2 && (h.Iterations == 0 || len(h.Salt) == 0):
+		return nil, errHeader
+	case h.Iterations > MaxIterations:
+		return nil, errIterations
+	case h.KDF != KDFNone && h.KDF != KDFPBKDF2:
+		return nil, errors.New("container: unknown KDF")
+	case h.Mode != ModeEAXStream:
+		return nil, errors.New("container: unknown mode")
+	}
+
+	raw, err := h.marshal()
+	if err != nil {
+		return nil, err
+	}
+	h.raw = raw
+
+	return h, nil
+}
+
+// NewWriter writes h to w and returns a WriteCloser which encrypts to w
+// under key.  The caller sets the KDF fields and key ID, usually with
+// KeyHeader or PassphraseHeader, and may set SegmentSize; NewWriter fills in
+// the rest.  Close must be called to seal the last segment; it does not
+// close w.
+func NewWriter(w io.Writer, h *Header, key []byte) (io.WriteCloser, error) {
+	h.Version = Version
+	h.Mode = ModeEAXStream
+	if h.SegmentSize == 0 {
+		h.SegmentSize = skipjack.DefaultSegmentSize
+	}
+
+	raw, err := h.marshal()
+	if err != nil {
+		return nil, err
+	}
+	h.raw = raw
+
+	h.Nonce = make([]byte, NonceSize)
+	if _, err := io.ReadFull(rand.Reader, h.Nonce); err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+
+	// the stream writes the nonce prefix it reads from its source
+	return skipjack.NewEncryptWriter(w, key,
+		skipjack.WithRand(bytes.NewReader(h.Nonce)),
+		skipjack.WithSegmentSize(h.SegmentSize),
+		skipjack.WithAssociatedData(raw))
+}
+
+// NewReader returns a Reader which decrypts the payload following h in r
+// under key.  h must have been read from r by ReadHeader.
+func NewReader(r io.Reader, h *Header, key []byte) (io.Reader, error) {
+	if h.raw == nil {
+		return nil, errors.New("container: header was not read by ReadHeader")
+	}
+
+	return skipjack.NewDecryptReader(io.MultiReader(bytes.NewReader(h.Nonce), r), key,
+		skipjack.WithSegmentSize(h.SegmentSize),
+		skipjack.WithAssociatedData(h.raw))
+}
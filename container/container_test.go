@@ -0,0 +1,157 @@
+package container
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"math"
+	"testing"
+)
+
+func seal(t *testing.T, h *Header, key, msg []byte) []byte {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, h, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func open(c []byte, key []byte) (*Header, []byte, error) {
+	r := bytes.NewReader(c)
+
+	h, err := ReadHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if key == nil {
+		return h, nil, nil
+	}
+
+	pr, err := NewReader(r, h, key)
+	if err != nil {
+		return h, nil, err
+	}
+
+	pt, err := io.ReadAll(pr)
+	return h, pt, err
+}
+
+func TestContainer(t *testing.T) {
+
+	k, _ := GenerateKey(rand.Reader)
+
+	msg := make([]byte, 1000)
+	rand.Read(msg)
+
+	h := KeyHeader(k)
+	h.SegmentSize = 64
+	c := seal(t, h, k.Value, msg)
+
+	got, pt, err := open(c, k.Value)
+	if err != nil || !bytes.Equal(pt, msg) {
+		t.Fatalf("container round trip failed: %v\n", err)
+	}
+
+	if got.Version != Version || got.KDF != KDFNone || !bytes.Equal(got.KeyID, k.ID) ||
+		got.Mode != ModeEAXStream || got.SegmentSize != 64 || !bytes.Equal(got.Nonce, h.Nonce) {
+		t.Errorf("container header failed: got %+v wanted %+v\n", got, h)
+	}
+
+	// header layout
+	if string(c[:4]) != Magic || !bytes.Equal(c[11:19], k.ID) || !bytes.Equal(c[24:31], h.Nonce) {
+		t.Errorf("container layout failed: got %x\n", c[:31])
+	}
+
+	// 1000 bytes in 64-byte segments is 16 segments with 8-byte tags
+	if len(c) != 24+NonceSize+1000+16*8 {
+		t.Errorf("container is %d bytes\n", len(c))
+	}
+
+	// every header byte is authenticated
+	for i := 4; i < 24; i++ {
+		bad := append([]byte(nil), c...)
+		bad[i] ^= 1
+		if _, _, err := open(bad, k.Value); err == nil {
+			t.Errorf("container accepted a change to header byte %d\n", i)
+		}
+	}
+
+	for _, n := range []int{0, 3, 10, 30} {
+		if _, err := ReadHeader(bytes.NewReader(c[:n])); err == nil {
+			t.Errorf("container read a header truncated to %d bytes\n", n)
+		}
+	}
+
+	if _, _, err := open(c[:len(c)-72], k.Value); err == nil {
+		t.Errorf("container accepted a truncated payload\n")
+	}
+
+	other, _ := GenerateKey(rand.Reader)
+	if _, _, err := open(c, other.Value); err == nil {
+		t.Errorf("container decrypted under the wrong key\n")
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+
+	h, key, err := PassphraseHeader([]byte("correct horse"), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := seal(t, h, key, []byte("attack at dawn"))
+
+	got, _, err := open(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.KDF != KDFPBKDF2 || got.Iterations != 1000 || !bytes.Equal(got.Salt, h.Salt) {
+		t.Errorf("container passphrase header failed: got %+v\n", got)
+	}
+
+	derived, err := got.PassphraseKey([]byte("correct horse"))
+	if err != nil || !bytes.Equal(derived, key) {
+		t.Fatalf("container passphrase key failed: got %x wanted %x (%v)\n", derived, key, err)
+	}
+
+	if _, pt, err := open(c, derived); err != nil || string(pt) != "attack at dawn" {
+		t.Errorf("container passphrase round trip failed: %q (%v)\n", pt, err)
+	}
+
+	wrong, _ := got.PassphraseKey([]byte("battery staple"))
+	if _, _, err := open(c, wrong); err == nil {
+		t.Errorf("container decrypted with the wrong passphrase\n")
+	}
+
+	k, _ := GenerateKey(rand.Reader)
+	if _, err := KeyHeader(k).PassphraseKey([]byte("x")); err == nil {
+		t.Errorf("container derived a key for a key-file header\n")
+	}
+
+	if _, _, err := PassphraseHeader([]byte("x"), MaxIterations+1); err != errIterations {
+		t.Errorf("container passphrase header accepted %d iterations: %v\n", MaxIterations+1, err)
+	}
+
+	// a header may not ask for more work than MaxIterations
+	for _, n := range []int{MaxIterations + 1, math.MaxUint32} {
+		h.Iterations = n
+		b, err := h.marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = append(b, make([]byte, NonceSize)...)
+		if _, err := ReadHeader(bytes.NewReader(b)); err != errIterations {
+			t.Errorf("container header accepted %d iterations: %v\n", n, err)
+		}
+	}
+}
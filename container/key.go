@@ -0,0 +1,95 @@
+package container
+
+import (
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// KeyPEMType is the PEM block type of a key file.
+const KeyPEMType = "SKIPJACK KEY"
+
+// the length of a SKIPJACK key
+const keySize = 10
+
+// Key is a SKIPJACK key and the ID recorded in the containers it encrypts.
+type Key struct {
+	ID    []byte
+	Value []byte
+}
+
+// GenerateKey returns a random key with a random ID.
+func GenerateKey(rand io.Reader) (*Key, error) {
+	k := &Key{ID: make([]byte, KeyIDSize), Value: make([]byte, keySize)}
+
+	if _, err := io.ReadFull(rand, k.ID); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand, k.Value); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// MarshalPEM returns k as a PEM "SKIPJACK KEY" block with Key-ID and KCV
+// headers.
+func (k *Key) MarshalPEM() ([]byte, error) {
+	kcv, err := skipjack.KCV(k.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type: KeyPEMType,
+		Headers: map[string]string{
+			"Key-ID": hex.EncodeToString(k.ID),
+			"KCV":    hex.EncodeToString(kcv),
+		},
+		Bytes: k.Value,
+	}), nil
+}
+
+// ParseKeyPEM parses the first PEM block in data as a key.  The key must
+// match the check value in the KCV header, and the KCV-CMAC header if
+// there is one.
+func ParseKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("container: no PEM data found")
+	}
+	if block.Type != KeyPEMType {
+		return nil, errors.New("container: unexpected PEM block type " + block.Type)
+	}
+
+	id, err := hex.DecodeString(block.Headers["Key-ID"])
+	if err != nil || len(id) != KeyIDSize {
+		return nil, errors.New("container: missing or invalid Key-ID")
+	}
+	if len(block.Bytes) != keySize {
+		return nil, errors.New("container: invalid key length")
+	}
+
+	kcv, err := hex.DecodeString(block.Headers["KCV"])
+	if err != nil || len(kcv) == 0 {
+		return nil, errors.New("container: missing or invalid KCV")
+	}
+	if err := skipjack.VerifyKCV(block.Bytes, kcv); err != nil {
+		return nil, err
+	}
+
+	if h, ok := block.Headers["KCV-CMAC"]; ok {
+		kcv, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, errors.New("container: invalid KCV-CMAC")
+		}
+		if err := skipjack.VerifyCMACKCV(block.Bytes, kcv); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Key{ID: id, Value: block.Bytes}, nil
+}
@@ -0,0 +1,79 @@
+package container
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+func TestKeyPEM(t *testing.T) {
+
+	k := &Key{
+		ID:    []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef},
+		Value: []byte{0x00, 0x99, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11},
+	}
+
+	p, err := k.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kcv, _ := skipjack.KCV(k.Value)
+	if !strings.Contains(string(p), "Key-ID: 0123456789abcdef") || !strings.Contains(string(p), "KCV: "+hex.EncodeToString(kcv)) {
+		t.Errorf("container key PEM failed: got %s\n", p)
+	}
+
+	got, err := ParseKeyPEM(p)
+	if err != nil || !bytes.Equal(got.ID, k.ID) || !bytes.Equal(got.Value, k.Value) {
+		t.Errorf("container key round trip failed: %v\n", err)
+	}
+
+	if _, err := ParseKeyPEM([]byte(strings.Replace(string(p), "Key-ID: 0123456789abcdef\n", "", 1))); err == nil {
+		t.Errorf("container parsed a key without an ID\n")
+	}
+
+	if _, err := (&Key{ID: k.ID, Value: k.Value[:8]}).MarshalPEM(); err == nil {
+		t.Errorf("container marshalled a short key\n")
+	}
+
+	block := &pem.Block{
+		Type:    KeyPEMType,
+		Headers: map[string]string{"Key-ID": "0123456789abcdef", "KCV": hex.EncodeToString(kcv)},
+		Bytes:   k.Value,
+	}
+
+	// a mistyped key fails its check value
+	block.Bytes = append([]byte(nil), k.Value...)
+	block.Bytes[9] ^= 1
+	if _, err := ParseKeyPEM(pem.EncodeToMemory(block)); err != skipjack.ErrKCVMismatch {
+		t.Errorf("container parsed a key with the wrong KCV: %v\n", err)
+	}
+	block.Bytes = k.Value
+
+	delete(block.Headers, "KCV")
+	if _, err := ParseKeyPEM(pem.EncodeToMemory(block)); err == nil {
+		t.Errorf("container parsed a key without a KCV\n")
+	}
+	block.Headers["KCV"] = hex.EncodeToString(kcv)
+
+	// the CMAC check value is checked if present
+	cmacKCV, _ := skipjack.CMACKCV(k.Value)
+	block.Headers["KCV-CMAC"] = hex.EncodeToString(cmacKCV)
+	if _, err := ParseKeyPEM(pem.EncodeToMemory(block)); err != nil {
+		t.Errorf("container rejected a key with a KCV-CMAC: %v\n", err)
+	}
+	block.Headers["KCV-CMAC"] = hex.EncodeToString(kcv)
+	if _, err := ParseKeyPEM(pem.EncodeToMemory(block)); err != skipjack.ErrKCVMismatch {
+		t.Errorf("container parsed a key with the wrong KCV-CMAC: %v\n", err)
+	}
+
+	g, err := GenerateKey(rand.Reader)
+	if err != nil || len(g.ID) != KeyIDSize || len(g.Value) != 10 {
+		t.Errorf("container generate key failed: %v\n", err)
+	}
+}
@@ -0,0 +1,122 @@
+package skipjack
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+/*
+
+   EAX mode, as described in:
+   Bellare, Rogaway, Wagner: "The EAX Mode of Operation"
+   http://web.cs.ucdavis.edu/~rogaway/papers/eax.pdf
+
+   EAX is defined for any block size, which makes it a good fit for a 64-bit
+   cipher.  The tag is a full block.
+
+*/
+
+var errOpen = errors.New("skipjack: message authentication failed")
+
+type eax struct {
+	b         cipher.Block
+	mac       *cmac
+	nonceSize int
+}
+
+// NewEAX returns the given block cipher wrapped in EAX mode with the
+// default nonce length of one block.
+func NewEAX(b cipher.Block) (cipher.AEAD, error) {
+	return NewEAXWithNonceSize(b, b.BlockSize())
+}
+
+// NewEAXWithNonceSize returns the given block cipher wrapped in EAX mode,
+// accepting nonces of the given length.
+func NewEAXWithNonceSize(b cipher.Block, size int) (cipher.AEAD, error) {
+	if size <= 0 {
+		return nil, errors.New("skipjack: invalid EAX nonce size")
+	}
+
+	mac, err := newCMAC(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &eax{b: b, mac: mac, nonceSize: size}, nil
+}
+
+func (e *eax) NonceSize() int { return e.nonceSize }
+func (e *eax) Overhead() int  { return e.b.BlockSize() }
+
+// omac computes OMAC^t(parts...) = CMAC([t]_n || parts...)
+func (e *eax) omac(t byte, data []byte) []byte {
+	prefix := make([]byte, e.b.BlockSize())
+	prefix[len(prefix)-1] = t
+	return e.mac.sum(prefix, data)
+}
+
+func (e *eax) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != e.nonceSize {
+		panic("skipjack: incorrect nonce length given to EAX")
+	}
+
+	n := e.omac(0, nonce)
+	h := e.omac(1, additionalData)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+e.Overhead())
+	ct := out[:len(plaintext)]
+	cipher.NewCTR(e.b, n).XORKeyStream(ct, plaintext)
+
+	c := e.omac(2, ct)
+	tag := out[len(plaintext):]
+	for i := range tag {
+		tag[i] = n[i] ^ h[i] ^ c[i]
+	}
+
+	return ret
+}
+
+func (e *eax) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != e.nonceSize {
+		panic("skipjack: incorrect nonce length given to EAX")
+	}
+
+	if len(ciphertext) < e.Overhead() {
+		return nil, errOpen
+	}
+
+	ct := ciphertext[:len(ciphertext)-e.Overhead()]
+	tag := ciphertext[len(ct):]
+
+	n := e.omac(0, nonce)
+	h := e.omac(1, additionalData)
+	c := e.omac(2, ct)
+
+	expected := make([]byte, len(tag))
+	for i := range expected {
+		expected[i] = n[i] ^ h[i] ^ c[i]
+	}
+
+	if subtle.ConstantTimeCompare(expected, tag) != 1 {
+		return nil, errOpen
+	}
+
+	ret, out := sliceForAppend(dst, len(ct))
+	cipher.NewCTR(e.b, n).XORKeyStream(out, ct)
+
+	return ret, nil
+}
+
+// sliceForAppend extends in by n bytes, returning the whole slice and the
+// newly added tail.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,118 @@
+package skipjack
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// http://csrc.nist.gov/publications/nistpubs/800-38B/SP_800-38B.pdf
+// The CMAC code is generic over the block size, so check it against the
+// published AES vectors.
+func TestCMAC(t *testing.T) {
+
+	key := unhex("2b7e151628aed2a6abf7158809cf4f3c")
+
+	var cmacTests = []struct {
+		msg string
+		mac string
+	}{
+		{"", "bb1d6929e95937287fa37d129b756746"},
+		{"6bc1bee22e409f96e93d7e117393172a", "070a16b46b4d4144f79bdd9dd04a287c"},
+		{"6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411", "dfa66747de9ae63030ca32611497c827"},
+	}
+
+	b, _ := aes.NewCipher(key)
+	c, _ := newCMAC(b)
+
+	for _, v := range cmacTests {
+		if m := c.sum(unhex(v.msg)); !bytes.Equal(m, unhex(v.mac)) {
+			t.Errorf("cmac failed for %q: got %x wanted %s\n", v.msg, m, v.mac)
+		}
+	}
+}
+
+// http://web.cs.ucdavis.edu/~rogaway/papers/eax.pdf
+// As with CMAC, the EAX code is checked against the AES vectors.
+func TestEAXVectors(t *testing.T) {
+
+	var eaxTests = []struct {
+		msg    string
+		key    string
+		nonce  string
+		header string
+		cipher string
+	}{
+		{
+			"",
+			"233952DEE4D5ED5F9B9C6D6FF80FF478",
+			"62EC67F9C3A4A407FCB2A8C49031A8B3",
+			"6BFB914FD07EAE6B",
+			"E037830E8389F27B025A2D6527E79D01",
+		},
+		{
+			"F7FB",
+			"91945D3F4DCBEE0BF45EF52255F095A4",
+			"BECAF043B0A23D843194BA972C66DEBD",
+			"FA3BFD4806EB53FA",
+			"19DD5C4C9331049D0BDAB0277408F67967E5",
+		},
+	}
+
+	for _, v := range eaxTests {
+		b, _ := aes.NewCipher(unhex(v.key))
+		e, _ := NewEAXWithNonceSize(b, 16)
+
+		c := e.Seal(nil, unhex(v.nonce), unhex(v.msg), unhex(v.header))
+		if !bytes.Equal(c, unhex(v.cipher)) {
+			t.Errorf("eax seal failed: got %X wanted %s\n", c, v.cipher)
+		}
+
+		p, err := e.Open(nil, unhex(v.nonce), c, unhex(v.header))
+		if err != nil || !bytes.Equal(p, unhex(v.msg)) {
+			t.Errorf("eax open failed: got %X (%v) wanted %s\n", p, err, v.msg)
+		}
+	}
+}
+
+func TestEAXSkipjack(t *testing.T) {
+
+	h, _ := New(skipjackTestVectors[0].key)
+	e, _ := NewEAX(h)
+
+	nonce := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	ad := []byte("header")
+
+	for n := 0; n < 40; n++ {
+		msg := bytes.Repeat([]byte{byte(n)}, n)
+
+		c := e.Seal(nil, nonce, msg, ad)
+		if len(c) != n+e.Overhead() {
+			t.Fatalf("eax seal length: got %d wanted %d\n", len(c), n+e.Overhead())
+		}
+
+		p, err := e.Open(nil, nonce, c, ad)
+		if err != nil || !bytes.Equal(p, msg) {
+			t.Errorf("eax round trip failed for length %d: %v\n", n, err)
+		}
+
+		c[len(c)-1] ^= 1
+		if _, err := e.Open(nil, nonce, c, ad); err == nil {
+			t.Errorf("eax accepted a modified tag for length %d\n", n)
+		}
+		c[len(c)-1] ^= 1
+
+		if _, err := e.Open(nil, nonce, c, []byte("other")); err == nil {
+			t.Errorf("eax accepted the wrong header for length %d\n", n)
+		}
+	}
+}
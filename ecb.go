@@ -0,0 +1,53 @@
+package skipjack
+
+import "crypto/cipher"
+
+/*
+
+   ECB, from:
+   NIST SP 800-38A, "Recommendation for Block Cipher Modes of Operation"
+   http://csrc.nist.gov/publications/nistpubs/800-38a/sp800-38a.pdf
+
+   crypto/cipher leaves ECB out on purpose, but FIPS 81, the FORTEZZA
+   interfaces and PKCS #11 all offer it, so it lives here once.  Each block
+   is encrypted on its own; it should only be used for single blocks or
+   random data such as keys.
+
+*/
+
+type ecb struct {
+	b       cipher.Block
+	decrypt bool
+}
+
+// NewECBEncrypter returns a cipher.BlockMode which encrypts with b in ECB
+// mode.
+func NewECBEncrypter(b cipher.Block) cipher.BlockMode {
+	return &ecb{b: b}
+}
+
+// NewECBDecrypter returns a cipher.BlockMode which decrypts with b in ECB
+// mode.
+func NewECBDecrypter(b cipher.Block) cipher.BlockMode {
+	return &ecb{b: b, decrypt: true}
+}
+
+func (e *ecb) BlockSize() int { return e.b.BlockSize() }
+
+func (e *ecb) CryptBlocks(dst, src []byte) {
+	n := e.b.BlockSize()
+	if len(src)%n != 0 {
+		panic("skipjack: input not full blocks")
+	}
+	if len(dst) < len(src) {
+		panic("skipjack: output smaller than input")
+	}
+
+	for i := 0; i < len(src); i += n {
+		if e.decrypt {
+			e.b.Decrypt(dst[i:i+n], src[i:i+n])
+		} else {
+			e.b.Encrypt(dst[i:i+n], src[i:i+n])
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package skipjack
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestECB(t *testing.T) {
+
+	b, _ := New(unhex("00998877665544332211"))
+	pt := unhex("33221100ddccbbaa33221100ddccbbaa")
+	want := unhex("2587cae27a12d3002587cae27a12d300")
+
+	ct := make([]byte, len(pt))
+	NewECBEncrypter(b).CryptBlocks(ct, pt)
+
+	if !bytes.Equal(ct, want) {
+		t.Errorf("ecb encrypt failed: got %x wanted %x\n", ct, want)
+	}
+
+	NewECBDecrypter(b).CryptBlocks(ct, ct)
+
+	if !bytes.Equal(ct, pt) {
+		t.Errorf("ecb decrypt failed: got %x wanted %x\n", ct, pt)
+	}
+}
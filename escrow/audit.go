@@ -0,0 +1,69 @@
+package escrow
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Audit log actions.
+const (
+	ActionDeposit     = "deposit"
+	ActionRelease     = "release"
+	ActionDeny        = "deny"
+	ActionDecryptLEAF = "decrypt-leaf"
+	ActionRequest     = "request-share"
+	ActionRecover     = "recover-key"
+	ActionFail        = "fail"
+)
+
+// Event is one audit log entry.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	WarrantID string    `json:"warrant_id,omitempty"`
+	UnitID    uint32    `json:"unit_id"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("%s %s %s unit=%08x", e.Time.UTC().Format(time.RFC3339), e.Actor, e.Action, e.UnitID)
+	if e.WarrantID != "" {
+		s += " warrant=" + e.WarrantID
+	}
+	if e.Detail != "" {
+		s += " (" + e.Detail + ")"
+	}
+	return s
+}
+
+// AuditLog is an append-only, concurrency-safe event log.  A nil *AuditLog
+// discards events.
+type AuditLog struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Record appends e to the log.
+func (l *AuditLog) Record(e Event) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	l.events = append(l.events, e)
+	l.mu.Unlock()
+}
+
+// Events returns a copy of the events recorded so far.
+func (l *AuditLog) Events() []Event {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]Event{}, l.events...)
+}
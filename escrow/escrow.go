@@ -0,0 +1,236 @@
+// Package escrow simulates the key-escrow system behind the Clipper and
+// Capstone devices.
+/*
+
+   Each device's unit key is split into two shares, unit key = share1 ^
+   share2, held by two independent escrow agents.  To decrypt intercepted
+   traffic, a decryptor decrypts the LEAF under the family key to learn the
+   unit ID, presents a warrant for that unit to both agents, combines the
+   shares into the unit key, and uses it to recover the session key from the
+   LEAF.  Every step is recorded in an audit log.
+
+   The agents can be used in-process or served over HTTP; see Handler and
+   Client.
+
+*/
+package escrow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Phraxos/go-skipjack/leaf"
+)
+
+var (
+	// ErrNoShare is returned by an agent holding no share for a unit.
+	ErrNoShare = errors.New("escrow: no share held for unit")
+
+	// ErrWarrant is returned for warrants that are expired, not yet valid,
+	// or do not cover the unit in the LEAF.
+	ErrWarrant = errors.New("escrow: warrant does not authorize release")
+)
+
+// Split splits a unit key into two shares whose exclusive-or is the key.
+func Split(rand io.Reader, unitKey []byte) (share1, share2 []byte, err error) {
+	if len(unitKey) != leaf.KeySize {
+		return nil, nil, fmt.Errorf("escrow: invalid unit key size %d", len(unitKey))
+	}
+
+	share1 = make([]byte, len(unitKey))
+	if _, err := io.ReadFull(rand, share1); err != nil {
+		return nil, nil, err
+	}
+
+	share2 = xor(share1, unitKey)
+
+	return share1, share2, nil
+}
+
+// Combine reverses Split.
+func Combine(share1, share2 []byte) ([]byte, error) {
+	if len(share1) != leaf.KeySize || len(share2) != leaf.KeySize {
+		return nil, errors.New("escrow: invalid share size")
+	}
+	return xor(share1, share2), nil
+}
+
+func xor(a, b []byte) []byte {
+	r := make([]byte, len(a))
+	for i := range r {
+		r[i] = a[i] ^ b[i]
+	}
+	return r
+}
+
+// Warrant is the legal authorization presented to the escrow agents.
+type Warrant struct {
+	ID        string    `json:"id"`
+	Agency    string    `json:"agency"`
+	UnitID    uint32    `json:"unit_id"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// Valid reports whether w is in force at now.
+func (w *Warrant) Valid(now time.Time) bool {
+	return !now.Before(w.NotBefore) && !now.After(w.NotAfter)
+}
+
+// ShareSource is an escrow agent as seen by a decryptor.  Agent implements
+// it directly; Client implements it over HTTP.
+type ShareSource interface {
+	RequestShare(ctx context.Context, w *Warrant) ([]byte, error)
+}
+
+// Agent is an escrow agent holding one share of each enrolled unit key.
+type Agent struct {
+	Name string
+
+	// Log receives the agent's audit events; it may be shared.
+	Log *AuditLog
+
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	shares map[uint32][]byte
+}
+
+// NewAgent returns an agent with no shares, logging to log.
+func NewAgent(name string, log *AuditLog) *Agent {
+	return &Agent{Name: name, Log: log, shares: make(map[uint32][]byte)}
+}
+
+func (a *Agent) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
+
+// Deposit stores the agent's share of a unit key.
+func (a *Agent) Deposit(unitID uint32, share []byte) {
+	a.mu.Lock()
+	a.shares[unitID] = append([]byte{}, share...)
+	a.mu.Unlock()
+
+	a.Log.Record(Event{Time: a.now(), Actor: a.Name, Action: ActionDeposit, UnitID: unitID})
+}
+
+// RequestShare releases the agent's share for the unit named in w, if w is
+// currently valid.
+func (a *Agent) RequestShare(ctx context.Context, w *Warrant) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	now := a.now()
+	ev := Event{Time: now, Actor: a.Name, UnitID: w.UnitID, WarrantID: w.ID}
+
+	if !w.Valid(now) {
+		ev.Action, ev.Detail = ActionDeny, "warrant not in force"
+		a.Log.Record(ev)
+		return nil, ErrWarrant
+	}
+
+	a.mu.Lock()
+	share, ok := a.shares[w.UnitID]
+	a.mu.Unlock()
+
+	if !ok {
+		ev.Action, ev.Detail = ActionDeny, "no share held"
+		a.Log.Record(ev)
+		return nil, ErrNoShare
+	}
+
+	ev.Action = ActionRelease
+	a.Log.Record(ev)
+
+	return append([]byte{}, share...), nil
+}
+
+// Enroll splits unitKey and deposits one share with each agent, as the
+// programming facility does when a device is manufactured.
+func Enroll(rand io.Reader, unitID uint32, unitKey []byte, agent1, agent2 *Agent) error {
+	s1, s2, err := Split(rand, unitKey)
+	if err != nil {
+		return err
+	}
+
+	agent1.Deposit(unitID, s1)
+	agent2.Deposit(unitID, s2)
+
+	return nil
+}
+
+// Decryptor is the law-enforcement decrypt device.
+type Decryptor struct {
+	Name      string
+	FamilyKey []byte
+	Agents    [2]ShareSource
+	Log       *AuditLog
+
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+func (d *Decryptor) now() time.Time {
+	if d.Now != nil {
+		return d.Now()
+	}
+	return time.Now()
+}
+
+func (d *Decryptor) record(action, warrantID string, unitID uint32, detail string) {
+	d.Log.Record(Event{Time: d.now(), Actor: d.Name, Action: action, WarrantID: warrantID, UnitID: unitID, Detail: detail})
+}
+
+// Recover returns the session key carried in the LEAF l, using the warrant w
+// to obtain the unit key shares from both agents.
+func (d *Decryptor) Recover(ctx context.Context, l []byte, w *Warrant) ([]byte, error) {
+	f, err := leaf.Decrypt(d.FamilyKey, l)
+	if err != nil {
+		d.record(ActionFail, w.ID, 0, err.Error())
+		return nil, err
+	}
+
+	d.record(ActionDecryptLEAF, w.ID, f.UnitID, "")
+
+	if f.UnitID != w.UnitID {
+		d.record(ActionFail, w.ID, f.UnitID, fmt.Sprintf("warrant names unit %08x", w.UnitID))
+		return nil, ErrWarrant
+	}
+
+	var shares [2][]byte
+	for i, a := range d.Agents {
+		d.record(ActionRequest, w.ID, f.UnitID, fmt.Sprintf("agent %d", i+1))
+
+		s, err := a.RequestShare(ctx, w)
+		if err != nil {
+			d.record(ActionFail, w.ID, f.UnitID, fmt.Sprintf("agent %d: %v", i+1, err))
+			return nil, err
+		}
+		shares[i] = s
+	}
+
+	unitKey, err := Combine(shares[0], shares[1])
+	if err != nil {
+		d.record(ActionFail, w.ID, f.UnitID, err.Error())
+		return nil, err
+	}
+
+	k, err := f.SessionKey(unitKey)
+	if err != nil {
+		d.record(ActionFail, w.ID, f.UnitID, err.Error())
+		return nil, err
+	}
+
+	d.record(ActionRecover, w.ID, f.UnitID, "")
+
+	return k, nil
+}
@@ -0,0 +1,175 @@
+package escrow
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Phraxos/go-skipjack/leaf"
+)
+
+var (
+	unitKey    = []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23}
+	familyKey  = []byte{0xf0, 0xe1, 0xd2, 0xc3, 0xb4, 0xa5, 0x96, 0x87, 0x78, 0x69}
+	sessionKey = []byte{0x00, 0x99, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11}
+	iv         = []byte{0x33, 0x22, 0x11, 0x00, 0xdd, 0xcc, 0xbb, 0xaa}
+)
+
+const unitID = 0x00c11990
+
+var now = time.Date(1994, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func clock() time.Time { return now }
+
+func warrant(unit uint32) *Warrant {
+	return &Warrant{
+		ID:        "W-1994-0042",
+		Agency:    "FBI",
+		UnitID:    unit,
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(time.Hour),
+	}
+}
+
+func TestSplit(t *testing.T) {
+
+	s1, s2, err := Split(rand.Reader, unitKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(s1, unitKey) || bytes.Equal(s2, unitKey) {
+		t.Errorf("escrow share equals the unit key\n")
+	}
+
+	if k, _ := Combine(s1, s2); !bytes.Equal(k, unitKey) {
+		t.Errorf("escrow combine failed: got %x wanted %x\n", k, unitKey)
+	}
+
+	if _, _, err := Split(rand.Reader, unitKey[:8]); err == nil {
+		t.Errorf("escrow split accepted a short key\n")
+	}
+}
+
+// setup enrolls a unit with two agents and returns a LEAF it generated
+func setup(t *testing.T, log *AuditLog) (a1, a2 *Agent, l []byte) {
+	a1, a2 = NewAgent("treasury", log), NewAgent("nist", log)
+	a1.Now, a2.Now = clock, clock
+
+	if err := Enroll(rand.Reader, unitID, unitKey, a1, a2); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := leaf.NewUnit(unitID, unitKey, familyKey)
+	l, _ = u.Generate(sessionKey, iv)
+
+	return a1, a2, l
+}
+
+func TestRecover(t *testing.T) {
+
+	log := &AuditLog{}
+	a1, a2, l := setup(t, log)
+
+	d := &Decryptor{Name: "decryptor", FamilyKey: familyKey, Agents: [2]ShareSource{a1, a2}, Log: log, Now: clock}
+
+	k, err := d.Recover(context.Background(), l, warrant(unitID))
+	if err != nil || !bytes.Equal(k, sessionKey) {
+		t.Fatalf("escrow recover failed: got %x (%v) wanted %x\n", k, err, sessionKey)
+	}
+
+	var actions []string
+	for _, e := range log.Events() {
+		actions = append(actions, e.Actor+":"+e.Action)
+	}
+
+	want := []string{
+		"treasury:deposit", "nist:deposit",
+		"decryptor:decrypt-leaf",
+		"decryptor:request-share", "treasury:release",
+		"decryptor:request-share", "nist:release",
+		"decryptor:recover-key",
+	}
+
+	if len(actions) != len(want) {
+		t.Fatalf("escrow audit log: got %v wanted %v\n", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Errorf("escrow audit log entry %d: got %s wanted %s\n", i, actions[i], want[i])
+		}
+	}
+}
+
+func TestRecoverDenied(t *testing.T) {
+
+	log := &AuditLog{}
+	a1, a2, l := setup(t, log)
+
+	d := &Decryptor{Name: "decryptor", FamilyKey: familyKey, Agents: [2]ShareSource{a1, a2}, Log: log, Now: clock}
+
+	if _, err := d.Recover(context.Background(), l, warrant(unitID+1)); err != ErrWarrant {
+		t.Errorf("escrow recovered with a warrant for another unit: %v\n", err)
+	}
+
+	expired := warrant(unitID)
+	expired.NotAfter = now.Add(-time.Minute)
+	if _, err := d.Recover(context.Background(), l, expired); err != ErrWarrant {
+		t.Errorf("escrow recovered with an expired warrant: %v\n", err)
+	}
+
+	// a unit the agents know nothing about
+	u, _ := leaf.NewUnit(unitID+1, unitKey, familyKey)
+	other, _ := u.Generate(sessionKey, iv)
+	if _, err := d.Recover(context.Background(), other, warrant(unitID+1)); err != ErrNoShare {
+		t.Errorf("escrow recovered an unenrolled unit: %v\n", err)
+	}
+
+	var denials int
+	for _, e := range log.Events() {
+		if e.Action == ActionDeny {
+			denials++
+		}
+	}
+	if denials != 2 {
+		t.Errorf("escrow audit log: got %d denials wanted 2\n", denials)
+	}
+}
+
+func TestRecoverHTTP(t *testing.T) {
+
+	log := &AuditLog{}
+	a1, a2, l := setup(t, log)
+
+	s1 := httptest.NewServer(Handler(a1))
+	defer s1.Close()
+	s2 := httptest.NewServer(Handler(a2))
+	defer s2.Close()
+
+	d := &Decryptor{
+		Name:      "decryptor",
+		FamilyKey: familyKey,
+		Agents:    [2]ShareSource{&Client{URL: s1.URL}, &Client{URL: s2.URL}},
+		Log:       log,
+		Now:       clock,
+	}
+
+	k, err := d.Recover(context.Background(), l, warrant(unitID))
+	if err != nil || !bytes.Equal(k, sessionKey) {
+		t.Fatalf("escrow recover over http failed: got %x (%v) wanted %x\n", k, err, sessionKey)
+	}
+
+	expired := warrant(unitID)
+	expired.NotBefore = now.Add(time.Hour)
+	if _, err := d.Recover(context.Background(), l, expired); err != ErrWarrant {
+		t.Errorf("escrow over http released a share early: %v\n", err)
+	}
+
+	c := &Client{URL: s1.URL}
+	if _, err := c.RequestShare(context.Background(), warrant(unitID+1)); err != ErrNoShare {
+		t.Errorf("escrow over http: got %v wanted ErrNoShare\n", err)
+	}
+}
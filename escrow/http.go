@@ -0,0 +1,105 @@
+package escrow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SharePath is the path at which Handler serves share requests.
+const SharePath = "/share"
+
+type shareResponse struct {
+	Share []byte `json:"share"`
+}
+
+// Handler serves a's shares over HTTP.  Clients POST a JSON Warrant to
+// SharePath and receive the share in a JSON object.
+func Handler(a *Agent) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(SharePath, func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var w Warrant
+		if err := json.NewDecoder(r.Body).Decode(&w); err != nil {
+			http.Error(rw, "bad warrant: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		share, err := a.RequestShare(r.Context(), &w)
+		switch err {
+		case nil:
+		case ErrWarrant:
+			http.Error(rw, err.Error(), http.StatusForbidden)
+			return
+		case ErrNoShare:
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		default:
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(shareResponse{Share: share})
+	})
+
+	return mux
+}
+
+// Client is a ShareSource for an agent served by Handler.
+type Client struct {
+	// URL is the agent's base URL, such as "http://127.0.0.1:8001".
+	URL string
+
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// RequestShare asks the remote agent for its share of the unit in w.
+func (c *Client) RequestShare(ctx context.Context, w *Warrant) ([]byte, error) {
+	body, err := json.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+SharePath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden:
+		return nil, ErrWarrant
+	case http.StatusNotFound:
+		return nil, ErrNoShare
+	default:
+		return nil, fmt.Errorf("escrow: agent returned %s", resp.Status)
+	}
+
+	var sr shareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return nil, err
+	}
+
+	return sr.Share, nil
+}
@@ -0,0 +1,201 @@
+package fortezza
+
+import (
+	"crypto/cipher"
+	"io"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// Crypto types for SetMode.
+const (
+	CI_ENCRYPT_TYPE = 0
+	CI_DECRYPT_TYPE = 1
+)
+
+// Modes for SetMode.
+const (
+	CI_ECB64_MODE = 0
+	CI_CBC64_MODE = 1
+	CI_OFB64_MODE = 2
+	CI_CFB64_MODE = 3
+	CI_CFB32_MODE = 4
+	CI_CFB16_MODE = 5
+	CI_CFB8_MODE  = 6
+)
+
+// crypter holds the chaining state between Encrypt or Decrypt calls
+type crypter struct {
+	mode   cipher.BlockMode
+	stream cipher.Stream
+}
+
+func newCrypter(mode int, key, iv []byte, decrypt bool) *crypter {
+	// the key and mode were checked by SetKey and SetMode
+	b, _ := skipjack.New(key)
+
+	c := &crypter{}
+
+	switch mode {
+	case CI_ECB64_MODE:
+		if decrypt {
+			c.mode = skipjack.NewECBDecrypter(b)
+		} else {
+			c.mode = skipjack.NewECBEncrypter(b)
+		}
+	case CI_CBC64_MODE:
+		if decrypt {
+			c.mode = cipher.NewCBCDecrypter(b, iv)
+		} else {
+			c.mode = cipher.NewCBCEncrypter(b, iv)
+		}
+	case CI_OFB64_MODE:
+		c.stream, _ = skipjack.NewOFB(b, iv)
+	default:
+		bits := 64 >> (mode - CI_CFB64_MODE)
+		if decrypt {
+			c.stream, _ = skipjack.NewCFBDecrypter(b, iv, bits)
+		} else {
+			c.stream, _ = skipjack.NewCFBEncrypter(b, iv, bits)
+		}
+	}
+
+	return c
+}
+
+func (c *crypter) crypt(data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+
+	if c.stream != nil {
+		c.stream.XORKeyStream(out, data)
+		return out, nil
+	}
+
+	if len(data)%c.mode.BlockSize() != 0 {
+		return nil, CI_INV_SIZE
+	}
+	c.mode.CryptBlocks(out, data)
+
+	return out, nil
+}
+
+// SetMode is CI_SetMode.  It sets the mode used by later GenerateIV or
+// LoadIV calls for the given crypto type.  The default is CBC.
+func (c *Card) SetMode(cryptoType, mode int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return err
+	}
+	if mode < CI_ECB64_MODE || mode > CI_CFB8_MODE {
+		return CI_INV_MODE
+	}
+
+	switch cryptoType {
+	case CI_ENCRYPT_TYPE:
+		c.encryptMode = mode
+		c.encrypter = nil
+	case CI_DECRYPT_TYPE:
+		c.decryptMode = mode
+		c.decrypter = nil
+	default:
+		return CI_INV_TYPE
+	}
+
+	return nil
+}
+
+// SetKey is CI_SetKey.  It selects the register used for encryption and
+// decryption.  An IV must be generated or loaded afterwards.
+func (c *Card) SetKey(i int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return err
+	}
+	if _, err := c.loaded(i, false); err != nil {
+		return err
+	}
+
+	c.key = i
+	c.encrypter, c.decrypter = nil, nil
+
+	return nil
+}
+
+// GenerateIV is CI_GenerateIV.  It starts an encryption with the current
+// key and returns the IV to send to the recipient.
+func (c *Card) GenerateIV() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	if c.key == 0 {
+		return nil, CI_NO_KEY
+	}
+
+	iv := make([]byte, IVSize)
+	if _, err := io.ReadFull(c.rand(), iv); err != nil {
+		return nil, CI_EXEC_FAIL
+	}
+
+	c.encrypter = newCrypter(c.encryptMode, c.registers[c.key], iv[16:], false)
+
+	return iv, nil
+}
+
+// LoadIV is CI_LoadIV.  It starts a decryption with the current key and
+// an IV from GenerateIV.
+func (c *Card) LoadIV(iv []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return err
+	}
+	if c.key == 0 {
+		return CI_NO_KEY
+	}
+	if len(iv) != IVSize {
+		return CI_INV_SIZE
+	}
+
+	c.decrypter = newCrypter(c.decryptMode, c.registers[c.key], iv[16:], true)
+
+	return nil
+}
+
+// Encrypt is CI_Encrypt.  Successive calls continue the same chain.  In
+// ECB and CBC mode the input must be a multiple of 8 bytes.
+func (c *Card) Encrypt(plaintext []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	if c.encrypter == nil {
+		return nil, CI_NO_IV
+	}
+
+	return c.encrypter.crypt(plaintext)
+}
+
+// Decrypt is CI_Decrypt.
+func (c *Card) Decrypt(ciphertext []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	if c.decrypter == nil {
+		return nil, CI_NO_IV
+	}
+
+	return c.decrypter.crypt(ciphertext)
+}
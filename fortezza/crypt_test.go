@@ -0,0 +1,99 @@
+package fortezza
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+func TestEncrypt(t *testing.T) {
+
+	c := card(t)
+	c.GenerateMEK(1)
+
+	if _, err := c.GenerateIV(); err != CI_NO_KEY {
+		t.Errorf("fortezza generated an IV with no key: %v\n", err)
+	}
+	if err := c.SetKey(2); err != CI_NO_KEY {
+		t.Errorf("fortezza selected an empty register: %v\n", err)
+	}
+	if err := c.SetKey(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Encrypt(make([]byte, 8)); err != CI_NO_IV {
+		t.Errorf("fortezza encrypted with no IV: %v\n", err)
+	}
+
+	b, _ := skipjack.New(c.registers[1])
+
+	msg := make([]byte, 32)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+
+	for mode := CI_ECB64_MODE; mode <= CI_CFB8_MODE; mode++ {
+		c.SetMode(CI_ENCRYPT_TYPE, mode)
+		c.SetMode(CI_DECRYPT_TYPE, mode)
+
+		iv, err := c.GenerateIV()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// two calls continue one chain
+		ct1, _ := c.Encrypt(msg[:16])
+		ct2, _ := c.Encrypt(msg[16:])
+		ct := append(ct1, ct2...)
+
+		want := make([]byte, len(msg))
+		switch mode {
+		case CI_ECB64_MODE:
+			for i := 0; i < len(msg); i += 8 {
+				b.Encrypt(want[i:], msg[i:])
+			}
+		case CI_CBC64_MODE:
+			cipher.NewCBCEncrypter(b, iv[16:]).CryptBlocks(want, msg)
+		case CI_OFB64_MODE:
+			cipher.NewOFB(b, iv[16:]).XORKeyStream(want, msg)
+		default:
+			s, _ := skipjack.NewCFBEncrypter(b, iv[16:], 64>>(mode-CI_CFB64_MODE))
+			s.XORKeyStream(want, msg)
+		}
+
+		if !bytes.Equal(ct, want) {
+			t.Errorf("fortezza mode %d encrypt failed: got %x wanted %x\n", mode, ct, want)
+		}
+
+		if err := c.LoadIV(iv); err != nil {
+			t.Fatal(err)
+		}
+		if pt, err := c.Decrypt(ct); err != nil || !bytes.Equal(pt, msg) {
+			t.Errorf("fortezza mode %d decrypt failed: got %x wanted %x\n", mode, pt, msg)
+		}
+	}
+
+	c.SetMode(CI_ENCRYPT_TYPE, CI_CBC64_MODE)
+	c.GenerateIV()
+	if _, err := c.Encrypt(msg[:5]); err != CI_INV_SIZE {
+		t.Errorf("fortezza encrypted a partial block: %v\n", err)
+	}
+
+	if err := c.SetMode(CI_ENCRYPT_TYPE, 7); err != CI_INV_MODE {
+		t.Errorf("fortezza accepted mode 7: %v\n", err)
+	}
+	if err := c.SetMode(2, CI_CBC64_MODE); err != CI_INV_TYPE {
+		t.Errorf("fortezza accepted crypto type 2: %v\n", err)
+	}
+	if err := c.LoadIV(make([]byte, 8)); err != CI_INV_SIZE {
+		t.Errorf("fortezza loaded an 8-byte IV: %v\n", err)
+	}
+
+	// replacing the key ends the operation
+	c.GenerateIV()
+	c.GenerateMEK(1)
+	if _, err := c.Encrypt(msg); err != CI_NO_IV {
+		t.Errorf("fortezza encrypted after the key changed: %v\n", err)
+	}
+}
@@ -0,0 +1,317 @@
+// Package fortezza emulates a FORTEZZA card as seen through the
+// Cryptologic Interface (CI) library: key registers, personalities, KEA
+// key agreement and SKIPJACK encryption.
+/*
+
+   References:
+   "FORTEZZA Cryptologic Interface Programmers Guide", NSA, 1996
+   http://csrc.nist.gov/groups/ST/toolkit/documents/skipjack/skipjack.pdf
+
+   Each method emulates the CI_ function of the same name, takes the same
+   arguments apart from buffer sizes, and returns the CI return value as
+   an Error, or nil for CI_OK.  The card must be unlocked with CheckPIN
+   before anything else.
+
+   The card has NumRegisters key registers.  Register 0 holds the storage
+   key Ks, which is generated with the card and never leaves it; keys
+   wrapped under register 0 can only be unwrapped by the same card.
+   Personalities live in NumCertificates certificate slots.  Slot 0 is
+   reserved for the root (PAA) certificate and has no private key.
+
+   Keys are wrapped with the module's own 12-byte wrap, since the card's
+   wrap80 algorithm is not public, so a CI_KEY from a real card cannot be
+   unwrapped here or the other way round.
+
+   The emulation covers the KEA and SKIPJACK functions.  DSA signing, the
+   card's LEAF and the first 16 bytes of the 24-byte IV, which are random
+   here and ignored by LoadIV, are not emulated, and there is no SSO PIN.
+
+*/
+package fortezza
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Phraxos/go-skipjack/internal/keywrap"
+	"github.com/Phraxos/go-skipjack/kea"
+)
+
+// Sizes of the CI data types.
+const (
+	IVSize          = 24   // CI_IV
+	WrappedKeySize  = 12   // CI_KEY
+	RandomSize      = 20   // CI_RANDOM
+	RSize           = 128  // CI_RA and CI_RB
+	YSize           = 128  // CI_Y
+	CertificateSize = 2048 // CI_CERTIFICATE
+	LabelSize       = 36   // CI_CERT_STR
+)
+
+// The card's resources.
+const (
+	NumRegisters    = 10
+	NumCertificates = 100
+)
+
+// Error is a CI return value.  The numbers are those of the CI library
+// header.
+type Error int
+
+// Return values.
+const (
+	CI_FAIL           Error = 1
+	CI_CHECKWORD_FAIL Error = 2
+	CI_INV_TYPE       Error = 3
+	CI_INV_MODE       Error = 4
+	CI_INV_KEY_INDEX  Error = 5
+	CI_INV_CERT_INDEX Error = 6
+	CI_INV_SIZE       Error = 7
+	CI_INV_STATE      Error = 9
+	CI_EXEC_FAIL      Error = 10
+	CI_NO_KEY         Error = 11
+	CI_NO_IV          Error = 12
+	CI_NO_X           Error = 13
+)
+
+var errorNames = map[Error]string{
+	CI_FAIL:           "CI_FAIL",
+	CI_CHECKWORD_FAIL: "CI_CHECKWORD_FAIL",
+	CI_INV_TYPE:       "CI_INV_TYPE",
+	CI_INV_MODE:       "CI_INV_MODE",
+	CI_INV_KEY_INDEX:  "CI_INV_KEY_INDEX",
+	CI_INV_CERT_INDEX: "CI_INV_CERT_INDEX",
+	CI_INV_SIZE:       "CI_INV_SIZE",
+	CI_INV_STATE:      "CI_INV_STATE",
+	CI_EXEC_FAIL:      "CI_EXEC_FAIL",
+	CI_NO_KEY:         "CI_NO_KEY",
+	CI_NO_IV:          "CI_NO_IV",
+	CI_NO_X:           "CI_NO_X",
+}
+
+func (e Error) Error() string {
+	if s, ok := errorNames[e]; ok {
+		return "fortezza: " + s
+	}
+	return fmt.Sprintf("fortezza: CI error %d", int(e))
+}
+
+// Card is an emulated FORTEZZA card.  It is safe for concurrent use, but
+// like the real card it has one set of registers and one encryption and
+// decryption state shared by all callers.
+type Card struct {
+	// Rand is the source of keys, IVs and random numbers.  If nil,
+	// crypto/rand is used.
+	Rand io.Reader
+
+	mu       sync.Mutex
+	pin      []byte
+	unlocked bool
+
+	registers [NumRegisters][]byte
+	slots     [NumCertificates]slot
+
+	// the personality chosen by SelectPersonality, or 0 for none
+	selected int
+
+	// the ephemeral key from the last GenerateRa
+	ephemeral *kea.PrivateKey
+
+	// the register chosen by SetKey, or 0 for none
+	key         int
+	encryptMode int
+	decryptMode int
+	encrypter   *crypter
+	decrypter   *crypter
+}
+
+// NewCard returns a card with the given user PIN, a fresh storage key and
+// no personalities.  If rand is nil, crypto/rand is used.
+func NewCard(pin []byte, rand io.Reader) (*Card, error) {
+	c := &Card{
+		Rand:        rand,
+		pin:         append([]byte(nil), pin...),
+		encryptMode: CI_CBC64_MODE,
+		decryptMode: CI_CBC64_MODE,
+	}
+
+	ks := make([]byte, kea.KeySize)
+	if _, err := io.ReadFull(c.rand(), ks); err != nil {
+		return nil, err
+	}
+	c.registers[0] = ks
+
+	return c, nil
+}
+
+func (c *Card) rand() io.Reader {
+	if c.Rand == nil {
+		return rand.Reader
+	}
+	return c.Rand
+}
+
+// CheckPIN is CI_CheckPIN.  It unlocks the card if pin is the user PIN.
+func (c *Card) CheckPIN(pin []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if subtle.ConstantTimeCompare(pin, c.pin) != 1 {
+		return CI_FAIL
+	}
+
+	c.unlocked = true
+
+	return nil
+}
+
+// ready is called with the lock held by every function but CheckPIN
+func (c *Card) ready() error {
+	if !c.unlocked {
+		return CI_INV_STATE
+	}
+	return nil
+}
+
+// GenerateRandom is CI_GenerateRandom.
+func (c *Card) GenerateRandom() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+
+	r := make([]byte, RandomSize)
+	if _, err := io.ReadFull(c.rand(), r); err != nil {
+		return nil, CI_EXEC_FAIL
+	}
+
+	return r, nil
+}
+
+// register checks a register index.  Register 0, the storage key, is only
+// allowed for wrapping.
+func register(i int, storage bool) error {
+	if i < 0 || i >= NumRegisters || (i == 0 && !storage) {
+		return CI_INV_KEY_INDEX
+	}
+	return nil
+}
+
+// loaded returns the key in register i
+func (c *Card) loaded(i int, storage bool) ([]byte, error) {
+	if err := register(i, storage); err != nil {
+		return nil, err
+	}
+	if c.registers[i] == nil {
+		return nil, CI_NO_KEY
+	}
+	return c.registers[i], nil
+}
+
+// setRegister loads a key into register i, discarding any encryption
+// state that used the old one
+func (c *Card) setRegister(i int, key []byte) {
+	c.registers[i] = key
+	if c.key == i {
+		c.key = 0
+		c.encrypter, c.decrypter = nil, nil
+	}
+}
+
+// GenerateMEK is CI_GenerateMEK.  It puts a random message encryption key
+// in register i.
+func (c *Card) GenerateMEK(i int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return err
+	}
+	if err := register(i, false); err != nil {
+		return err
+	}
+
+	key := make([]byte, kea.KeySize)
+	if _, err := io.ReadFull(c.rand(), key); err != nil {
+		return CI_EXEC_FAIL
+	}
+
+	c.setRegister(i, key)
+
+	return nil
+}
+
+// DeleteKey is CI_DeleteKey.
+func (c *Card) DeleteKey(i int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return err
+	}
+	if err := register(i, false); err != nil {
+		return err
+	}
+
+	c.setRegister(i, nil)
+
+	return nil
+}
+
+// WrapKey is CI_WrapKey.  It wraps the key in register keyIndex under the
+// key in register wrapIndex, which may be 0 for the storage key.
+func (c *Card) WrapKey(wrapIndex, keyIndex int) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+
+	kek, err := c.loaded(wrapIndex, true)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.loaded(keyIndex, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return keywrap.Wrap(kek, key)
+}
+
+// UnwrapKey is CI_UnwrapKey.  It unwraps a key wrapped under the key in
+// register unwrapIndex into register keyIndex.
+func (c *Card) UnwrapKey(unwrapIndex, keyIndex int, wrapped []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return err
+	}
+
+	kek, err := c.loaded(unwrapIndex, true)
+	if err != nil {
+		return err
+	}
+	if err := register(keyIndex, false); err != nil {
+		return err
+	}
+	if len(wrapped) != WrappedKeySize {
+		return CI_INV_SIZE
+	}
+
+	key, err := keywrap.Unwrap(kek, wrapped)
+	if err != nil {
+		return CI_CHECKWORD_FAIL
+	}
+
+	c.setRegister(keyIndex, key)
+
+	return nil
+}
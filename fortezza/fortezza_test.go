@@ -0,0 +1,88 @@
+package fortezza
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testPIN = []byte("12345678")
+
+func card(t *testing.T) *Card {
+	c, err := NewCard(testPIN, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CheckPIN(testPIN); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCheckPIN(t *testing.T) {
+
+	c, _ := NewCard(testPIN, nil)
+
+	if err := c.GenerateMEK(1); err != CI_INV_STATE {
+		t.Errorf("fortezza used a locked card: %v\n", err)
+	}
+	if err := c.CheckPIN([]byte("87654321")); err != CI_FAIL {
+		t.Errorf("fortezza accepted the wrong PIN: %v\n", err)
+	}
+	if err := c.CheckPIN(testPIN); err != nil {
+		t.Errorf("fortezza rejected the PIN: %v\n", err)
+	}
+	if err := c.GenerateMEK(1); err != nil {
+		t.Errorf("fortezza generate MEK failed: %v\n", err)
+	}
+}
+
+func TestWrapKey(t *testing.T) {
+
+	c := card(t)
+
+	if err := c.GenerateMEK(0); err != CI_INV_KEY_INDEX {
+		t.Errorf("fortezza overwrote the storage key: %v\n", err)
+	}
+	if err := c.GenerateMEK(NumRegisters); err != CI_INV_KEY_INDEX {
+		t.Errorf("fortezza used register %d: %v\n", NumRegisters, err)
+	}
+	if _, err := c.WrapKey(0, 1); err != CI_NO_KEY {
+		t.Errorf("fortezza wrapped an empty register: %v\n", err)
+	}
+
+	c.GenerateMEK(1)
+	c.GenerateMEK(2)
+
+	// save under the storage key and restore into another register
+	wrapped, err := c.WrapKey(0, 1)
+	if err != nil || len(wrapped) != WrappedKeySize {
+		t.Fatalf("fortezza wrap failed: %x (%v)\n", wrapped, err)
+	}
+	if err := c.UnwrapKey(0, 3, wrapped); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.registers[1], c.registers[3]) {
+		t.Errorf("fortezza unwrap failed: got %x wanted %x\n", c.registers[3], c.registers[1])
+	}
+
+	// the wrong key fails the checkword
+	if err := c.UnwrapKey(2, 3, wrapped); err != CI_CHECKWORD_FAIL {
+		t.Errorf("fortezza unwrapped under the wrong key: %v\n", err)
+	}
+
+	// the storage key is per card
+	if err := card(t).UnwrapKey(0, 1, wrapped); err != CI_CHECKWORD_FAIL {
+		t.Errorf("fortezza unwrapped another card's key: %v\n", err)
+	}
+
+	if err := c.DeleteKey(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.WrapKey(0, 1); err != CI_NO_KEY {
+		t.Errorf("fortezza wrapped a deleted key: %v\n", err)
+	}
+
+	if r, err := c.GenerateRandom(); err != nil || len(r) != RandomSize {
+		t.Errorf("fortezza generate random failed: %x (%v)\n", r, err)
+	}
+}
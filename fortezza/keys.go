@@ -0,0 +1,240 @@
+package fortezza
+
+import (
+	"crypto/subtle"
+	"math/big"
+
+	"github.com/Phraxos/go-skipjack/kea"
+)
+
+// Flags for GenerateTEK.
+const (
+	CI_INITIATOR_FLAG = 0
+	CI_RECIPIENT_FLAG = 1
+)
+
+// a certificate slot
+type slot struct {
+	label string
+	cert  []byte
+	key   *kea.PrivateKey
+}
+
+// Personality is CI_PERSON, an entry in the personality list.
+type Personality struct {
+	CertificateIndex int
+	Label            string
+}
+
+// value encodes a KEA public value as a CI_Y or CI_RA
+func value(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, YSize))
+}
+
+func certificateIndex(i int, root bool) error {
+	if i < 0 || i >= NumCertificates || (i == 0 && !root) {
+		return CI_INV_CERT_INDEX
+	}
+	return nil
+}
+
+// GenerateX is CI_GenerateX for KEA.  It generates a key pair over params
+// in certificate slot i and returns the public value Y.
+func (c *Card) GenerateX(i int, params *kea.Parameters) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	if err := certificateIndex(i, false); err != nil {
+		return nil, err
+	}
+
+	k, err := kea.GenerateKey(params, c.rand())
+	if err != nil {
+		return nil, CI_EXEC_FAIL
+	}
+
+	c.slots[i].key = k
+	if c.selected == i {
+		c.selected, c.ephemeral = 0, nil
+	}
+
+	return value(k.Y), nil
+}
+
+// LoadCertificate is CI_LoadCertificate.  It stores a certificate and its
+// label in slot i, which may be 0 for the root certificate.
+func (c *Card) LoadCertificate(i int, label string, cert []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return err
+	}
+	if err := certificateIndex(i, true); err != nil {
+		return err
+	}
+	if len(label) > LabelSize || len(cert) > CertificateSize {
+		return CI_INV_SIZE
+	}
+
+	c.slots[i].label = label
+	c.slots[i].cert = append([]byte(nil), cert...)
+
+	return nil
+}
+
+// DeleteCertificate is CI_DeleteCertificate.  It clears slot i, including
+// its private key.
+func (c *Card) DeleteCertificate(i int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return err
+	}
+	if err := certificateIndex(i, true); err != nil {
+		return err
+	}
+
+	c.slots[i] = slot{}
+	if c.selected == i {
+		c.selected, c.ephemeral = 0, nil
+	}
+
+	return nil
+}
+
+// GetCertificate is CI_GetCertificate.
+func (c *Card) GetCertificate(i int) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	if err := certificateIndex(i, true); err != nil {
+		return nil, err
+	}
+	if c.slots[i].cert == nil {
+		return nil, CI_FAIL
+	}
+
+	return append([]byte(nil), c.slots[i].cert...), nil
+}
+
+// GetPersonalityList is CI_GetPersonalityList.  It lists the slots holding
+// both a certificate and a private key.
+func (c *Card) GetPersonalityList() ([]Personality, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+
+	var list []Personality
+	for i := 1; i < NumCertificates; i++ {
+		if s := &c.slots[i]; s.cert != nil && s.key != nil {
+			list = append(list, Personality{CertificateIndex: i, Label: s.label})
+		}
+	}
+
+	return list, nil
+}
+
+// SelectPersonality is CI_SelectPersonality.  Key agreement uses the
+// private key in the selected slot.
+func (c *Card) SelectPersonality(i int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return err
+	}
+	if err := certificateIndex(i, false); err != nil {
+		return err
+	}
+	if c.slots[i].key == nil {
+		return CI_NO_X
+	}
+
+	c.selected, c.ephemeral = i, nil
+
+	return nil
+}
+
+// GenerateRa is CI_GenerateRa.  It generates an ephemeral key pair over the
+// selected personality's parameters and returns the public value R.
+func (c *Card) GenerateRa() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	if c.selected == 0 {
+		return nil, CI_NO_X
+	}
+
+	k, err := kea.GenerateKey(&c.slots[c.selected].key.Parameters, c.rand())
+	if err != nil {
+		return nil, CI_EXEC_FAIL
+	}
+
+	c.ephemeral = k
+
+	return value(k.Y), nil
+}
+
+// GenerateTEK is CI_GenerateTEK.  It agrees a token encryption key with
+// KEA and puts it in register i.  ra is the initiator's R and rb the
+// recipient's; flags says which of them came from this card's last
+// GenerateRa.  y is the other party's public key.
+func (c *Card) GenerateTEK(flags, i int, ra, rb, y []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ready(); err != nil {
+		return err
+	}
+	if err := register(i, false); err != nil {
+		return err
+	}
+	if c.selected == 0 || c.ephemeral == nil {
+		return CI_NO_X
+	}
+
+	var own, peer []byte
+	switch flags {
+	case CI_INITIATOR_FLAG:
+		own, peer = ra, rb
+	case CI_RECIPIENT_FLAG:
+		own, peer = rb, ra
+	default:
+		return CI_INV_TYPE
+	}
+
+	if len(ra) != RSize || len(rb) != RSize || len(y) != YSize {
+		return CI_INV_SIZE
+	}
+	if subtle.ConstantTimeCompare(own, value(c.ephemeral.Y)) != 1 {
+		return CI_FAIL
+	}
+
+	static := c.slots[c.selected].key
+
+	peerStatic := &kea.PublicKey{Parameters: static.Parameters, Y: new(big.Int).SetBytes(y)}
+	peerEphemeral := &kea.PublicKey{Parameters: static.Parameters, Y: new(big.Int).SetBytes(peer)}
+
+	tek, err := kea.Agree(static, c.ephemeral, peerStatic, peerEphemeral)
+	if err != nil {
+		return CI_EXEC_FAIL
+	}
+
+	c.setRegister(i, tek)
+
+	return nil
+}
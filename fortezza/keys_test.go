@@ -0,0 +1,143 @@
+package fortezza
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/Phraxos/go-skipjack/kea"
+)
+
+func fromHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("bad hex: " + s)
+	}
+	return n
+}
+
+var testParameters = kea.Parameters{
+	P: fromHex("a07377e4d4eae2231e2329aad6e0ad41015d12b4791fd3fb1ca22c4d3667be43d09c91917f4106b9843247182c6662a7db0f529a0a184a6b7f2b6f4e53e9c30471b5adeaed57f2f4d494f839978fe245a4a00a9a9e18e32f5ad8a66a9bd45a41b30fa9acda5dcad72df214bc64cf43ff5483721f2d5aa6b809da64e963863b7f"),
+	Q: fromHex("e9d6762f5173237c26b61ee6efa8a4df7cddc11b"),
+	G: fromHex("23afd9da2f7e1337006c5d32fcc28502263442bfbf07e967d0e9b8adce6f7f013986c5900a5dbc8daae7a3a02d6e06680bd476315c47f8d521c3e060879d93656405dddf19f800078ccf68cf798e493dba27775de1100179c0ab0c5144361a1b0ca438e3f2ac99b821308e03f3f723c2fa9bbe00201aa82f0c9ba90ab5969e78"),
+}
+
+// personalized returns an unlocked card with a KEA personality in slot 1,
+// and its public key
+func personalized(t *testing.T, label string) (*Card, []byte) {
+	c := card(t)
+
+	y, err := c.GenerateX(1, &testParameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadCertificate(1, label, []byte("certificate for "+label)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SelectPersonality(1); err != nil {
+		t.Fatal(err)
+	}
+
+	return c, y
+}
+
+func TestPersonalities(t *testing.T) {
+
+	c := card(t)
+
+	if err := c.SelectPersonality(1); err != CI_NO_X {
+		t.Errorf("fortezza selected an empty slot: %v\n", err)
+	}
+	if _, err := c.GenerateX(0, &testParameters); err != CI_INV_CERT_INDEX {
+		t.Errorf("fortezza generated a key in the root slot: %v\n", err)
+	}
+
+	c.LoadCertificate(0, "root", []byte("root certificate"))
+	c.GenerateX(5, &testParameters)
+	c.LoadCertificate(5, "KEAKalice", []byte("alice"))
+	c.LoadCertificate(7, "KEAKbob", []byte("bob"))
+
+	// slot 7 has no key, and slot 0 is never a personality
+	list, err := c.GetPersonalityList()
+	if err != nil || len(list) != 1 || list[0] != (Personality{5, "KEAKalice"}) {
+		t.Errorf("fortezza personality list failed: got %v (%v)\n", list, err)
+	}
+
+	if cert, err := c.GetCertificate(0); err != nil || string(cert) != "root certificate" {
+		t.Errorf("fortezza get certificate failed: got %q (%v)\n", cert, err)
+	}
+	if _, err := c.GetCertificate(NumCertificates); err != CI_INV_CERT_INDEX {
+		t.Errorf("fortezza read slot %d: %v\n", NumCertificates, err)
+	}
+	if err := c.LoadCertificate(1, "x", make([]byte, CertificateSize+1)); err != CI_INV_SIZE {
+		t.Errorf("fortezza loaded an oversized certificate: %v\n", err)
+	}
+
+	c.SelectPersonality(5)
+	c.DeleteCertificate(5)
+	if _, err := c.GenerateRa(); err != CI_NO_X {
+		t.Errorf("fortezza used a deleted personality: %v\n", err)
+	}
+}
+
+func TestGenerateTEK(t *testing.T) {
+
+	alice, ya := personalized(t, "alice")
+	bob, yb := personalized(t, "bob")
+
+	ra, err := alice.GenerateRa()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb, err := bob.GenerateRa()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alice.GenerateTEK(CI_INITIATOR_FLAG, 1, ra, rb, yb); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.GenerateTEK(CI_RECIPIENT_FLAG, 1, ra, rb, ya); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(alice.registers[1], bob.registers[1]) {
+		t.Errorf("fortezza TEKs differ: %x %x\n", alice.registers[1], bob.registers[1])
+	}
+
+	// alice sends a message key wrapped under the TEK
+	alice.GenerateMEK(2)
+	wrapped, err := alice.WrapKey(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.UnwrapKey(1, 2, wrapped); err != nil {
+		t.Fatal(err)
+	}
+
+	alice.SetKey(2)
+	iv, _ := alice.GenerateIV()
+	ct, _ := alice.Encrypt([]byte("attack at dawn!!"))
+
+	bob.SetKey(2)
+	bob.LoadIV(iv)
+	if pt, err := bob.Decrypt(ct); err != nil || string(pt) != "attack at dawn!!" {
+		t.Errorf("fortezza message failed: got %q (%v)\n", pt, err)
+	}
+
+	// each card must name its own R
+	if err := bob.GenerateTEK(CI_INITIATOR_FLAG, 1, ra, rb, ya); err != CI_FAIL {
+		t.Errorf("fortezza accepted another card's R: %v\n", err)
+	}
+	if err := bob.GenerateTEK(2, 1, ra, rb, ya); err != CI_INV_TYPE {
+		t.Errorf("fortezza accepted flags 2: %v\n", err)
+	}
+	if err := bob.GenerateTEK(CI_RECIPIENT_FLAG, 1, ra, rb, ya[1:]); err != CI_INV_SIZE {
+		t.Errorf("fortezza accepted a short Y: %v\n", err)
+	}
+
+	// an invalid public key is refused
+	if err := bob.GenerateTEK(CI_RECIPIENT_FLAG, 1, ra, rb, make([]byte, YSize)); err != CI_EXEC_FAIL {
+		t.Errorf("fortezza accepted Y = 0: %v\n", err)
+	}
+}
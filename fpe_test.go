@@ -0,0 +1,102 @@
+package skipjack
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFPEVectors(t *testing.T) {
+
+	// no published vectors exist; these guard against accidental changes
+	var tests = []struct {
+		n, x, y uint64
+	}{
+		{10000000000000000, 4111111111111111, 2707220924491173},
+		{0, 4111111111111111, 13882547305483406856},
+	}
+
+	for _, tt := range tests {
+		f, _ := NewFPE(unhex("00998877665544332211"), tt.n)
+		if y, err := f.Encrypt(tt.x, []byte("tweak")); err != nil || y != tt.y {
+			t.Errorf("fpe failed: got %d wanted %d (%v)\n", y, tt.y, err)
+		}
+	}
+}
+
+func TestFPEPermutation(t *testing.T) {
+
+	key := unhex("00998877665544332211")
+
+	for _, n := range []uint64{1, 2, 3, 10, 255, 256, 1000, 1 << 12} {
+		f, err := NewFPE(key, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen := make([]bool, n)
+		for x := uint64(0); x < n; x++ {
+			y, err := f.Encrypt(x, []byte("tweak"))
+			if err != nil || y >= n || seen[y] {
+				t.Fatalf("fpe permutation of [0, %d) failed at %d: got %d (%v)\n", n, x, y, err)
+			}
+			seen[y] = true
+
+			if got, _ := f.Decrypt(y, []byte("tweak")); got != x {
+				t.Errorf("fpe decrypt failed: got %d wanted %d\n", got, x)
+			}
+		}
+	}
+}
+
+func TestFPE(t *testing.T) {
+
+	key := unhex("00998877665544332211")
+
+	for _, n := range []uint64{0, 1 << 63, 1<<63 + 1, 1<<64 - 1, 10000000000000000, 1 << 33} {
+		f, _ := NewFPE(key, n)
+
+		for i := 0; i < 200; i++ {
+			x := rand.Uint64()
+			if n != 0 {
+				x %= n
+			}
+
+			y, err := f.Encrypt(x, nil)
+			if err != nil || !f.inRange(y) {
+				t.Errorf("fpe encrypt failed: %d -> %d (%v)\n", x, y, err)
+			}
+			if got, _ := f.Decrypt(y, nil); got != x {
+				t.Errorf("fpe round trip failed: got %d wanted %d\n", got, x)
+			}
+		}
+	}
+
+	f, _ := NewFPE(key, 1000000)
+
+	// the tweak and the domain both select the permutation
+	same := 0
+	for x := uint64(0); x < 1000; x++ {
+		a, _ := f.Encrypt(x, []byte("a"))
+		b, _ := f.Encrypt(x, []byte("b"))
+		if a == b {
+			same++
+		}
+	}
+	if same > 5 {
+		t.Errorf("fpe tweaks agree on %d of 1000 inputs\n", same)
+	}
+
+	g, _ := NewFPE(key, 1000001)
+	a, _ := f.Encrypt(123456, nil)
+	b, _ := g.Encrypt(123456, nil)
+	if a == b {
+		t.Errorf("fpe domains agree: %d\n", a)
+	}
+
+	if _, err := f.Encrypt(1000000, nil); err != errFPERange {
+		t.Errorf("fpe accepted an input out of range: %v\n", err)
+	}
+	if _, err := f.Decrypt(1<<40, nil); err != errFPERange {
+		t.Errorf("fpe accepted an input out of range: %v\n", err)
+	}
+}
@@ -0,0 +1,324 @@
+package skipjack
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"unicode/utf8"
+)
+
+/*
+
+   Format-preserving encryption of strings.
+
+   A string over an alphabet of R characters is a number in radix R.  It
+   is cut into as few chunks as possible, of nearly equal length, each
+   small enough that R^length is at most 2^64, and each chunk is
+   encrypted with FPE over [0, R^length).  Two passes chain the chunks so
+   that every output character depends on every input character: the
+   first runs forwards with the previous chunk's ciphertext in the tweak,
+   the second backwards with the next chunk's.  A string that fits in one
+   chunk is simply encrypted twice.
+
+   The ciphertext has the same length and alphabet as the plaintext.
+   Short strings have small domains that can be enumerated; NIST SP
+   800-38G asks for at least a million possible values.
+
+   For card numbers and other strings ending in a Luhn check digit,
+   EncryptLuhn encrypts all but the check digit and recomputes it, so the
+   result passes the same validation.
+
+*/
+
+// Alphabet is the character set of a StringFPE.  The position of a
+// character is its digit value.
+type Alphabet struct {
+	chars []rune
+	index map[rune]int
+}
+
+// NewAlphabet returns the alphabet of the characters in chars, which must
+// be at least 2 distinct runes.
+func NewAlphabet(chars string) (*Alphabet, error) {
+	a := &Alphabet{index: make(map[rune]int)}
+
+	for _, c := range chars {
+		if _, ok := a.index[c]; ok || c == utf8.RuneError {
+			return nil, errors.New("skipjack: invalid FPE alphabet")
+		}
+		a.index[c] = len(a.chars)
+		a.chars = append(a.chars, c)
+	}
+
+	if len(a.chars) < 2 {
+		return nil, errors.New("skipjack: invalid FPE alphabet")
+	}
+
+	return a, nil
+}
+
+func mustAlphabet(chars string) *Alphabet {
+	a, err := NewAlphabet(chars)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Common alphabets.
+var (
+	Digits       = mustAlphabet("0123456789")
+	Alphanumeric = mustAlphabet("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz")
+)
+
+// Radix returns the number of characters in a.
+func (a *Alphabet) Radix() int { return len(a.chars) }
+
+var (
+	errFPEChar   = errors.New("skipjack: character not in FPE alphabet")
+	errFPEEmpty  = errors.New("skipjack: empty FPE string")
+	errLuhn      = errors.New("skipjack: invalid Luhn check digit")
+	errLuhnRadix = errors.New("skipjack: Luhn needs an alphabet of 10 characters")
+)
+
+// StringFPE encrypts strings over an alphabet, preserving their length
+// and character set.  It is safe for concurrent use.
+type StringFPE struct {
+	key      []byte
+	alphabet *Alphabet
+
+	// chunk is the most characters encrypted together
+	chunk int
+}
+
+// NewStringFPE returns a StringFPE for strings over a under the 10-byte
+// key.
+func NewStringFPE(key []byte, a *Alphabet) (*StringFPE, error) {
+	if klen := len(key); klen != 10 {
+		return nil, KeySizeError(klen)
+	}
+
+	// the largest chunk with R^chunk <= 2^64, p = R^chunk
+	r := uint64(a.Radix())
+	chunk := 0
+	for p := uint64(1); ; chunk++ {
+		hi, lo := bits.Mul64(p, r)
+		if hi != 0 {
+			if hi == 1 && lo == 0 {
+				chunk++
+			}
+			break
+		}
+		p = lo
+	}
+
+	return &StringFPE{key: append([]byte(nil), key...), alphabet: a, chunk: chunk}, nil
+}
+
+// digits returns the digit values of s
+func (f *StringFPE) digits(s string) ([]int, error) {
+	var d []int
+	for _, c := range s {
+		i, ok := f.alphabet.index[c]
+		if !ok {
+			return nil, errFPEChar
+		}
+		d = append(d, i)
+	}
+	if len(d) == 0 {
+		return nil, errFPEEmpty
+	}
+	return d, nil
+}
+
+func (f *StringFPE) format(d []int) string {
+	r := make([]rune, len(d))
+	for i, v := range d {
+		r[i] = f.alphabet.chars[v]
+	}
+	return string(r)
+}
+
+// Encrypt encrypts s under tweak.
+func (f *StringFPE) Encrypt(s string, tweak []byte) (string, error) {
+	d, err := f.digits(s)
+	if err != nil {
+		return "", err
+	}
+	if err := f.crypt(d, tweak, false); err != nil {
+		return "", err
+	}
+	return f.format(d), nil
+}
+
+// Decrypt decrypts s under tweak.
+func (f *StringFPE) Decrypt(s string, tweak []byte) (string, error) {
+	d, err := f.digits(s)
+	if err != nil {
+		return "", err
+	}
+	if err := f.crypt(d, tweak, true); err != nil {
+		return "", err
+	}
+	return f.format(d), nil
+}
+
+// chunks returns the lengths of the chunks of an n-character string
+func (f *StringFPE) chunks(n int) []int {
+	m := (n + f.chunk - 1) / f.chunk
+
+	sizes := make([]int, m)
+	for j := range sizes {
+		sizes[j] = n / m
+		if j < n%m {
+			sizes[j]++
+		}
+	}
+
+	return sizes
+}
+
+// crypt encrypts or decrypts the digits d in place
+func (f *StringFPE) crypt(d []int, tweak []byte, decrypt bool) error {
+	r := uint64(f.alphabet.Radix())
+	sizes := f.chunks(len(d))
+	m := len(sizes)
+
+	vals := make([]uint64, m)
+	fpes := make([]*FPE, m)
+
+	off := 0
+	for j, n := range sizes {
+		domain := uint64(1)
+		for _, v := range d[off : off+n] {
+			vals[j] = vals[j]*r + uint64(v)
+			domain *= r // wraps to 0 for 2^64
+		}
+		off += n
+
+		var err error
+		if fpes[j], err = NewFPE(f.key, domain); err != nil {
+			return err
+		}
+	}
+
+	passes := []int{0, 1}
+	if decrypt {
+		passes = []int{1, 0}
+	}
+
+	for _, p := range passes {
+		// pass 0 chains forwards from chunk j-1, pass 1 backwards from
+		// chunk j+1.  Decryption runs against the chain, so that the
+		// neighbor is still ciphertext.
+		step := 1
+		if p == 1 {
+			step = -1
+		}
+		if decrypt {
+			step = -step
+		}
+		start := 0
+		if step < 0 {
+			start = m - 1
+		}
+
+		for j := start; j >= 0 && j < m; j += step {
+			nb := j - 1
+			if p == 1 {
+				nb = j + 1
+			}
+
+			t := make([]byte, 14, 14+len(tweak))
+			t[0] = byte(p)
+			binary.BigEndian.PutUint32(t[1:], uint32(j))
+			if nb >= 0 && nb < m {
+				t[5] = 1
+				binary.BigEndian.PutUint64(t[6:], vals[nb])
+			}
+			t = append(t, tweak...)
+
+			var err error
+			if decrypt {
+				vals[j], err = fpes[j].Decrypt(vals[j], t)
+			} else {
+				vals[j], err = fpes[j].Encrypt(vals[j], t)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	off = len(d)
+	for j := m - 1; j >= 0; j-- {
+		for i := 0; i < sizes[j]; i++ {
+			off--
+			d[off] = int(vals[j] % r)
+			vals[j] /= r
+		}
+	}
+
+	return nil
+}
+
+// luhnSum returns the Luhn sum of d, doubling from the rightmost digit if
+// double is set, or from the one before it otherwise
+func luhnSum(d []int, double bool) int {
+	sum := 0
+	for i := len(d) - 1; i >= 0; i-- {
+		v := d[i]
+		if double {
+			if v *= 2; v > 9 {
+				v -= 9
+			}
+		}
+		sum += v
+		double = !double
+	}
+	return sum
+}
+
+// ValidLuhn reports whether the decimal string s ends in a correct Luhn
+// check digit.
+func ValidLuhn(s string) bool {
+	f := &StringFPE{alphabet: Digits}
+	d, err := f.digits(s)
+	return err == nil && len(d) >= 2 && luhnSum(d, false)%10 == 0
+}
+
+// luhn encrypts or decrypts all but the check digit of s and replaces it
+func (f *StringFPE) luhn(s string, tweak []byte, decrypt bool) (string, error) {
+	if f.alphabet.Radix() != 10 {
+		return "", errLuhnRadix
+	}
+
+	d, err := f.digits(s)
+	if err != nil {
+		return "", err
+	}
+	if len(d) < 2 || luhnSum(d, false)%10 != 0 {
+		return "", errLuhn
+	}
+
+	n := len(d) - 1
+	if err := f.crypt(d[:n], tweak, decrypt); err != nil {
+		return "", err
+	}
+	d[n] = (10 - luhnSum(d[:n], true)%10) % 10
+
+	return f.format(d), nil
+}
+
+// EncryptLuhn encrypts s, whose last character must be a correct Luhn
+// check digit, and returns a string with a correct check digit.  The
+// digit values are the positions in the alphabet, which must have 10
+// characters.
+func (f *StringFPE) EncryptLuhn(s string, tweak []byte) (string, error) {
+	return f.luhn(s, tweak, false)
+}
+
+// DecryptLuhn decrypts s encrypted with EncryptLuhn.
+func (f *StringFPE) DecryptLuhn(s string, tweak []byte) (string, error) {
+	return f.luhn(s, tweak, true)
+}
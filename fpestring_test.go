@@ -0,0 +1,141 @@
+package skipjack
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func randomString(a *Alphabet, n int) string {
+	r := make([]rune, n)
+	for i := range r {
+		r[i] = a.chars[rand.Intn(a.Radix())]
+	}
+	return string(r)
+}
+
+func TestStringFPE(t *testing.T) {
+
+	key := unhex("00998877665544332211")
+
+	greek, err := NewAlphabet("αβγδεζηθ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, _ := NewAlphabet("01")
+	hex, _ := NewAlphabet("0123456789abcdef")
+
+	for _, a := range []*Alphabet{Digits, Alphanumeric, greek, binary, hex} {
+		f, err := NewStringFPE(key, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, n := range []int{1, 2, 6, 16, 19, 20, 40, 65, 200} {
+			s := randomString(a, n)
+
+			c, err := f.Encrypt(s, []byte("tweak"))
+			if err != nil || utf8.RuneCountInString(c) != n {
+				t.Fatalf("string fpe encrypt failed: %q -> %q (%v)\n", s, c, err)
+			}
+			for _, r := range c {
+				if _, ok := a.index[r]; !ok {
+					t.Errorf("string fpe left the alphabet: %q\n", c)
+				}
+			}
+
+			if got, err := f.Decrypt(c, []byte("tweak")); err != nil || got != s {
+				t.Errorf("string fpe round trip failed: got %q wanted %q (%v)\n", got, s, err)
+			}
+		}
+	}
+}
+
+func TestStringFPEChunks(t *testing.T) {
+
+	key := unhex("00998877665544332211")
+
+	var tests = []struct {
+		a     *Alphabet
+		chunk int
+	}{
+		{Digits, 19},
+		{Alphanumeric, 10},
+		{mustAlphabet("01"), 64},
+		{mustAlphabet("0123456789abcdef"), 16},
+	}
+
+	for _, tt := range tests {
+		f, _ := NewStringFPE(key, tt.a)
+		if f.chunk != tt.chunk {
+			t.Errorf("string fpe chunk failed: got %d wanted %d\n", f.chunk, tt.chunk)
+		}
+	}
+
+	f, _ := NewStringFPE(key, Digits)
+
+	// a change in the first chunk reaches the last one, and the reverse
+	s := strings.Repeat("0", 60)
+	c1, _ := f.Encrypt(s, nil)
+	c2, _ := f.Encrypt("1"+s[1:], nil)
+	c3, _ := f.Encrypt(s[:59]+"1", nil)
+
+	if c1[45:] == c2[45:] || c1[:15] == c3[:15] {
+		t.Errorf("string fpe chunks are not chained: %s %s %s\n", c1, c2, c3)
+	}
+}
+
+func TestStringFPEErrors(t *testing.T) {
+
+	f, _ := NewStringFPE(unhex("00998877665544332211"), Digits)
+
+	if _, err := f.Encrypt("4111-1111", nil); err != errFPEChar {
+		t.Errorf("string fpe accepted a character outside the alphabet: %v\n", err)
+	}
+	if _, err := f.Encrypt("", nil); err != errFPEEmpty {
+		t.Errorf("string fpe accepted an empty string: %v\n", err)
+	}
+
+	for _, chars := range []string{"", "a", "abca"} {
+		if _, err := NewAlphabet(chars); err == nil {
+			t.Errorf("alphabet %q accepted\n", chars)
+		}
+	}
+}
+
+func TestLuhn(t *testing.T) {
+
+	for _, s := range []string{"4111111111111111", "79927398713", "5555555555554444", "00"} {
+		if !ValidLuhn(s) {
+			t.Errorf("luhn rejected %s\n", s)
+		}
+	}
+	for _, s := range []string{"4111111111111112", "79927398710", "0", "", "4111x"} {
+		if ValidLuhn(s) {
+			t.Errorf("luhn accepted %s\n", s)
+		}
+	}
+
+	f, _ := NewStringFPE(unhex("00998877665544332211"), Digits)
+
+	for _, s := range []string{"4111111111111111", "79927398713", "5555555555554444", "378282246310005"} {
+		c, err := f.EncryptLuhn(s, []byte("tweak"))
+		if err != nil || len(c) != len(s) || !ValidLuhn(c) || c == s {
+			t.Errorf("luhn fpe encrypt failed: %s -> %s (%v)\n", s, c, err)
+		}
+
+		if got, err := f.DecryptLuhn(c, []byte("tweak")); err != nil || got != s {
+			t.Errorf("luhn fpe round trip failed: got %s wanted %s (%v)\n", got, s, err)
+		}
+	}
+
+	if _, err := f.EncryptLuhn("4111111111111112", nil); err != errLuhn {
+		t.Errorf("luhn fpe accepted a bad check digit: %v\n", err)
+	}
+
+	g, _ := NewStringFPE(unhex("00998877665544332211"), Alphanumeric)
+	if _, err := g.EncryptLuhn("4111111111111111", nil); err != errLuhnRadix {
+		t.Errorf("luhn fpe accepted a 62-character alphabet: %v\n", err)
+	}
+}
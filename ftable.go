@@ -0,0 +1,122 @@
+package skipjack
+
+import (
+	"crypto/cipher"
+	"errors"
+	"math/bits"
+)
+
+/*
+
+   F-table variants, for studying how SKIPJACK depends on its S-box.
+
+   The F-table must be a permutation of the bytes.  G is a four-round
+   Feistel network and would be invertible with any table, but the
+   published table is a bijection and the analyses of SKIPJACK assume one.
+
+   Two measures compare tables, from:
+   E. Biham and A. Shamir, "Differential Cryptanalysis of DES-like
+   Cryptosystems", CRYPTO 1990
+   M. Matsui, "Linear Cryptanalysis Method for DES Cipher", EUROCRYPT 1993
+
+   The difference distribution table counts, for each input difference a
+   and output difference b, the inputs x with F(x) ^ F(x^a) = b.  The
+   linear approximation table counts, for each input mask a and output
+   mask b, the inputs x with a.x = b.F(x), less 128.  Lower maxima over
+   nonzero a and b mean a stronger table.  The table in New gives 12 and
+   28; the AES S-box, for comparison, gives 4 and 16.
+
+*/
+
+// FTableStats are the DDT and LAT maxima of an F-table.
+type FTableStats struct {
+	// MaxDifferential is the largest DDT entry with a nonzero input
+	// difference.
+	MaxDifferential int
+
+	// MaxLinear is the largest absolute LAT entry with nonzero masks.
+	MaxLinear int
+}
+
+var errFTable = errors.New("skipjack: F-table is not a permutation of 256 bytes")
+
+func checkFTable(table []byte) (*[256]byte, error) {
+	if len(table) != 256 {
+		return nil, errFTable
+	}
+
+	var f [256]byte
+	var seen [256]bool
+
+	for i, v := range table {
+		if seen[v] {
+			return nil, errFTable
+		}
+		seen[v] = true
+		f[i] = v
+	}
+
+	return &f, nil
+}
+
+// FTable returns a copy of the SKIPJACK F-table.
+func FTable() []byte {
+	return append([]byte(nil), ftable[:]...)
+}
+
+// NewWithFTable creates a SKIPJACK variant using table, a permutation of
+// the 256 byte values, as its F-table.  The key argument must be 10 bytes.
+func NewWithFTable(key, table []byte) (cipher.Block, error) {
+	f, err := checkFTable(table)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	c := b.(*skipjackCipher)
+	c.f = f
+
+	return c, nil
+}
+
+// AnalyzeFTable returns the DDT and LAT maxima of table, which must be a
+// permutation of the 256 byte values.
+func AnalyzeFTable(table []byte) (*FTableStats, error) {
+	f, err := checkFTable(table)
+	if err != nil {
+		return nil, err
+	}
+
+	var s FTableStats
+
+	for a := 1; a < 256; a++ {
+		var row [256]int
+		for x := 0; x < 256; x++ {
+			row[f[x]^f[x^a]]++
+		}
+		for _, n := range row {
+			s.MaxDifferential = max(s.MaxDifferential, n)
+		}
+	}
+
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			n := -128
+			for x := 0; x < 256; x++ {
+				if bits.OnesCount8(byte(a&x)^f[x]&byte(b))%2 == 0 {
+					n++
+				}
+			}
+			if n < 0 {
+				n = -n
+			}
+			s.MaxLinear = max(s.MaxLinear, n)
+		}
+	}
+
+	return &s, nil
+}
@@ -0,0 +1,92 @@
+package skipjack
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAnalyzeFTable(t *testing.T) {
+
+	identity := make([]byte, 256)
+	for i := range identity {
+		identity[i] = byte(i)
+	}
+
+	var tests = []struct {
+		table []byte
+		want  FTableStats
+	}{
+		{FTable(), FTableStats{MaxDifferential: 12, MaxLinear: 28}},
+		{identity, FTableStats{MaxDifferential: 256, MaxLinear: 128}},
+	}
+
+	for _, tt := range tests {
+		s, err := AnalyzeFTable(tt.table)
+		if err != nil || *s != tt.want {
+			t.Errorf("analyze ftable failed: got %+v wanted %+v (%v)\n", s, tt.want, err)
+		}
+	}
+
+	bad := FTable()
+	bad[0] = bad[1]
+	if _, err := AnalyzeFTable(bad); err != errFTable {
+		t.Errorf("analyze ftable accepted a table that is not a permutation: %v\n", err)
+	}
+	if _, err := AnalyzeFTable(identity[:255]); err != errFTable {
+		t.Errorf("analyze ftable accepted a short table: %v\n", err)
+	}
+}
+
+func TestNewWithFTable(t *testing.T) {
+
+	key := unhex("00998877665544332211")
+	pt := unhex("33221100ddccbbaa")
+
+	// the published table gives SKIPJACK
+	c, err := NewWithFTable(key, FTable())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := make([]byte, 8)
+	c.Encrypt(ct, pt)
+	if want := unhex("2587cae27a12d300"); !bytes.Equal(ct, want) {
+		t.Errorf("ftable encrypt failed: got %x wanted %x\n", ct, want)
+	}
+
+	table := FTable()
+	for i := range table {
+		table[i] ^= 0x5a
+	}
+
+	v, err := NewWithFTable(key, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vt := make([]byte, 8)
+	v.Encrypt(vt, pt)
+	if bytes.Equal(vt, ct) {
+		t.Errorf("ftable variant encrypts like SKIPJACK\n")
+	}
+
+	v.Decrypt(vt, vt)
+	if !bytes.Equal(vt, pt) {
+		t.Errorf("ftable variant round trip failed: got %x wanted %x\n", vt, pt)
+	}
+
+	// the table is copied
+	table[0] ^= 1
+	v.Encrypt(vt, pt)
+	v.Decrypt(vt, vt)
+	if !bytes.Equal(vt, pt) {
+		t.Errorf("ftable variant uses the caller's table\n")
+	}
+
+	if _, err := NewWithFTable(key, table[:255]); err != errFTable {
+		t.Errorf("ftable accepted a short table: %v\n", err)
+	}
+	if _, err := NewWithFTable(key[:8], FTable()); err == nil {
+		t.Errorf("ftable accepted an 8-byte key\n")
+	}
+}
@@ -0,0 +1,5 @@
+module github.com/Phraxos/go-skipjack
+
+go 1.24.0
+
+require golang.org/x/crypto v0.47.0
@@ -0,0 +1,212 @@
+// Package ids turns integer IDs into short, opaque strings and back, for
+// exposing database IDs in URLs without revealing how many there are or in
+// what order they were made.
+/*
+
+   A 32-bit ID is encrypted with Skip32 and a 64-bit ID with SKIPJACK, both
+   keyed permutations, so every ID has exactly one string and the strings
+   of consecutive IDs are unrelated.  The ciphertext is written in base 32
+   or base 62 with a fixed number of digits, most significant first.
+
+   With Checksum set, a final check digit is appended, computed with the
+   Luhn mod N algorithm over the digits.  It catches every single mistyped
+   character and most transpositions of adjacent characters, and rejects
+   all but 1 in N made-up strings without a decryption.  It is not keyed
+   and does not authenticate the ID.
+
+   The same key is used for both widths.  The strings are not secret from
+   anyone who holds it.
+
+*/
+package ids
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// Encoding is a digit alphabet for encoded IDs.
+type Encoding struct {
+	alphabet string
+	decode   [256]byte
+}
+
+// invalid marks bytes outside the alphabet in Encoding.decode
+const invalid = 0xff
+
+func newEncoding(alphabet string, foldCase bool) *Encoding {
+	e := &Encoding{alphabet: alphabet}
+
+	for i := range e.decode {
+		e.decode[i] = invalid
+	}
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		e.decode[c] = byte(i)
+		if foldCase && 'a' <= c && c <= 'z' {
+			e.decode[c-'a'+'A'] = byte(i)
+		}
+	}
+
+	return e
+}
+
+// Encodings.  Base32 uses Douglas Crockford's alphabet, lower case, without
+// i, l, o or u; decoding ignores case.  Base62 uses digits, upper case and
+// lower case letters, and is case sensitive.
+var (
+	Base32 = newEncoding("0123456789abcdefghjkmnpqrstvwxyz", true)
+	Base62 = newEncoding("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz", false)
+)
+
+// width is the number of digits in the largest bits-bit value
+func (e *Encoding) width(bits int) int {
+	w := 0
+	for v := ^uint64(0) >> (64 - bits); v > 0; v /= uint64(len(e.alphabet)) {
+		w++
+	}
+	return w
+}
+
+var (
+	// ErrChecksum is returned when the check digit of a string is wrong.
+	ErrChecksum = errors.New("ids: checksum mismatch")
+
+	errSyntax = errors.New("ids: invalid ID string")
+)
+
+// Codec encodes and decodes IDs under one key.
+type Codec struct {
+	enc      *Encoding
+	checksum bool
+
+	skip32 *skipjack.Skip32
+	block  cipher.Block
+}
+
+// NewCodec returns a Codec for the 10-byte key writing IDs with enc, and
+// with a check digit if checksum is set.
+func NewCodec(key []byte, enc *Encoding, checksum bool) (*Codec, error) {
+	s, err := skipjack.NewSkip32(key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := skipjack.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Codec{enc: enc, checksum: checksum, skip32: s, block: b}, nil
+}
+
+// Encode32 returns the string for a 32-bit ID.
+func (c *Codec) Encode32(id uint32) string {
+	return c.format(uint64(c.skip32.Obfuscate(id)), 32)
+}
+
+// Decode32 returns the 32-bit ID encoded in s.
+func (c *Codec) Decode32(s string) (uint32, error) {
+	v, err := c.parse(s, 32)
+	if err != nil {
+		return 0, err
+	}
+	return c.skip32.Deobfuscate(uint32(v)), nil
+}
+
+// Encode64 returns the string for a 64-bit ID.
+func (c *Codec) Encode64(id uint64) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], id)
+	c.block.Encrypt(b[:], b[:])
+	return c.format(binary.BigEndian.Uint64(b[:]), 64)
+}
+
+// Decode64 returns the 64-bit ID encoded in s.
+func (c *Codec) Decode64(s string) (uint64, error) {
+	v, err := c.parse(s, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	c.block.Decrypt(b[:], b[:])
+
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+func (c *Codec) format(v uint64, bits int) string {
+	base := uint64(len(c.enc.alphabet))
+
+	digits := make([]byte, c.enc.width(bits))
+	for i := len(digits) - 1; i >= 0; i-- {
+		digits[i] = byte(v % base)
+		v /= base
+	}
+
+	if c.checksum {
+		digits = append(digits, luhn(digits, int(base)))
+	}
+
+	for i, d := range digits {
+		digits[i] = c.enc.alphabet[d]
+	}
+
+	return string(digits)
+}
+
+func (c *Codec) parse(s string, bits int) (uint64, error) {
+	w := c.enc.width(bits)
+	if c.checksum {
+		w++
+	}
+	if len(s) != w {
+		return 0, errSyntax
+	}
+
+	digits := make([]byte, len(s))
+	for i := 0; i < len(s); i++ {
+		if digits[i] = c.enc.decode[s[i]]; digits[i] == invalid {
+			return 0, errSyntax
+		}
+	}
+
+	base := uint64(len(c.enc.alphabet))
+
+	if c.checksum {
+		n := len(digits) - 1
+		if luhn(digits[:n], int(base)) != digits[n] {
+			return 0, ErrChecksum
+		}
+		digits = digits[:n]
+	}
+
+	// the digits can hold more than bits bits
+	max := ^uint64(0) >> (64 - bits)
+
+	var v uint64
+	for _, d := range digits {
+		if v > (max-uint64(d))/base {
+			return 0, errSyntax
+		}
+		v = v*base + uint64(d)
+	}
+
+	return v, nil
+}
+
+// luhn returns the Luhn mod N check digit for digits
+func luhn(digits []byte, base int) byte {
+	sum, factor := 0, 2
+
+	for i := len(digits) - 1; i >= 0; i-- {
+		a := factor * int(digits[i])
+		sum += a/base + a%base
+		factor = 3 - factor
+	}
+
+	return byte((base - sum%base) % base)
+}
@@ -0,0 +1,119 @@
+package ids
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+var testKey, _ = hex.DecodeString("00998877665544332211")
+
+func TestWidth(t *testing.T) {
+
+	var tests = []struct {
+		enc        *Encoding
+		bits, want int
+	}{
+		{Base32, 32, 7},
+		{Base32, 64, 13},
+		{Base62, 32, 6},
+		{Base62, 64, 11},
+	}
+
+	for _, tt := range tests {
+		if got := tt.enc.width(tt.bits); got != tt.want {
+			t.Errorf("width failed: got %d wanted %d\n", got, tt.want)
+		}
+	}
+}
+
+func TestCodec(t *testing.T) {
+
+	for _, enc := range []*Encoding{Base32, Base62} {
+		for _, checksum := range []bool{false, true} {
+			c, err := NewCodec(testKey, enc, checksum)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []uint64{0, 1, 2, 1<<32 - 1, 1<<64 - 1}
+			for i := 0; i < 200; i++ {
+				ids = append(ids, rand.Uint64())
+			}
+
+			for _, id := range ids {
+				s := c.Encode64(id)
+				if got, err := c.Decode64(s); err != nil || got != id {
+					t.Errorf("ids 64-bit round trip failed: %q got %d wanted %d (%v)\n", s, got, id, err)
+				}
+
+				s = c.Encode32(uint32(id))
+				if got, err := c.Decode32(s); err != nil || got != uint32(id) {
+					t.Errorf("ids 32-bit round trip failed: %q got %d wanted %d (%v)\n", s, got, uint32(id), err)
+				}
+			}
+		}
+	}
+
+	// a 32-bit ID is its Skip32 encryption in base 32
+	c, _ := NewCodec(testKey, Base32, false)
+	if got := c.Encode32(0x33221100); got != "20stqrz" {
+		t.Errorf("ids skip32 encoding failed: got %q wanted %q\n", got, "20stqrz")
+	}
+	if got, err := c.Decode32("20STQRZ"); err != nil || got != 0x33221100 {
+		t.Errorf("ids base32 upper case failed: got %08x (%v)\n", got, err)
+	}
+
+	// and a 64-bit ID its SKIPJACK encryption
+	b, _ := skipjack.New(testKey)
+	ct := make([]byte, 8)
+	b.Encrypt(ct, []byte{0, 0, 0, 0, 0x33, 0x22, 0x11, 0x00})
+
+	if got, want := c.Encode64(0x33221100), c.format(binary.BigEndian.Uint64(ct), 64); got != want {
+		t.Errorf("ids skipjack encoding failed: got %q wanted %q\n", got, want)
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+
+	c, _ := NewCodec(testKey, Base62, true)
+
+	s := c.Encode64(12345)
+
+	// every single substitution is caught by the check digit
+	for i := 0; i < len(s); i++ {
+		for j := 0; j < len(Base62.alphabet); j++ {
+			d := Base62.alphabet[j]
+			if d == s[i] {
+				continue
+			}
+			bad := s[:i] + string(d) + s[i+1:]
+			if _, err := c.Decode64(bad); err != ErrChecksum {
+				t.Errorf("ids accepted %q for %q: %v\n", bad, s, err)
+			}
+		}
+	}
+
+	for _, bad := range []string{"", s[1:], s + "0", strings.Replace(s, s[:1], "-", 1)} {
+		if _, err := c.Decode64(bad); err != errSyntax {
+			t.Errorf("ids accepted %q: %v\n", bad, err)
+		}
+	}
+
+	// 7 base 32 digits hold 35 bits
+	c, _ = NewCodec(testKey, Base32, false)
+	if _, err := c.Decode32("zzzzzzz"); err != errSyntax {
+		t.Errorf("ids accepted an out of range 32-bit ID: %v\n", err)
+	}
+	if _, err := c.Decode32("3zzzzzz"); err != nil {
+		t.Errorf("ids rejected the largest 32-bit value: %v\n", err)
+	}
+
+	if _, err := NewCodec(make([]byte, 8), Base32, false); err == nil {
+		t.Errorf("ids accepted an 8-byte key\n")
+	}
+}
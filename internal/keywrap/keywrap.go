@@ -0,0 +1,88 @@
+// Package keywrap is the 12-byte SKIPJACK key wrap shared by the fortezza
+// and ssl3 emulators.
+/*
+
+   FORTEZZA cards wrap one 80-bit key under another into 12 bytes with an
+   algorithm, wrap80, whose definition was never published.  The emulators
+   need some 12-byte wrap so that their own peers can exchange keys, and
+   use this one.  It is NOT wrap80 or PKCS #11 CKM_SKIPJACK_WRAP: keys
+   wrapped by real cards or tokens, or carried in captured traffic, cannot
+   be unwrapped with it, and it is kept internal so that nothing outside
+   the module mistakes it for them.
+
+   The wrapped key is the 80-bit key followed by a 16-bit checksum, the
+   exclusive-or of its five big-endian 16-bit words, enciphered under the
+   key-encryption key as two overlapping SKIPJACK blocks: bytes 0-7 and
+   then bytes 4-11 of the result.
+
+*/
+package keywrap
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// Size is the length of a wrapped key.
+const Size = 12
+
+var errUnwrap = errors.New("keywrap: key unwrap integrity check failed")
+
+// Wrap wraps the 10-byte SKIPJACK key under the 10-byte kek.
+func Wrap(kek, key []byte) ([]byte, error) {
+	if len(key) != 10 {
+		return nil, skipjack.KeySizeError(len(key))
+	}
+
+	b, err := skipjack.New(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	w := make([]byte, Size)
+	copy(w, key)
+	binary.BigEndian.PutUint16(w[10:], checksum(key))
+
+	b.Encrypt(w[0:8], w[0:8])
+	b.Encrypt(w[4:12], w[4:12])
+
+	return w, nil
+}
+
+// Unwrap reverses Wrap, returning an error if the checksum does not match.
+func Unwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) != Size {
+		return nil, errors.New("keywrap: invalid wrapped key length")
+	}
+
+	b, err := skipjack.New(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	w := make([]byte, Size)
+	copy(w, wrapped)
+
+	b.Decrypt(w[4:12], w[4:12])
+	b.Decrypt(w[0:8], w[0:8])
+
+	var sum [2]byte
+	binary.BigEndian.PutUint16(sum[:], checksum(w[:10]))
+
+	if subtle.ConstantTimeCompare(sum[:], w[10:]) != 1 {
+		return nil, errUnwrap
+	}
+
+	return w[:10], nil
+}
+
+func checksum(key []byte) uint16 {
+	var sum uint16
+	for i := 0; i < 10; i += 2 {
+		sum ^= binary.BigEndian.Uint16(key[i:])
+	}
+	return sum
+}
@@ -0,0 +1,59 @@
+package keywrap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// There is nothing to check Wrap against, so check that keys round trip
+// and that the layout and checksum behave as documented.
+func TestWrap(t *testing.T) {
+
+	kek := []byte{0x00, 0x99, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11}
+
+	for i := 0; i < 80; i++ {
+		key := make([]byte, 10)
+		key[i/8] = 0x80 >> (i % 8)
+
+		w, err := Wrap(kek, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(w) != Size {
+			t.Errorf("wrap key length: got %d wanted %d\n", len(w), Size)
+		}
+
+		k, err := Unwrap(kek, w)
+		if err != nil || !bytes.Equal(k, key) {
+			t.Errorf("unwrap key failed: got %#v (%v) wanted %#v\n", k, err, key)
+		}
+
+		for i := range w {
+			w[i] ^= 0x01
+			if _, err := Unwrap(kek, w); err == nil {
+				t.Errorf("unwrap key accepted a modification of byte %d\n", i)
+			}
+			w[i] ^= 0x01
+		}
+	}
+
+	// the wrap is deterministic: undo it by hand and check the layout
+	key := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a}
+	w, _ := Wrap(kek, key)
+
+	h, _ := skipjack.New(kek)
+	h.Decrypt(w[4:12], w[4:12])
+	h.Decrypt(w[0:8], w[0:8])
+
+	want := append(append([]byte{}, key...), 0x01^0x03^0x05^0x07^0x09, 0x02^0x04^0x06^0x08^0x0a)
+	if !bytes.Equal(w, want) {
+		t.Errorf("wrap key layout: got %#v wanted %#v\n", w, want)
+	}
+
+	if _, err := Wrap(kek, key[:8]); err == nil {
+		t.Errorf("wrap key accepted an 8-byte key\n")
+	}
+}
@@ -0,0 +1,92 @@
+package skipjack
+
+import (
+	"crypto/subtle"
+	"errors"
+)
+
+/*
+
+   Key check values let custodians confirm that a key was entered
+   correctly without revealing it.  The usual HSM convention, also used by
+   the PKCS #11 CKA_CHECK_VALUE attribute, is the first 3 bytes of the
+   encryption of an all-zero block.  The CMAC variant, used for AES in
+   ANSI X9.24-1, is the first 3 bytes of the CMAC of an all-zero block; it
+   does not expose a plaintext/ciphertext pair under the key.
+
+   Verification accepts check values truncated to between 2 and 8 bytes,
+   since some procedures record 2 or 4 bytes rather than 3.
+
+*/
+
+// KCVSize is the length of the check values returned by KCV and CMACKCV.
+const KCVSize = 3
+
+// ErrKCVMismatch is returned when a key does not match its check value.
+var ErrKCVMismatch = errors.New("skipjack: key check value mismatch")
+
+func kcvBlock(key []byte, useCMAC bool) ([]byte, error) {
+	b, err := New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	zero := make([]byte, b.BlockSize())
+
+	if useCMAC {
+		c, _ := newCMAC(b)
+		return c.sum(zero), nil
+	}
+
+	b.Encrypt(zero, zero)
+
+	return zero, nil
+}
+
+// KCV returns the check value of key: the first 3 bytes of the encryption
+// of the zero block.
+func KCV(key []byte) ([]byte, error) {
+	v, err := kcvBlock(key, false)
+	if err != nil {
+		return nil, err
+	}
+	return v[:KCVSize], nil
+}
+
+// CMACKCV returns the CMAC check value of key: the first 3 bytes of the
+// CMAC of the zero block.
+func CMACKCV(key []byte) ([]byte, error) {
+	v, err := kcvBlock(key, true)
+	if err != nil {
+		return nil, err
+	}
+	return v[:KCVSize], nil
+}
+
+func verifyKCV(key, kcv []byte, useCMAC bool) error {
+	if len(kcv) < 2 || len(kcv) > 8 {
+		return errors.New("skipjack: invalid key check value length")
+	}
+
+	v, err := kcvBlock(key, useCMAC)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(v[:len(kcv)], kcv) != 1 {
+		return ErrKCVMismatch
+	}
+
+	return nil
+}
+
+// VerifyKCV checks key against a check value from KCV, which may be
+// truncated to between 2 and 8 bytes.
+func VerifyKCV(key, kcv []byte) error {
+	return verifyKCV(key, kcv, false)
+}
+
+// VerifyCMACKCV checks key against a check value from CMACKCV.
+func VerifyCMACKCV(key, kcv []byte) error {
+	return verifyKCV(key, kcv, true)
+}
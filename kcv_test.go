@@ -0,0 +1,60 @@
+package skipjack
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKCV(t *testing.T) {
+
+	// the variable key validation vectors encrypt the zero block
+	for _, v := range skipjackVariableKeyValidation[:8] {
+		key, want := reverse(v.key), reverse(v.cipher)
+
+		kcv, err := KCV(key)
+		if err != nil || !bytes.Equal(kcv, want[:KCVSize]) {
+			t.Errorf("kcv failed: got %x wanted %x\n", kcv, want[:KCVSize])
+		}
+
+		if err := VerifyKCV(key, want[:4]); err != nil {
+			t.Errorf("kcv verify failed: %v\n", err)
+		}
+	}
+
+	key := unhex("00998877665544332211")
+
+	// the CMAC check value is the CMAC of one zero block
+	b, _ := New(key)
+	c, _ := newCMAC(b)
+	want := c.sum(make([]byte, 8))[:KCVSize]
+
+	kcv, _ := CMACKCV(key)
+	if !bytes.Equal(kcv, want) {
+		t.Errorf("cmac kcv failed: got %x wanted %x\n", kcv, want)
+	}
+	if plain, _ := KCV(key); bytes.Equal(plain, kcv) {
+		t.Errorf("cmac kcv equals the plain kcv\n")
+	}
+
+	if err := VerifyCMACKCV(key, kcv); err != nil {
+		t.Errorf("cmac kcv verify failed: %v\n", err)
+	}
+	if err := VerifyKCV(key, kcv); err != ErrKCVMismatch {
+		t.Errorf("kcv verify accepted the cmac kcv: %v\n", err)
+	}
+
+	key[9] ^= 1
+	if err := VerifyCMACKCV(key, kcv); err != ErrKCVMismatch {
+		t.Errorf("cmac kcv verify accepted the wrong key: %v\n", err)
+	}
+
+	for _, n := range []int{0, 1, 9} {
+		if err := VerifyKCV(key, make([]byte, n)); err == nil || err == ErrKCVMismatch {
+			t.Errorf("kcv verify accepted a %d-byte check value: %v\n", n, err)
+		}
+	}
+
+	if _, err := KCV(key[:8]); err == nil {
+		t.Errorf("kcv accepted an 8-byte key\n")
+	}
+}
@@ -0,0 +1,106 @@
+package skipjack
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+/*
+
+   Password-based key derivation, from:
+   RFC 8018, "PKCS #5: Password-Based Cryptography Specification Version 2.1"
+   http://tools.ietf.org/html/rfc8018
+   RFC 7914, "The scrypt Password-Based Key Derivation Function"
+   http://tools.ietf.org/html/rfc7914
+
+   PBKDF2 uses HMAC-SHA256 as its PRF.  Both functions are asked for the
+   10 bytes of a SKIPJACK key directly, so the key is a prefix of the
+   output a longer request would give.
+
+*/
+
+// KDF selects a password-based key derivation function.
+type KDF int
+
+// Key derivation functions.
+const (
+	PBKDF2 KDF = iota + 1 // PBKDF2 with HMAC-SHA256
+	Scrypt
+)
+
+// DefaultIterations is the PBKDF2 iteration count used when KDFParams is
+// nil.
+const DefaultIterations = 600000
+
+// Limits on KDFParams, which may come from untrusted input such as a
+// PBES2 AlgorithmIdentifier.  MaxIterations bounds the PBKDF2 iteration
+// count.  MaxScryptWork bounds 128·N·r·p: scrypt uses 128·N·r bytes of
+// memory and time proportional to N·r·p.  It allows N of 2^20 with r of 8
+// and p of 1.
+const (
+	MaxIterations = 16 * DefaultIterations
+	MaxScryptWork = 1 << 30
+)
+
+// KDFParams are the parameters of DeriveKey.
+type KDFParams struct {
+	KDF KDF
+
+	// Iterations is the PBKDF2 iteration count.
+	Iterations int
+
+	// N, R and P are the scrypt cost, block size and parallelization
+	// parameters.  N must be a power of two greater than 1.
+	N, R, P int
+}
+
+var (
+	errKDFParams = errors.New("skipjack: invalid key derivation parameters")
+	errKDFLimit  = errors.New("skipjack: key derivation parameters exceed limits")
+)
+
+// scryptWork returns whether 128·N·r·p is within MaxScryptWork
+func scryptWork(n, r, p int) bool {
+	w := uint64(128)
+	for _, v := range []int{n, r, p} {
+		if v <= 0 || w > MaxScryptWork/uint64(v) {
+			return false
+		}
+		w *= uint64(v)
+	}
+	return true
+}
+
+// DeriveKey derives a 10-byte key from password and salt.  If params is
+// nil, PBKDF2 with DefaultIterations is used.  Parameters above
+// MaxIterations or MaxScryptWork are rejected.
+func DeriveKey(password, salt []byte, params *KDFParams) ([]byte, error) {
+	if params == nil {
+		params = &KDFParams{KDF: PBKDF2, Iterations: DefaultIterations}
+	}
+
+	switch params.KDF {
+	case PBKDF2:
+		if params.Iterations <= 0 {
+			return nil, errKDFParams
+		}
+		if params.Iterations > MaxIterations {
+			return nil, errKDFLimit
+		}
+		return pbkdf2.Key(sha256.New, string(password), salt, params.Iterations, 10)
+	case Scrypt:
+		if params.N > 0 && params.R > 0 && params.P > 0 && !scryptWork(params.N, params.R, params.P) {
+			return nil, errKDFLimit
+		}
+		k, err := scrypt.Key(password, salt, params.N, params.R, params.P, 10)
+		if err != nil {
+			return nil, errKDFParams
+		}
+		return k, nil
+	}
+
+	return nil, errors.New("skipjack: unknown key derivation function")
+}
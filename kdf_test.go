@@ -0,0 +1,51 @@
+package skipjack
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+
+	// the keys are prefixes of the published longer outputs
+	var tests = []struct {
+		password, salt string
+		params         KDFParams
+		key            string
+	}{
+		// RFC 7914 section 11
+		{"password", "salt", KDFParams{KDF: PBKDF2, Iterations: 1}, "120fb6cffcf8b32c43e7"},
+		{"password", "salt", KDFParams{KDF: PBKDF2, Iterations: 2}, "ae4d0c95af6b46d32d0a"},
+		// RFC 7914 section 12
+		{"", "", KDFParams{KDF: Scrypt, N: 16, R: 1, P: 1}, "77d6576238657b203b19"},
+		{"password", "NaCl", KDFParams{KDF: Scrypt, N: 1024, R: 8, P: 16}, "fdbabe1c9d3472007856"},
+	}
+
+	for _, tt := range tests {
+		key, err := DeriveKey([]byte(tt.password), []byte(tt.salt), &tt.params)
+		if err != nil || !bytes.Equal(key, unhex(tt.key)) {
+			t.Errorf("derive key failed: got %x wanted %s (%v)\n", key, tt.key, err)
+		}
+	}
+
+	for _, p := range []KDFParams{
+		{KDF: PBKDF2},
+		{KDF: Scrypt, N: 15, R: 1, P: 1},
+		{KDF: 0, Iterations: 1},
+	} {
+		if _, err := DeriveKey([]byte("password"), []byte("salt"), &p); err == nil {
+			t.Errorf("derive key accepted %+v\n", p)
+		}
+	}
+
+	for _, p := range []KDFParams{
+		{KDF: PBKDF2, Iterations: MaxIterations + 1},
+		{KDF: Scrypt, N: 1 << 24, R: 8, P: 1},
+		{KDF: Scrypt, N: 1 << 20, R: 8, P: 2},
+		{KDF: Scrypt, N: 1 << 62, R: 1 << 62, P: 1},
+	} {
+		if _, err := DeriveKey([]byte("password"), []byte("salt"), &p); err != errKDFLimit {
+			t.Errorf("derive key accepted %+v: %v\n", p, err)
+		}
+	}
+}
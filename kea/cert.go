@@ -0,0 +1,295 @@
+package kea
+
+import (
+	"crypto/dsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+/*
+
+   Fortezza certificates carry KEA keys in one of two ways.
+
+   RFC 2528 certificates use id-keyExchangeAlgorithm with the raw value of Y
+   as the subject public key.  The parameters are either an explicit
+   Dss-Parms, a KEA-Parms-Id OCTET STRING naming a shared parameter set, or
+   absent, in which case they are inherited from the issuer.
+
+   Earlier MISSI certificates use the mosaic algorithm identifiers.  Their
+   combined KEA/DSS keys use the Kea-Dss-Parms parameters:
+
+      Kea-Dss-Parms ::= CHOICE {
+         differentParms [0] EXPLICIT SEQUENCE { Dss-Parms, Dss-Parms },
+         commonParms    [1] EXPLICIT Dss-Parms }
+
+   and a subject public key made of the KEA version, type (1), KMID,
+   clearance and privileges, the length-prefixed KEA key, and optionally the
+   DSS version, type (2), privileges and length-prefixed DSS key.  A missing
+   DSS part means the one key serves both purposes.  Clearance and privilege
+   strings run up to and including the first byte with the high bit clear.
+
+*/
+
+// Fortezza (MISSI) public key algorithm identifiers.
+var (
+	OIDMosaicKeyManagementAlgorithm = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 2, 1, 1, 10}
+	OIDMosaicKMandSigAlgorithm      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 2, 1, 1, 12}
+	OIDMosaicKMandUpdSigAlgorithms  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 2, 1, 1, 20}
+)
+
+var errUnsupportedCertificateKey = errors.New("kea: certificate does not hold a KEA key")
+
+// CertificateKeys are the keys extracted from a Fortezza certificate.
+type CertificateKeys struct {
+	// KEA is the key agreement key.
+	KEA *PublicKey
+
+	// DSS is the signature key of a combined KEA/DSS certificate, and nil
+	// otherwise.  When the certificate holds a single shared key it has
+	// the same value as KEA.
+	DSS *dsa.PublicKey
+
+	// KMID, Clearance and the privileges are only present in MISSI
+	// combined keys.
+	KMID          []byte
+	Clearance     []byte
+	KEAPrivileges []byte
+	DSSPrivileges []byte
+}
+
+// CertificateOptions resolve domain parameters that are not carried
+// explicitly in a certificate or SubjectPublicKeyInfo.
+type CertificateOptions struct {
+	// ParametersByID resolves a KEA-Parms-Id.
+	ParametersByID func(id []byte) (*Parameters, error)
+
+	// Inherited are used when the certificate omits the parameters;
+	// normally they come from the issuer's certificate.
+	Inherited *Parameters
+}
+
+type differentParms struct {
+	KEA dssParms
+	DSS dssParms
+}
+
+// ParseCertificateKeys extracts the KEA and, for combined certificates, DSS
+// public keys from cert.  opts may be nil if all certificates of interest
+// carry explicit parameters.
+func ParseCertificateKeys(cert *x509.Certificate, opts *CertificateOptions) (*CertificateKeys, error) {
+	if opts == nil {
+		opts = &CertificateOptions{}
+	}
+
+	var spki publicKeyInfo
+
+	rest, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errTrailingData
+	}
+
+	if spki.PublicKey.BitLength%8 != 0 {
+		return nil, errInvalidPublicKey
+	}
+
+	algo := spki.Algorithm.Algorithm
+	params := spki.Algorithm.Parameters
+
+	switch {
+	case algo.Equal(OIDKeyExchangeAlgorithm), algo.Equal(OIDMosaicKeyManagementAlgorithm):
+		p, err := keaParameters(params, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		pub, err := parsePublicValue(p, spki.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return &CertificateKeys{KEA: pub}, nil
+
+	case algo.Equal(OIDMosaicKMandSigAlgorithm), algo.Equal(OIDMosaicKMandUpdSigAlgorithms):
+		keaParams, dssParams, err := keaDSSParameters(params, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseMISSIKey(spki.PublicKey.Bytes, keaParams, dssParams)
+	}
+
+	return nil, errUnsupportedCertificateKey
+}
+
+// keaParameters resolves the parameters of an RFC 2528 KEA key
+func keaParameters(raw asn1.RawValue, opts *CertificateOptions) (*Parameters, error) {
+	switch {
+	case len(raw.FullBytes) == 0 || raw.Tag == asn1.TagNull && raw.Class == asn1.ClassUniversal:
+		return inherited(opts)
+
+	case raw.Tag == asn1.TagOctetString && raw.Class == asn1.ClassUniversal:
+		if opts.ParametersByID == nil {
+			return nil, errors.New("kea: key uses a KEA-Parms-Id but no lookup was given")
+		}
+
+		p, err := opts.ParametersByID(raw.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	return ParseParameters(raw.FullBytes)
+}
+
+// keaDSSParameters resolves Kea-Dss-Parms
+func keaDSSParameters(raw asn1.RawValue, opts *CertificateOptions) (keaParams, dssParams *Parameters, err error) {
+	if len(raw.FullBytes) == 0 || raw.Tag == asn1.TagNull && raw.Class == asn1.ClassUniversal {
+		p, err := inherited(opts)
+		return p, p, err
+	}
+
+	if raw.Class != asn1.ClassContextSpecific {
+		return nil, nil, errors.New("kea: invalid Kea-Dss-Parms")
+	}
+
+	switch raw.Tag {
+	case 0:
+		var d differentParms
+
+		if rest, err := asn1.Unmarshal(raw.Bytes, &d); err != nil {
+			return nil, nil, err
+		} else if len(rest) != 0 {
+			return nil, nil, errTrailingData
+		}
+
+		keaParams = &Parameters{P: d.KEA.P, Q: d.KEA.Q, G: d.KEA.G}
+		if err := keaParams.Validate(); err != nil {
+			return nil, nil, err
+		}
+
+		// DSS parameters follow FIPS 186 rather than the KEA sizes
+		if d.DSS.P == nil || d.DSS.Q == nil || d.DSS.G == nil || d.DSS.P.Sign() <= 0 {
+			return nil, nil, errors.New("kea: invalid DSS parameters")
+		}
+
+		dssParams = &Parameters{P: d.DSS.P, Q: d.DSS.Q, G: d.DSS.G}
+		return keaParams, dssParams, nil
+
+	case 1:
+		p, err := ParseParameters(raw.Bytes)
+		return p, p, err
+	}
+
+	return nil, nil, errors.New("kea: invalid Kea-Dss-Parms")
+}
+
+func inherited(opts *CertificateOptions) (*Parameters, error) {
+	if opts.Inherited == nil {
+		return nil, errors.New("kea: key inherits parameters but none were given")
+	}
+	if err := opts.Inherited.Validate(); err != nil {
+		return nil, err
+	}
+	return opts.Inherited, nil
+}
+
+// missiReader walks the MISSI raw key layout
+type missiReader struct {
+	b   []byte
+	err error
+}
+
+var errInvalidMISSIKey = errors.New("kea: invalid MISSI public key")
+
+func (r *missiReader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errInvalidMISSIKey
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// flags reads a string running up to the first byte with the high bit clear
+func (r *missiReader) flags() []byte {
+	for i, c := range r.b {
+		if c&0x80 == 0 {
+			return r.next(i + 1)
+		}
+	}
+	r.err = errInvalidMISSIKey
+	return nil
+}
+
+func (r *missiReader) key() []byte {
+	l := r.next(2)
+	if r.err != nil {
+		return nil
+	}
+	return r.next(int(l[0])<<8 | int(l[1]))
+}
+
+func parseMISSIKey(b []byte, keaParams, dssParams *Parameters) (*CertificateKeys, error) {
+	r := &missiReader{b: b}
+	k := &CertificateKeys{}
+
+	if hdr := r.next(2); r.err == nil && hdr[1] != 1 {
+		return nil, errInvalidMISSIKey
+	}
+
+	k.KMID = r.next(8)
+	k.Clearance = r.flags()
+	k.KEAPrivileges = r.flags()
+	keaKey := r.key()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	dssKey := keaKey
+	k.DSSPrivileges = k.KEAPrivileges
+
+	if len(r.b) != 0 {
+		if hdr := r.next(2); r.err == nil && hdr[1] != 2 {
+			return nil, errInvalidMISSIKey
+		}
+
+		k.DSSPrivileges = r.flags()
+		dssKey = r.key()
+
+		if r.err != nil {
+			return nil, r.err
+		}
+		if len(r.b) != 0 {
+			return nil, errTrailingData
+		}
+	}
+
+	kea, err := parsePublicValue(keaParams, asn1.BitString{Bytes: keaKey, BitLength: 8 * len(keaKey)})
+	if err != nil {
+		return nil, err
+	}
+	k.KEA = kea
+
+	y := new(big.Int).SetBytes(dssKey)
+	if y.Sign() <= 0 || y.Cmp(dssParams.P) >= 0 {
+		return nil, errInvalidPublicKey
+	}
+
+	k.DSS = &dsa.PublicKey{
+		Parameters: dsa.Parameters{P: dssParams.P, Q: dssParams.Q, G: dssParams.G},
+		Y:          y,
+	}
+
+	return k, nil
+}
@@ -0,0 +1,243 @@
+package kea
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var oidMosaicUpdatedSig = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 2, 1, 1, 19}
+
+type testValidity struct {
+	NotBefore, NotAfter time.Time
+}
+
+type testTBSCertificate struct {
+	Version            int `asn1:"explicit,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           testValidity
+	Subject            asn1.RawValue
+	PublicKey          publicKeyInfo
+}
+
+type testCertificate struct {
+	TBSCertificate     testTBSCertificate
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+// makeCertificate builds a Fortezza-style certificate around spki and runs it
+// through crypto/x509.  The signature is not valid; it is never checked.
+func makeCertificate(t *testing.T, spki publicKeyInfo) *x509.Certificate {
+	name, _ := asn1.Marshal(pkix.Name{CommonName: "fortezza"}.ToRDNSequence())
+	sigAlg := pkix.AlgorithmIdentifier{Algorithm: oidMosaicUpdatedSig}
+
+	der, err := asn1.Marshal(testCertificate{
+		TBSCertificate: testTBSCertificate{
+			Version:            2,
+			SerialNumber:       big.NewInt(1),
+			SignatureAlgorithm: sigAlg,
+			Issuer:             asn1.RawValue{FullBytes: name},
+			Validity:           testValidity{time.Date(1996, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)},
+			Subject:            asn1.RawValue{FullBytes: name},
+			PublicKey:          spki,
+		},
+		SignatureAlgorithm: sigAlg,
+		Signature:          asn1.BitString{Bytes: make([]byte, 40), BitLength: 320},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func rawParams(t *testing.T, v interface{}) asn1.RawValue {
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return asn1.RawValue{FullBytes: der}
+}
+
+func bits(b []byte) asn1.BitString {
+	return asn1.BitString{Bytes: b, BitLength: 8 * len(b)}
+}
+
+func TestParseCertificateKEA(t *testing.T) {
+
+	priv := generate(t)
+	y := priv.Y.FillBytes(make([]byte, 128))
+
+	testParms := dssParms{testParameters.P, testParameters.Q, testParameters.G}
+	parmsID := []byte{0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13}
+
+	opts := &CertificateOptions{
+		ParametersByID: func(id []byte) (*Parameters, error) {
+			if bytes.Equal(id, parmsID) {
+				return &testParameters, nil
+			}
+			return nil, errors.New("unknown parameters")
+		},
+		Inherited: &testParameters,
+	}
+
+	var tests = []struct {
+		name   string
+		algo   asn1.ObjectIdentifier
+		params asn1.RawValue
+	}{
+		{"explicit", OIDKeyExchangeAlgorithm, rawParams(t, testParms)},
+		{"parameter id", OIDKeyExchangeAlgorithm, rawParams(t, parmsID)},
+		{"inherited", OIDKeyExchangeAlgorithm, asn1.RawValue{}},
+		{"mosaic", OIDMosaicKeyManagementAlgorithm, rawParams(t, testParms)},
+	}
+
+	for _, v := range tests {
+		cert := makeCertificate(t, publicKeyInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: v.algo, Parameters: v.params},
+			PublicKey: bits(y),
+		})
+
+		if cert.PublicKeyAlgorithm != x509.UnknownPublicKeyAlgorithm {
+			t.Errorf("%s: crypto/x509 recognised the key algorithm\n", v.name)
+		}
+
+		k, err := ParseCertificateKeys(cert, opts)
+		if err != nil {
+			t.Errorf("%s: %v\n", v.name, err)
+			continue
+		}
+
+		if k.KEA.Y.Cmp(priv.Y) != 0 || !k.KEA.Parameters.equal(&testParameters) || k.DSS != nil {
+			t.Errorf("%s: wrong keys extracted\n", v.name)
+		}
+	}
+
+	cert := makeCertificate(t, publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: OIDKeyExchangeAlgorithm, Parameters: rawParams(t, []byte{1})},
+		PublicKey: bits(y),
+	})
+	if _, err := ParseCertificateKeys(cert, opts); err == nil {
+		t.Errorf("kea resolved an unknown parameter id\n")
+	}
+
+	cert = makeCertificate(t, publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: OIDKeyExchangeAlgorithm},
+		PublicKey: bits(y),
+	})
+	if _, err := ParseCertificateKeys(cert, nil); err == nil {
+		t.Errorf("kea parsed a certificate with no parameters and nothing to inherit\n")
+	}
+}
+
+// missiKey builds a MISSI combined public key
+func missiKey(kmid, keaKey, dssKey []byte) []byte {
+	var b []byte
+
+	b = append(b, 0x01, 0x01)
+	b = append(b, kmid...)
+	b = append(b, 0x81, 0x02)       // clearance
+	b = append(b, 0x83, 0x84, 0x05) // KEA privileges
+	b = append(b, byte(len(keaKey)>>8), byte(len(keaKey)))
+	b = append(b, keaKey...)
+
+	if dssKey != nil {
+		b = append(b, 0x01, 0x02)
+		b = append(b, 0x06) // DSS privileges
+		b = append(b, byte(len(dssKey)>>8), byte(len(dssKey)))
+		b = append(b, dssKey...)
+	}
+
+	return b
+}
+
+func TestParseCertificateKEADSS(t *testing.T) {
+
+	kea, dss := generate(t), generate(t)
+	keaY := kea.Y.FillBytes(make([]byte, 128))
+	dssY := dss.Y.FillBytes(make([]byte, 128))
+	kmid := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	testParms := dssParms{testParameters.P, testParameters.Q, testParameters.G}
+
+	// the DSS half of differentParms need not satisfy the KEA size rules
+	smallDSS := dssParms{big.NewInt(23), big.NewInt(11), big.NewInt(4)}
+
+	common := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: rawParams(t, testParms).FullBytes}
+	different := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: rawParams(t, differentParms{testParms, smallDSS}).FullBytes}
+
+	// separate keys, common parameters
+	cert := makeCertificate(t, publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: OIDMosaicKMandUpdSigAlgorithms, Parameters: rawParams(t, common)},
+		PublicKey: bits(missiKey(kmid, keaY, dssY)),
+	})
+
+	k, err := ParseCertificateKeys(cert, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if k.KEA.Y.Cmp(kea.Y) != 0 || k.DSS.Y.Cmp(dss.Y) != 0 || k.DSS.P.Cmp(testParameters.P) != 0 {
+		t.Errorf("kea/dss common parameters: wrong keys extracted\n")
+	}
+
+	if !bytes.Equal(k.KMID, kmid) || !bytes.Equal(k.Clearance, []byte{0x81, 0x02}) ||
+		!bytes.Equal(k.KEAPrivileges, []byte{0x83, 0x84, 0x05}) || !bytes.Equal(k.DSSPrivileges, []byte{0x06}) {
+		t.Errorf("kea/dss: wrong attributes extracted: %+v\n", k)
+	}
+
+	// separate keys, different parameters
+	cert = makeCertificate(t, publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: OIDMosaicKMandSigAlgorithm, Parameters: rawParams(t, different)},
+		PublicKey: bits(missiKey(kmid, keaY, []byte{2})),
+	})
+
+	k, err = ParseCertificateKeys(cert, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if k.KEA.Y.Cmp(kea.Y) != 0 || k.DSS.Y.Cmp(big.NewInt(2)) != 0 || k.DSS.P.Cmp(big.NewInt(23)) != 0 {
+		t.Errorf("kea/dss different parameters: wrong keys extracted\n")
+	}
+
+	// a single shared key, inherited parameters
+	cert = makeCertificate(t, publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: OIDMosaicKMandSigAlgorithm},
+		PublicKey: bits(missiKey(kmid, keaY, nil)),
+	})
+
+	k, err = ParseCertificateKeys(cert, &CertificateOptions{Inherited: &testParameters})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if k.KEA.Y.Cmp(kea.Y) != 0 || k.DSS.Y.Cmp(kea.Y) != 0 || !bytes.Equal(k.DSSPrivileges, k.KEAPrivileges) {
+		t.Errorf("kea/dss shared key: wrong keys extracted\n")
+	}
+
+	// truncated keys must be rejected
+	raw := missiKey(kmid, keaY, dssY)
+	for _, n := range []int{1, 5, 12, 20, len(raw) - 1} {
+		cert = makeCertificate(t, publicKeyInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: OIDMosaicKMandSigAlgorithm, Parameters: rawParams(t, common)},
+			PublicKey: bits(raw[:n]),
+		})
+		if _, err := ParseCertificateKeys(cert, nil); err == nil {
+			t.Errorf("kea/dss parsed a key truncated to %d bytes\n", n)
+		}
+	}
+}
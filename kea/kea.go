@@ -0,0 +1,214 @@
+// Package kea implements the Key Exchange Algorithm (KEA), the key agreement
+// half of the declassified Fortezza suite.  KEA produces 80-bit keys for use
+// with SKIPJACK.
+/*
+
+   References:
+   http://csrc.nist.gov/groups/ST/toolkit/documents/skipjack/skipjack.pdf
+
+*/
+package kea
+
+import (
+	"crypto/dsa"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// KeySize is the length in bytes of the keys produced by Agree.
+const KeySize = 10
+
+// pad is exclusive-or'd with the first 80 bits of the shared value to form
+// the SKIPJACK key used in key derivation.
+var pad = [KeySize]byte{0x72, 0xf1, 0xa8, 0x7e, 0x92, 0x82, 0x41, 0x98, 0xab, 0x0b}
+
+// Parameters are the KEA domain parameters: a 1024-bit prime P, a 160-bit
+// prime Q dividing P-1, and a generator G of the order-Q subgroup.
+type Parameters struct {
+	P, Q, G *big.Int
+}
+
+// PublicKey is a KEA public key, either a static key Y or an ephemeral key R.
+type PublicKey struct {
+	Parameters
+	Y *big.Int
+}
+
+// PrivateKey is a KEA private key, either a static key x or an ephemeral
+// key r.
+type PrivateKey struct {
+	PublicKey
+	X *big.Int
+}
+
+var (
+	errInvalidParameters = errors.New("kea: invalid domain parameters")
+	errInvalidPublicKey  = errors.New("kea: invalid public key")
+	errInvalidPrivateKey = errors.New("kea: invalid private key")
+	errParameterMismatch = errors.New("kea: keys use different domain parameters")
+	errZeroSharedValue   = errors.New("kea: shared value is zero")
+)
+
+var one = big.NewInt(1)
+
+// GenerateParameters puts a random, valid set of KEA domain parameters in
+// params.
+func GenerateParameters(params *Parameters, rand io.Reader) error {
+	var p dsa.Parameters
+	if err := dsa.GenerateParameters(&p, rand, dsa.L1024N160); err != nil {
+		return err
+	}
+
+	params.P, params.Q, params.G = p.P, p.Q, p.G
+
+	return nil
+}
+
+// Validate checks that the domain parameters have the sizes KEA requires and
+// that G generates a subgroup of order Q.
+func (params *Parameters) Validate() error {
+	p, q, g := params.P, params.Q, params.G
+
+	if p == nil || q == nil || g == nil || p.BitLen() != 1024 || q.BitLen() != 160 {
+		return errInvalidParameters
+	}
+
+	pm1 := new(big.Int).Sub(p, one)
+	if new(big.Int).Mod(pm1, q).Sign() != 0 {
+		return errInvalidParameters
+	}
+
+	if g.Cmp(one) <= 0 || g.Cmp(p) >= 0 || new(big.Int).Exp(g, q, p).Cmp(one) != 0 {
+		return errInvalidParameters
+	}
+
+	return nil
+}
+
+// equal reports whether o, which may be partly filled in, matches the
+// valid parameters params
+func (params *Parameters) equal(o *Parameters) bool {
+	if o.P == nil || o.Q == nil || o.G == nil {
+		return false
+	}
+	return params.P.Cmp(o.P) == 0 && params.Q.Cmp(o.Q) == 0 && params.G.Cmp(o.G) == 0
+}
+
+// Validate performs the KEA public key validity checks: 1 < Y < P and
+// Y^Q = 1 mod P.
+func (pub *PublicKey) Validate() error {
+	if pub.Y == nil || pub.P == nil || pub.Q == nil {
+		return errInvalidPublicKey
+	}
+
+	if pub.Y.Cmp(one) <= 0 || pub.Y.Cmp(pub.P) >= 0 {
+		return errInvalidPublicKey
+	}
+
+	if new(big.Int).Exp(pub.Y, pub.Q, pub.P).Cmp(one) != 0 {
+		return errInvalidPublicKey
+	}
+
+	return nil
+}
+
+// GenerateKey generates a static or ephemeral key pair over params.
+func GenerateKey(params *Parameters, rand io.Reader) (*PrivateKey, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	// x is uniform in [1, q-1]
+	b := make([]byte, params.Q.BitLen()/8+8)
+	if _, err := io.ReadFull(rand, b); err != nil {
+		return nil, err
+	}
+
+	x := new(big.Int).SetBytes(b)
+	x.Mod(x, new(big.Int).Sub(params.Q, one))
+	x.Add(x, one)
+
+	priv := &PrivateKey{X: x}
+	priv.Parameters = *params
+	priv.Y = new(big.Int).Exp(params.G, x, params.P)
+
+	return priv, nil
+}
+
+// Agree performs the KEA computation and returns the 80-bit SKIPJACK key.
+// static and ephemeral are this party's key pairs; peerStatic and
+// peerEphemeral are the other party's public keys.  The computation is
+// symmetric, so the initiator and responder call Agree in the same way.
+func Agree(static, ephemeral *PrivateKey, peerStatic, peerEphemeral *PublicKey) ([]byte, error) {
+	if static == nil || ephemeral == nil || static.X == nil || ephemeral.X == nil {
+		return nil, errInvalidPrivateKey
+	}
+	if peerStatic == nil || peerEphemeral == nil {
+		return nil, errInvalidPublicKey
+	}
+
+	params := &static.Parameters
+
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	for _, o := range []*Parameters{&ephemeral.Parameters, &peerStatic.Parameters, &peerEphemeral.Parameters} {
+		if !params.equal(o) {
+			return nil, errParameterMismatch
+		}
+	}
+
+	if err := peerStatic.Validate(); err != nil {
+		return nil, err
+	}
+	if err := peerEphemeral.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := params.P
+
+	// for the initiator A: tAB = YB^rA and tBA = RB^xA
+	tab := new(big.Int).Exp(peerStatic.Y, ephemeral.X, p)
+	tba := new(big.Int).Exp(peerEphemeral.Y, static.X, p)
+
+	w := tab.Add(tab, tba)
+	w.Mod(w, p)
+
+	if w.Sign() == 0 {
+		return nil, errZeroSharedValue
+	}
+
+	wb := make([]byte, (p.BitLen()+7)/8)
+	w.FillBytes(wb)
+
+	return deriveKey(wb[:KeySize], wb[KeySize:2*KeySize]), nil
+}
+
+// deriveKey computes the KEA key from v1, the 80 most significant bits of
+// the shared value, and v2, the next 80 bits.  v2 is encrypted with SKIPJACK
+// under the key v1 ^ pad: the first 64 bits are encrypted, the 16 most
+// significant bits of that result are exclusive-or'd into the last 16 bits,
+// and the last 64 bits are encrypted again.
+func deriveKey(v1, v2 []byte) []byte {
+	var t [KeySize]byte
+	for i := range t {
+		t[i] = v1[i] ^ pad[i]
+	}
+
+	// t is always 10 bytes
+	b, _ := skipjack.New(t[:])
+
+	k := make([]byte, KeySize)
+	copy(k, v2)
+
+	b.Encrypt(k[0:8], k[0:8])
+	k[8] ^= k[0]
+	k[9] ^= k[1]
+	b.Encrypt(k[2:10], k[2:10])
+
+	return k
+}
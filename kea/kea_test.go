@@ -0,0 +1,210 @@
+package kea
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+func fromHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("bad hex: " + s)
+	}
+	return n
+}
+
+var testParameters = Parameters{
+	P: fromHex("a07377e4d4eae2231e2329aad6e0ad41015d12b4791fd3fb1ca22c4d3667be43d09c91917f4106b9843247182c6662a7db0f529a0a184a6b7f2b6f4e53e9c30471b5adeaed57f2f4d494f839978fe245a4a00a9a9e18e32f5ad8a66a9bd45a41b30fa9acda5dcad72df214bc64cf43ff5483721f2d5aa6b809da64e963863b7f"),
+	Q: fromHex("e9d6762f5173237c26b61ee6efa8a4df7cddc11b"),
+	G: fromHex("23afd9da2f7e1337006c5d32fcc28502263442bfbf07e967d0e9b8adce6f7f013986c5900a5dbc8daae7a3a02d6e06680bd476315c47f8d521c3e060879d93656405dddf19f800078ccf68cf798e493dba27775de1100179c0ab0c5144361a1b0ca438e3f2ac99b821308e03f3f723c2fa9bbe00201aa82f0c9ba90ab5969e78"),
+}
+
+func generate(t *testing.T) *PrivateKey {
+	k, err := GenerateKey(&testParameters, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestAgree(t *testing.T) {
+
+	xa, ra := generate(t), generate(t)
+	xb, rb := generate(t), generate(t)
+
+	ka, err := Agree(xa, ra, &xb.PublicKey, &rb.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kb, err := Agree(xb, rb, &xa.PublicKey, &ra.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ka) != KeySize || !bytes.Equal(ka, kb) {
+		t.Errorf("kea agreement failed: initiator %x responder %x\n", ka, kb)
+	}
+
+	// check the computation by hand
+	p := testParameters.P
+	w := new(big.Int).Exp(xb.Y, ra.X, p)
+	w.Add(w, new(big.Int).Exp(rb.Y, xa.X, p))
+	w.Mod(w, p)
+	wb := w.FillBytes(make([]byte, 128))
+
+	if k := deriveKey(wb[:10], wb[10:20]); !bytes.Equal(k, ka) {
+		t.Errorf("kea key derivation failed: got %x wanted %x\n", ka, k)
+	}
+
+	// a different ephemeral key gives a different key
+	rc := generate(t)
+	if kc, _ := Agree(xa, rc, &xb.PublicKey, &rb.PublicKey); bytes.Equal(kc, ka) {
+		t.Errorf("kea key did not depend on the ephemeral key\n")
+	}
+
+	// store-and-forward use: the recipient's static key doubles as its
+	// ephemeral key
+	ka, _ = Agree(xa, ra, &xb.PublicKey, &xb.PublicKey)
+	kb, _ = Agree(xb, xb, &xa.PublicKey, &ra.PublicKey)
+	if !bytes.Equal(ka, kb) {
+		t.Errorf("kea store-and-forward agreement failed: %x %x\n", ka, kb)
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+
+	var v1, v2 [10]byte
+	for i := range v2 {
+		v1[i] = pad[i]
+		v2[i] = byte(i)
+	}
+
+	// v1 == pad gives the all-zero SKIPJACK key
+	h, _ := skipjack.New(make([]byte, 10))
+
+	want := append([]byte{}, v2[:]...)
+	h.Encrypt(want[0:8], want[0:8])
+	want[8] ^= want[0]
+	want[9] ^= want[1]
+	h.Encrypt(want[2:10], want[2:10])
+
+	if k := deriveKey(v1[:], v2[:]); !bytes.Equal(k, want) {
+		t.Errorf("kea key derivation failed: got %x wanted %x\n", k, want)
+	}
+}
+
+// Regression values, not the published NIST example.
+func TestKnownAnswer(t *testing.T) {
+
+	key := func(x string) *PrivateKey {
+		k := &PrivateKey{X: fromHex(x)}
+		k.Parameters = testParameters
+		k.Y = new(big.Int).Exp(testParameters.G, k.X, testParameters.P)
+		return k
+	}
+
+	xa := key("0123456789abcdef0123456789abcdef01234567")
+	ra := key("1111111111111111111111111111111111111111")
+	xb := key("2468ace02468ace02468ace02468ace02468ace0")
+	rb := key("76543210fedcba9876543210fedcba9876543210")
+
+	want := fromHex("ccc8c8d98365d41205cf").FillBytes(make([]byte, KeySize))
+
+	if k, err := Agree(xa, ra, &xb.PublicKey, &rb.PublicKey); err != nil || !bytes.Equal(k, want) {
+		t.Errorf("kea known answer failed: got %x wanted %x (%v)\n", k, want, err)
+	}
+	if k, err := Agree(xb, rb, &xa.PublicKey, &ra.PublicKey); err != nil || !bytes.Equal(k, want) {
+		t.Errorf("kea known answer failed for the responder: got %x wanted %x (%v)\n", k, want, err)
+	}
+
+	// v1 and v2 are the first 160 bits of w = (Yb^ra + Rb^xa) mod p
+	var tests = []struct {
+		v1, v2, key string
+	}{
+		{"73c08de5d2c3b7d0d855", "3ea521b5ce484ba9739d", "ccc8c8d98365d41205cf"},
+		{"00010203040506070809", "0a0b0c0d0e0f10111213", "fdacd8bf9f6e065aaa96"},
+	}
+
+	for _, tt := range tests {
+		v1 := fromHex(tt.v1).FillBytes(make([]byte, 10))
+		v2 := fromHex(tt.v2).FillBytes(make([]byte, 10))
+		want := fromHex(tt.key).FillBytes(make([]byte, KeySize))
+
+		if k := deriveKey(v1, v2); !bytes.Equal(k, want) {
+			t.Errorf("kea key derivation known answer failed: got %x wanted %x\n", k, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	if err := testParameters.Validate(); err != nil {
+		t.Fatalf("kea test parameters failed to validate: %v\n", err)
+	}
+
+	bad := testParameters
+	bad.G = big.NewInt(1)
+	if err := bad.Validate(); err == nil {
+		t.Errorf("kea accepted g = 1\n")
+	}
+
+	if _, err := GenerateKey(&bad, rand.Reader); err == nil {
+		t.Errorf("kea generated a key over invalid parameters\n")
+	}
+
+	xa, ra := generate(t), generate(t)
+	xb := generate(t)
+
+	var invalid = []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		new(big.Int).Sub(testParameters.P, big.NewInt(1)), // order 2
+		testParameters.P,
+		big.NewInt(2), // not in the order-q subgroup, with overwhelming probability
+	}
+
+	for _, y := range invalid {
+		pub := &PublicKey{Parameters: testParameters, Y: y}
+		if err := pub.Validate(); err == nil {
+			t.Errorf("kea accepted public key %x\n", y)
+		}
+		if _, err := Agree(xa, ra, &xb.PublicKey, pub); err == nil {
+			t.Errorf("kea agreed with ephemeral key %x\n", y)
+		}
+	}
+
+	other := *xb
+	other.Parameters = bad
+	if _, err := Agree(xa, ra, &other.PublicKey, &xb.PublicKey); err != errParameterMismatch {
+		t.Errorf("kea agreed across domain parameters: %v\n", err)
+	}
+
+	// partly filled in keys are errors, not panics
+	for _, pub := range []*PublicKey{
+		nil,
+		{},
+		{Parameters: Parameters{P: testParameters.P}, Y: xb.Y},
+		{Parameters: testParameters},
+	} {
+		if _, err := Agree(xa, ra, pub, &xb.PublicKey); err == nil {
+			t.Errorf("kea agreed with static key %+v\n", pub)
+		}
+		if _, err := Agree(xa, ra, &xb.PublicKey, pub); err == nil {
+			t.Errorf("kea agreed with ephemeral key %+v\n", pub)
+		}
+	}
+
+	for _, priv := range []*PrivateKey{nil, {}, {PublicKey: xa.PublicKey}} {
+		if _, err := Agree(priv, ra, &xb.PublicKey, &xb.PublicKey); err == nil {
+			t.Errorf("kea agreed with static private key %+v\n", priv)
+		}
+		if _, err := Agree(xa, priv, &xb.PublicKey, &xb.PublicKey); err == nil {
+			t.Errorf("kea agreed with ephemeral private key %+v\n", priv)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package kea
+
+import (
+	"encoding/pem"
+	"errors"
+	"io"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// PEM block types used by the PEM helpers.
+const (
+	ParametersPEMType = "KEA PARAMETERS"
+	PublicKeyPEMType  = "PUBLIC KEY"
+	PrivateKeyPEMType = "PRIVATE KEY"
+
+	EncryptedPrivateKeyPEMType = "ENCRYPTED PRIVATE KEY"
+)
+
+// MarshalParametersPEM returns params as a PEM "KEA PARAMETERS" block.
+func MarshalParametersPEM(params *Parameters) ([]byte, error) {
+	der, err := MarshalParameters(params)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: ParametersPEMType, Bytes: der}), nil
+}
+
+// ParseParametersPEM parses the first PEM block in data as domain parameters.
+func ParseParametersPEM(data []byte) (*Parameters, error) {
+	der, err := decodePEM(data, ParametersPEMType)
+	if err != nil {
+		return nil, err
+	}
+	return ParseParameters(der)
+}
+
+// MarshalPublicKeyPEM returns pub as a PEM "PUBLIC KEY" block.
+func MarshalPublicKeyPEM(pub *PublicKey) ([]byte, error) {
+	der, err := MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PublicKeyPEMType, Bytes: der}), nil
+}
+
+// ParsePublicKeyPEM parses the first PEM block in data as a public key; opts
+// is as for ParsePKIXPublicKey.
+func ParsePublicKeyPEM(data []byte, opts *CertificateOptions) (*PublicKey, error) {
+	der, err := decodePEM(data, PublicKeyPEMType)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePKIXPublicKey(der, opts)
+}
+
+// MarshalPrivateKeyPEM returns priv as an unencrypted PEM "PRIVATE KEY"
+// block.
+func MarshalPrivateKeyPEM(priv *PrivateKey) ([]byte, error) {
+	der, err := MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PrivateKeyPEMType, Bytes: der}), nil
+}
+
+// ParsePrivateKeyPEM parses the first PEM block in data as a private key.
+func ParsePrivateKeyPEM(data []byte) (*PrivateKey, error) {
+	der, err := decodePEM(data, PrivateKeyPEMType)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePKCS8PrivateKey(der)
+}
+
+// MarshalEncryptedPrivateKeyPEM returns priv as a PEM "ENCRYPTED PRIVATE
+// KEY" block, encrypted under password with PBES2 and SKIPJACK-CBC.  See
+// skipjack.EncryptPKCS8PrivateKey for rand and params.
+func MarshalEncryptedPrivateKeyPEM(rand io.Reader, priv *PrivateKey, password []byte, params *skipjack.KDFParams) ([]byte, error) {
+	der, err := MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := skipjack.EncryptPKCS8PrivateKey(rand, der, password, params)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: EncryptedPrivateKeyPEMType, Bytes: enc}), nil
+}
+
+// ParseEncryptedPrivateKeyPEM decrypts the first PEM block in data with
+// password and parses it as a private key.
+func ParseEncryptedPrivateKeyPEM(data, password []byte) (*PrivateKey, error) {
+	enc, err := decodePEM(data, EncryptedPrivateKeyPEMType)
+	if err != nil {
+		return nil, err
+	}
+	der, err := skipjack.DecryptPKCS8PrivateKey(enc, password)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePKCS8PrivateKey(der)
+}
+
+func decodePEM(data []byte, typ string) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("kea: no PEM data found")
+	}
+	if block.Type != typ {
+		return nil, errors.New("kea: unexpected PEM block type " + block.Type)
+	}
+	return block.Bytes, nil
+}
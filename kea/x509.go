@@ -0,0 +1,219 @@
+package kea
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+/*
+
+   Key encodings, from:
+   RFC 2528, "Representation of Key Exchange Algorithm (KEA) Keys in
+   Internet X.509 Public Key Infrastructure Certificates"
+   http://tools.ietf.org/html/rfc2528
+
+   RFC 2528 gives the algorithm parameters as
+
+      KEA-Parms-Id ::= OCTET STRING
+
+   which names a parameter set known to both parties.  An ID cannot be
+   resolved without such a table, so this package writes the parameters
+   explicitly as the DSA Dss-Parms sequence instead.  ParseParameters
+   returns ErrParametersID for a KEA-Parms-Id; ParsePKIXPublicKey and
+   ParseCertificateKeys resolve one through CertificateOptions.  The public key
+   is carried in the subjectPublicKey BIT STRING as the unsigned big-endian
+   value of Y, padded to the length of P.  Private keys use PKCS#8 with the
+   same algorithm identifier and x as a DER INTEGER, in the manner of DSA.
+
+*/
+
+// OIDKeyExchangeAlgorithm is id-keyExchangeAlgorithm.
+var OIDKeyExchangeAlgorithm = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 2, 1, 1, 22}
+
+type dssParms struct {
+	P, Q, G *big.Int
+}
+
+type publicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// pkcs8 is PrivateKeyInfo; the optional attributes are not supported
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+var errTrailingData = errors.New("kea: trailing data after ASN.1 structure")
+
+// ErrParametersID is returned when parameters are a KEA-Parms-Id rather than
+// an explicit Dss-Parms.
+var ErrParametersID = errors.New("kea: parameters are a KEA-Parms-Id, not Dss-Parms")
+
+// MarshalParameters returns the DER Dss-Parms encoding of params.  It
+// never writes a KEA-Parms-Id.
+func MarshalParameters(params *Parameters) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(dssParms{params.P, params.Q, params.G})
+}
+
+// ParseParameters parses and validates DER Dss-Parms.  It returns
+// ErrParametersID for a KEA-Parms-Id.
+func ParseParameters(der []byte) (*Parameters, error) {
+	if len(der) > 0 && der[0] == asn1.TagOctetString {
+		return nil, ErrParametersID
+	}
+
+	var p dssParms
+
+	rest, err := asn1.Unmarshal(der, &p)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errTrailingData
+	}
+
+	params := &Parameters{P: p.P, Q: p.Q, G: p.G}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+func algorithmIdentifier(params *Parameters) (pkix.AlgorithmIdentifier, error) {
+	der, err := MarshalParameters(params)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  OIDKeyExchangeAlgorithm,
+		Parameters: asn1.RawValue{FullBytes: der},
+	}, nil
+}
+
+// MarshalPKIXPublicKey returns the DER SubjectPublicKeyInfo encoding of pub.
+func MarshalPKIXPublicKey(pub *PublicKey) ([]byte, error) {
+	algo, err := algorithmIdentifier(&pub.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pub.Validate(); err != nil {
+		return nil, err
+	}
+
+	y := pub.Y.FillBytes(make([]byte, (pub.P.BitLen()+7)/8))
+
+	return asn1.Marshal(publicKeyInfo{
+		Algorithm: algo,
+		PublicKey: asn1.BitString{Bytes: y, BitLength: 8 * len(y)},
+	})
+}
+
+// ParsePKIXPublicKey parses and validates a DER SubjectPublicKeyInfo holding
+// a KEA public key.  opts resolves a KEA-Parms-Id or absent parameters, and
+// may be nil if the parameters are explicit.
+func ParsePKIXPublicKey(der []byte, opts *CertificateOptions) (*PublicKey, error) {
+	if opts == nil {
+		opts = &CertificateOptions{}
+	}
+
+	var spki publicKeyInfo
+
+	rest, err := asn1.Unmarshal(der, &spki)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errTrailingData
+	}
+
+	if !spki.Algorithm.Algorithm.Equal(OIDKeyExchangeAlgorithm) {
+		return nil, errors.New("kea: not a KEA public key")
+	}
+
+	params, err := keaParameters(spki.Algorithm.Parameters, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePublicValue(params, spki.PublicKey)
+}
+
+// parsePublicValue validates the BIT STRING form of Y against params
+func parsePublicValue(params *Parameters, bits asn1.BitString) (*PublicKey, error) {
+	if bits.BitLength%8 != 0 || len(bits.Bytes) != (params.P.BitLen()+7)/8 {
+		return nil, errInvalidPublicKey
+	}
+
+	pub := &PublicKey{Parameters: *params, Y: new(big.Int).SetBytes(bits.Bytes)}
+	if err := pub.Validate(); err != nil {
+		return nil, err
+	}
+
+	return pub, nil
+}
+
+// MarshalPKCS8PrivateKey returns the DER PKCS#8 encoding of priv.
+func MarshalPKCS8PrivateKey(priv *PrivateKey) ([]byte, error) {
+	algo, err := algorithmIdentifier(&priv.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	x, err := asn1.Marshal(priv.X)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pkcs8{Algo: algo, PrivateKey: x})
+}
+
+// ParsePKCS8PrivateKey parses an unencrypted DER PKCS#8 KEA private key.
+func ParsePKCS8PrivateKey(der []byte) (*PrivateKey, error) {
+	var p pkcs8
+
+	rest, err := asn1.Unmarshal(der, &p)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errTrailingData
+	}
+
+	if p.Version != 0 || !p.Algo.Algorithm.Equal(OIDKeyExchangeAlgorithm) {
+		return nil, errors.New("kea: not a KEA private key")
+	}
+
+	params, err := ParseParameters(p.Algo.Parameters.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	x := new(big.Int)
+	if rest, err := asn1.Unmarshal(p.PrivateKey, &x); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errTrailingData
+	}
+
+	if x.Sign() <= 0 || x.Cmp(params.Q) >= 0 {
+		return nil, errors.New("kea: invalid private key")
+	}
+
+	priv := &PrivateKey{X: x}
+	priv.Parameters = *params
+	priv.Y = new(big.Int).Exp(params.G, x, params.P)
+
+	return priv, nil
+}
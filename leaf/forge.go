@@ -0,0 +1,90 @@
+package leaf
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+
+   LEAF forgery, from Blaze's "Protocol Failure in the Escrowed Encryption
+   Standard".  A receiving device only checks the 16-bit EA, so a rogue user
+   with access to a device can try random LEAFs until one is accepted.  The
+   forged LEAF carries no usable unit ID or session key, so the escrow
+   agents cannot recover the traffic key from it.
+
+   A random LEAF passes with probability 2^-16, so the number of trials is
+   geometrically distributed with mean 2^16.
+
+*/
+
+// ExpectedTrials is the expected number of random LEAFs tried before one
+// passes the EA check.
+const ExpectedTrials = 1 << 16
+
+// Forgery is the result of a successful search.
+type Forgery struct {
+	LEAF   []byte
+	Trials uint64
+}
+
+// Forge searches for a LEAF accepted by r using the given number of
+// goroutines, or one per CPU if workers is less than one.  The starting
+// point is read from rand.  The search stops early if ctx is cancelled.
+func Forge(ctx context.Context, r *Receiver, workers int, rand io.Reader) (*Forgery, error) {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	base := make([]byte, Size)
+	if _, err := io.ReadFull(rand, base); err != nil {
+		return nil, err
+	}
+
+	search, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var trials atomic.Uint64
+	found := make(chan []byte, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w uint64) {
+			defer wg.Done()
+
+			l := make([]byte, Size)
+			copy(l, base)
+			start := binary.BigEndian.Uint64(base[8:])
+
+			// worker w tries candidates w, w+workers, w+2*workers, ...
+			for i := w; ; i += uint64(workers) {
+				if i&0x3ff < uint64(workers) && search.Err() != nil {
+					return
+				}
+
+				binary.BigEndian.PutUint64(l[8:], start^i)
+				trials.Add(1)
+
+				if r.Accept(l) {
+					found <- l
+					cancel()
+					return
+				}
+			}
+		}(uint64(w))
+	}
+
+	wg.Wait()
+
+	select {
+	case l := <-found:
+		return &Forgery{LEAF: l, Trials: trials.Load()}, nil
+	default:
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,59 @@
+package leaf
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+)
+
+func TestForge(t *testing.T) {
+
+	u, _ := NewUnit(0x1234abcd, unitKey, familyKey)
+	genuine, _ := u.Generate(sessionKey, iv)
+
+	r, err := NewReceiver(familyKey, sessionKey, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Accept(genuine) {
+		t.Fatalf("receiver rejected a genuine leaf\n")
+	}
+
+	f, err := Forge(context.Background(), r, 4, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(f.LEAF, genuine) {
+		t.Errorf("forge returned the genuine leaf\n")
+	}
+
+	if !r.Accept(f.LEAF) || Verify(familyKey, f.LEAF, sessionKey, iv) != nil {
+		t.Errorf("forged leaf is not accepted\n")
+	}
+
+	// 20 times the mean fails with probability e^-20
+	if f.Trials == 0 || f.Trials > 20*ExpectedTrials {
+		t.Errorf("forge took an implausible %d trials\n", f.Trials)
+	}
+
+	// the escrow agents get nothing useful from the forged leaf
+	fields, _ := Decrypt(familyKey, f.LEAF)
+	if k, _ := fields.SessionKey(unitKey); bytes.Equal(k, sessionKey) {
+		t.Errorf("forged leaf carries the session key\n")
+	}
+}
+
+func TestForgeCancel(t *testing.T) {
+
+	r, _ := NewReceiver(familyKey, sessionKey, iv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if f, err := Forge(ctx, r, 2, rand.Reader); err != context.Canceled {
+		t.Errorf("forge ignored cancellation: got %v, %v\n", f, err)
+	}
+}
@@ -0,0 +1,233 @@
+// Package leaf models the Law Enforcement Access Field (LEAF) of the
+// Clipper and Capstone escrowed encryption devices.
+/*
+
+   The LEAF was specified in the classified part of FIPS 185, "Escrowed
+   Encryption Standard".  The layout used here is the one described in:
+
+   Matt Blaze: "Protocol Failure in the Escrowed Encryption Standard"
+   http://www.crypto.com/papers/eesproto.pdf
+
+   A LEAF is 128 bits: the 32-bit unit ID, the 80-bit session key encrypted
+   under the unit key, and a 16-bit escrow authenticator (EA), all encrypted
+   under the family key.  The encryption functions and the EA computation
+   were never published, so this package uses:
+
+   - the session key is encrypted under the unit key as two overlapping
+     SKIPJACK blocks, bytes 0-7 and then bytes 2-9;
+   - the EA is the first 16 bits of the SKIPJACK encryption, under the
+     session key, of the IV exclusive-or'd with a fixed mask;
+   - the 128-bit LEAF is encrypted under the family key in CBC mode with a
+     zero IV.
+
+   A receiving device knows the family key, the session key and the IV, so
+   it can check the EA but not the unit ID or the encrypted session key.
+
+*/
+package leaf
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// Size is the length of a LEAF in bytes.
+const Size = 16
+
+// KeySize is the length of unit, family and session keys in bytes.
+const KeySize = 10
+
+// IVSize is the length of the IV the EA is computed over.
+const IVSize = 8
+
+var eaMask = [IVSize]byte{0x4c, 0x45, 0x41, 0x46, 0x2d, 0x45, 0x41, 0x00}
+
+var (
+	errLEAFSize = errors.New("leaf: invalid LEAF length")
+	errIVSize   = errors.New("leaf: invalid IV length")
+	errInvalid  = errors.New("leaf: escrow authenticator mismatch")
+)
+
+// Unit is an escrowed encryption device: its unit ID, the unit key held in
+// escrow, and the family key shared by all devices.
+type Unit struct {
+	ID     uint32
+	unit   cipher.Block
+	family cipher.Block
+}
+
+// NewUnit returns a device with the given unit ID and 10-byte unit and family
+// keys.
+func NewUnit(id uint32, unitKey, familyKey []byte) (*Unit, error) {
+	unit, err := skipjack.New(unitKey)
+	if err != nil {
+		return nil, err
+	}
+
+	family, err := skipjack.New(familyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Unit{ID: id, unit: unit, family: family}, nil
+}
+
+// Fields are the contents of a LEAF once decrypted under the family key.
+type Fields struct {
+	UnitID       uint32
+	EncryptedKey [KeySize]byte
+	EA           uint16
+}
+
+// Generate returns the LEAF binding sessionKey and iv to this unit.
+func (u *Unit) Generate(sessionKey, iv []byte) ([]byte, error) {
+	ea, err := Authenticator(sessionKey, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	f := Fields{UnitID: u.ID, EA: ea}
+
+	copy(f.EncryptedKey[:], sessionKey)
+	u.unit.Encrypt(f.EncryptedKey[0:8], f.EncryptedKey[0:8])
+	u.unit.Encrypt(f.EncryptedKey[2:10], f.EncryptedKey[2:10])
+
+	return f.encrypt(u.family), nil
+}
+
+func (f *Fields) encrypt(family cipher.Block) []byte {
+	l := make([]byte, Size)
+
+	binary.BigEndian.PutUint32(l[0:4], f.UnitID)
+	copy(l[4:14], f.EncryptedKey[:])
+	binary.BigEndian.PutUint16(l[14:16], f.EA)
+
+	cipher.NewCBCEncrypter(family, make([]byte, family.BlockSize())).CryptBlocks(l, l)
+
+	return l
+}
+
+// Authenticator returns the escrow authenticator for a 10-byte session key
+// and 8-byte IV.
+func Authenticator(sessionKey, iv []byte) (uint16, error) {
+	if len(iv) != IVSize {
+		return 0, errIVSize
+	}
+
+	b, err := skipjack.New(sessionKey)
+	if err != nil {
+		return 0, err
+	}
+
+	var x [IVSize]byte
+	for i := range x {
+		x[i] = iv[i] ^ eaMask[i]
+	}
+	b.Encrypt(x[:], x[:])
+
+	return binary.BigEndian.Uint16(x[:]), nil
+}
+
+// Decrypt decrypts a LEAF under the 10-byte family key.  Any 16-byte string
+// decrypts to some set of fields; use Verify to check the EA.
+func Decrypt(familyKey, leaf []byte) (*Fields, error) {
+	if len(leaf) != Size {
+		return nil, errLEAFSize
+	}
+
+	family, err := skipjack.New(familyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	l := make([]byte, Size)
+	cipher.NewCBCDecrypter(family, make([]byte, family.BlockSize())).CryptBlocks(l, leaf)
+
+	f := &Fields{
+		UnitID: binary.BigEndian.Uint32(l[0:4]),
+		EA:     binary.BigEndian.Uint16(l[14:16]),
+	}
+	copy(f.EncryptedKey[:], l[4:14])
+
+	return f, nil
+}
+
+// SessionKey decrypts the session key in f with the 10-byte unit key.
+func (f *Fields) SessionKey(unitKey []byte) ([]byte, error) {
+	unit, err := skipjack.New(unitKey)
+	if err != nil {
+		return nil, err
+	}
+
+	k := make([]byte, KeySize)
+	copy(k, f.EncryptedKey[:])
+	unit.Decrypt(k[2:10], k[2:10])
+	unit.Decrypt(k[0:8], k[0:8])
+
+	return k, nil
+}
+
+// Verify performs a receiving device's check of a LEAF: it decrypts leaf
+// under the family key and compares the EA with the one computed from the
+// session key and IV.
+func Verify(familyKey, leaf, sessionKey, iv []byte) error {
+	r, err := NewReceiver(familyKey, sessionKey, iv)
+	if err != nil {
+		return err
+	}
+	return r.check(leaf)
+}
+
+// Receiver is a receiving device set up with a session key and IV, checking
+// the LEAFs presented to it.  It is safe for concurrent use.
+type Receiver struct {
+	family cipher.Block
+	ea     [2]byte
+}
+
+// NewReceiver returns a receiving device with the 10-byte family key and the
+// current session key and IV.
+func NewReceiver(familyKey, sessionKey, iv []byte) (*Receiver, error) {
+	family, err := skipjack.New(familyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ea, err := Authenticator(sessionKey, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Receiver{family: family}
+	binary.BigEndian.PutUint16(r.ea[:], ea)
+
+	return r, nil
+}
+
+// Accept reports whether the device would accept leaf and go on to decrypt.
+func (r *Receiver) Accept(leaf []byte) bool {
+	return r.check(leaf) == nil
+}
+
+func (r *Receiver) check(leaf []byte) error {
+	if len(leaf) != Size {
+		return errLEAFSize
+	}
+
+	// only the last block holds the EA
+	var l [8]byte
+	r.family.Decrypt(l[:], leaf[8:16])
+	for i := range l {
+		l[i] ^= leaf[i]
+	}
+
+	if subtle.ConstantTimeCompare(l[6:8], r.ea[:]) != 1 {
+		return errInvalid
+	}
+
+	return nil
+}
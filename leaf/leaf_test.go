@@ -0,0 +1,96 @@
+package leaf
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	unitKey    = []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23}
+	familyKey  = []byte{0xf0, 0xe1, 0xd2, 0xc3, 0xb4, 0xa5, 0x96, 0x87, 0x78, 0x69}
+	sessionKey = []byte{0x00, 0x99, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11}
+	iv         = []byte{0x33, 0x22, 0x11, 0x00, 0xdd, 0xcc, 0xbb, 0xaa}
+)
+
+func TestLEAF(t *testing.T) {
+
+	u, err := NewUnit(0x1234abcd, unitKey, familyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := u.Generate(sessionKey, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l) != Size {
+		t.Fatalf("leaf length: got %d wanted %d\n", len(l), Size)
+	}
+
+	if bytes.Contains(l, sessionKey[:4]) {
+		t.Errorf("leaf exposes the session key: %x\n", l)
+	}
+
+	if err := Verify(familyKey, l, sessionKey, iv); err != nil {
+		t.Errorf("leaf verify failed: %v\n", err)
+	}
+
+	// escrow side: decrypt with the family key, then the unit key
+	f, err := Decrypt(familyKey, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.UnitID != 0x1234abcd {
+		t.Errorf("leaf unit id: got %08x wanted 1234abcd\n", f.UnitID)
+	}
+
+	if ea, _ := Authenticator(sessionKey, iv); f.EA != ea {
+		t.Errorf("leaf ea: got %04x wanted %04x\n", f.EA, ea)
+	}
+
+	k, err := f.SessionKey(unitKey)
+	if err != nil || !bytes.Equal(k, sessionKey) {
+		t.Errorf("leaf session key recovery failed: got %x wanted %x\n", k, sessionKey)
+	}
+
+	if k, _ := f.SessionKey(familyKey); bytes.Equal(k, sessionKey) {
+		t.Errorf("leaf session key recovered with the wrong unit key\n")
+	}
+}
+
+func TestVerify(t *testing.T) {
+
+	u, _ := NewUnit(7, unitKey, familyKey)
+	l, _ := u.Generate(sessionKey, iv)
+
+	otherIV := append([]byte{}, iv...)
+	otherIV[0] ^= 1
+	if err := Verify(familyKey, l, sessionKey, otherIV); err == nil {
+		t.Errorf("leaf verified with the wrong iv\n")
+	}
+
+	otherKey := append([]byte{}, sessionKey...)
+	otherKey[9] ^= 1
+	if err := Verify(familyKey, l, otherKey, iv); err == nil {
+		t.Errorf("leaf verified with the wrong session key\n")
+	}
+
+	if err := Verify(unitKey, l, sessionKey, iv); err == nil {
+		t.Errorf("leaf verified with the wrong family key\n")
+	}
+
+	l[15] ^= 1
+	if err := Verify(familyKey, l, sessionKey, iv); err == nil {
+		t.Errorf("leaf verified after modification\n")
+	}
+
+	if err := Verify(familyKey, l[:8], sessionKey, iv); err == nil {
+		t.Errorf("leaf verified a short leaf\n")
+	}
+
+	if _, err := NewUnit(7, unitKey[:8], familyKey); err == nil {
+		t.Errorf("leaf accepted a short unit key\n")
+	}
+}
@@ -0,0 +1,53 @@
+package skipjack
+
+import (
+	"crypto/cipher"
+	"errors"
+)
+
+/*
+
+   OFB, from:
+   NIST SP 800-38A, "Recommendation for Block Cipher Modes of Operation"
+   http://csrc.nist.gov/publications/nistpubs/800-38a/sp800-38a.pdf
+
+   crypto/cipher deprecates its OFB, but FIPS 81, CAPSTONE and the FORTEZZA
+   and PKCS #11 interfaces still need 64-bit OFB to interoperate.  The
+   keystream is E(IV), E(E(IV)), ...; encryption and decryption are the
+   same operation.
+
+*/
+
+type ofb struct {
+	b   cipher.Block
+	out []byte
+	pos int
+}
+
+// NewOFB returns a cipher.Stream which encrypts or decrypts with b in OFB
+// mode.  The iv must be one block long.
+func NewOFB(b cipher.Block, iv []byte) (cipher.Stream, error) {
+	if len(iv) != b.BlockSize() {
+		return nil, errors.New("skipjack: OFB IV length must equal block size")
+	}
+
+	o := &ofb{b: b, out: append([]byte(nil), iv...)}
+	b.Encrypt(o.out, o.out)
+
+	return o, nil
+}
+
+func (o *ofb) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("skipjack: output smaller than input")
+	}
+
+	for i, v := range src {
+		if o.pos == len(o.out) {
+			o.b.Encrypt(o.out, o.out)
+			o.pos = 0
+		}
+		dst[i] = v ^ o.out[o.pos]
+		o.pos++
+	}
+}
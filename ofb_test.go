@@ -0,0 +1,39 @@
+package skipjack
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+func TestOFBVector(t *testing.T) {
+
+	// SP 800-38A F.4.1, OFB-AES128.Encrypt
+	b, _ := aes.NewCipher(unhex("2b7e151628aed2a6abf7158809cf4f3c"))
+	iv := unhex("000102030405060708090a0b0c0d0e0f")
+	pt := unhex("6bc1bee22e409f96e93d7e117393172a" + "ae2d8a571e03ac9c9eb76fac45af8e51")
+	want := unhex("3b3fd92eb72dad20333449f8e83cfb4a" + "7789508d16918f03f53c52dac54ed825")
+
+	enc, _ := NewOFB(b, iv)
+	ct := make([]byte, len(pt))
+
+	// uneven writes cross block boundaries
+	enc.XORKeyStream(ct[:5], pt[:5])
+	enc.XORKeyStream(ct[5:21], pt[5:21])
+	enc.XORKeyStream(ct[21:], pt[21:])
+
+	if !bytes.Equal(ct, want) {
+		t.Errorf("ofb encrypt failed: got %x wanted %x\n", ct, want)
+	}
+
+	dec, _ := NewOFB(b, iv)
+	dec.XORKeyStream(ct, ct)
+
+	if !bytes.Equal(ct, pt) {
+		t.Errorf("ofb decrypt failed: got %x wanted %x\n", ct, pt)
+	}
+
+	if _, err := NewOFB(b, iv[:8]); err == nil {
+		t.Errorf("ofb accepted an 8-byte IV for a 16-byte block\n")
+	}
+}
@@ -0,0 +1,285 @@
+package skipjack
+
+import (
+	"crypto/cipher"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+)
+
+/*
+
+   Password-based encryption, from:
+   RFC 8018, "PKCS #5: Password-Based Cryptography Specification Version 2.1"
+   http://tools.ietf.org/html/rfc8018
+   RFC 5958, "Asymmetric Key Packages"
+   http://tools.ietf.org/html/rfc5958
+
+   PBES2 pairs a key derivation function with an encryption scheme:
+
+      PBES2-params ::= SEQUENCE {
+         keyDerivationFunc AlgorithmIdentifier {{PBES2-KDFs}},
+         encryptionScheme  AlgorithmIdentifier {{PBES2-Encs}} }
+
+   The key derivation function is id-PBKDF2 with hmacWithSHA256 as the PRF,
+   or id-scrypt from RFC 7914, both with an explicit keyLength of 10.  The
+   encryption scheme is SKIPJACK-CBC, id-fortezzaConfidentialityAlgorithm
+   with Skipjack-Parm, and the plaintext has PKCS #5 padding.
+
+   An encrypted PKCS #8 private key is
+
+      EncryptedPrivateKeyInfo ::= SEQUENCE {
+         encryptionAlgorithm AlgorithmIdentifier,
+         encryptedData       OCTET STRING }
+
+   with PBES2 as the encryption algorithm.
+
+*/
+
+// Object identifiers for PBES2.
+var (
+	OIDPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	OIDPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	OIDHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	OIDScrypt         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+)
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+const pbes2SaltSize = 16
+
+var (
+	errNotPBES2      = errors.New("skipjack: algorithm is not PBES2")
+	errPBES2KDF      = errors.New("skipjack: unsupported PBES2 key derivation function")
+	errPBES2PRF      = errors.New("skipjack: unsupported PBKDF2 PRF")
+	errPBES2KeySize  = errors.New("skipjack: invalid PBES2 key length")
+	errPBES2Decrypt  = errors.New("skipjack: PBES2 decryption failed")
+	errPBES2Trailing = errors.New("skipjack: trailing data after PBES2 parameters")
+)
+
+func unmarshalAll(der []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(der, v)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errPBES2Trailing
+	}
+	return nil
+}
+
+// kdfAlgorithm returns the AlgorithmIdentifier for params and salt
+func kdfAlgorithm(params *KDFParams, salt []byte) (pkix.AlgorithmIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	var v interface{}
+
+	switch params.KDF {
+	case PBKDF2:
+		oid = OIDPBKDF2
+		v = pbkdf2Params{
+			Salt:           salt,
+			IterationCount: params.Iterations,
+			KeyLength:      10,
+			PRF:            pkix.AlgorithmIdentifier{Algorithm: OIDHMACWithSHA256, Parameters: asn1.NullRawValue},
+		}
+	case Scrypt:
+		oid = OIDScrypt
+		v = scryptParams{
+			Salt:                     salt,
+			CostParameter:            params.N,
+			BlockSize:                params.R,
+			ParallelizationParameter: params.P,
+			KeyLength:                10,
+		}
+	default:
+		return pkix.AlgorithmIdentifier{}, errPBES2KDF
+	}
+
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+
+	return pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.RawValue{FullBytes: der}}, nil
+}
+
+// parseKDF returns the parameters and salt of a key derivation function
+// AlgorithmIdentifier
+func parseKDF(ai pkix.AlgorithmIdentifier) (*KDFParams, []byte, error) {
+	switch {
+	case ai.Algorithm.Equal(OIDPBKDF2):
+		var p pbkdf2Params
+		if err := unmarshalAll(ai.Parameters.FullBytes, &p); err != nil {
+			return nil, nil, err
+		}
+		// an absent PRF is hmacWithSHA1
+		if !p.PRF.Algorithm.Equal(OIDHMACWithSHA256) {
+			return nil, nil, errPBES2PRF
+		}
+		if p.KeyLength != 0 && p.KeyLength != 10 {
+			return nil, nil, errPBES2KeySize
+		}
+		return &KDFParams{KDF: PBKDF2, Iterations: p.IterationCount}, p.Salt, nil
+
+	case ai.Algorithm.Equal(OIDScrypt):
+		var p scryptParams
+		if err := unmarshalAll(ai.Parameters.FullBytes, &p); err != nil {
+			return nil, nil, err
+		}
+		if p.KeyLength != 0 && p.KeyLength != 10 {
+			return nil, nil, errPBES2KeySize
+		}
+		return &KDFParams{KDF: Scrypt, N: p.CostParameter, R: p.BlockSize, P: p.ParallelizationParameter}, p.Salt, nil
+	}
+
+	return nil, nil, errPBES2KDF
+}
+
+// EncryptPBES2 encrypts plaintext under a key derived from password and
+// returns the PBES2 AlgorithmIdentifier and the ciphertext.  The salt and
+// IV are read from rand.  If params is nil, PBKDF2 with DefaultIterations
+// is used.
+func EncryptPBES2(rand io.Reader, plaintext, password []byte, params *KDFParams) (pkix.AlgorithmIdentifier, []byte, error) {
+	if params == nil {
+		params = &KDFParams{KDF: PBKDF2, Iterations: DefaultIterations}
+	}
+
+	salt := make([]byte, pbes2SaltSize)
+	iv := make([]byte, 8)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+
+	key, err := DeriveKey(password, salt, params)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+
+	kdf, err := kdfAlgorithm(params, salt)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	enc, err := AlgorithmIdentifier(iv)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	der, err := asn1.Marshal(pbes2Params{KeyDerivationFunc: kdf, EncryptionScheme: enc})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+
+	b, _ := New(key)
+	mode := cipher.NewCBCEncrypter(b, iv)
+
+	ct := Pad(plaintext)
+	mode.CryptBlocks(ct, ct)
+
+	return pkix.AlgorithmIdentifier{Algorithm: OIDPBES2, Parameters: asn1.RawValue{FullBytes: der}}, ct, nil
+}
+
+// DecryptPBES2 decrypts ciphertext encrypted with the PBES2
+// AlgorithmIdentifier ai under a key derived from password.  The key
+// derivation parameters come from ai; like DeriveKey, it rejects any above
+// MaxIterations or MaxScryptWork.
+func DecryptPBES2(ai pkix.AlgorithmIdentifier, ciphertext, password []byte) ([]byte, error) {
+	if !ai.Algorithm.Equal(OIDPBES2) {
+		return nil, errNotPBES2
+	}
+
+	var p pbes2Params
+	if err := unmarshalAll(ai.Parameters.FullBytes, &p); err != nil {
+		return nil, err
+	}
+
+	params, salt, err := parseKDF(p.KeyDerivationFunc)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := AlgorithmIV(p.EncryptionScheme)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) == 0 || len(ciphertext)%8 != 0 {
+		return nil, errPBES2Decrypt
+	}
+
+	key, err := DeriveKey(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+
+	b, _ := New(key)
+	mode := cipher.NewCBCDecrypter(b, iv)
+
+	pt := make([]byte, len(ciphertext))
+	mode.CryptBlocks(pt, ciphertext)
+
+	// a bad password almost always shows up as bad padding
+	pt, err = Unpad(pt)
+	if err != nil {
+		return nil, errPBES2Decrypt
+	}
+
+	return pt, nil
+}
+
+// EncryptPKCS8PrivateKey encrypts a DER PKCS #8 PrivateKeyInfo with PBES2
+// and returns the DER EncryptedPrivateKeyInfo.  rand and params are as for
+// EncryptPBES2.
+func EncryptPKCS8PrivateKey(rand io.Reader, der, password []byte, params *KDFParams) ([]byte, error) {
+	ai, ct, err := EncryptPBES2(rand, der, password, params)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{EncryptionAlgorithm: ai, EncryptedData: ct})
+}
+
+// DecryptPKCS8PrivateKey decrypts a DER EncryptedPrivateKeyInfo encrypted
+// with PBES2 and returns the DER PrivateKeyInfo.
+func DecryptPKCS8PrivateKey(der, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if err := unmarshalAll(der, &info); err != nil {
+		return nil, err
+	}
+
+	pt, err := DecryptPBES2(info.EncryptionAlgorithm, info.EncryptedData, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// check that the padding was not right by chance
+	var raw asn1.RawValue
+	if err := unmarshalAll(pt, &raw); err != nil {
+		return nil, errPBES2Decrypt
+	}
+
+	return pt, nil
+}
@@ -0,0 +1,131 @@
+package skipjack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+)
+
+var testKDFParams = []KDFParams{
+	{KDF: PBKDF2, Iterations: 1000},
+	{KDF: Scrypt, N: 1024, R: 8, P: 1},
+}
+
+func TestPBES2(t *testing.T) {
+
+	password := []byte("correct horse battery staple")
+
+	for _, params := range testKDFParams {
+		for _, n := range []int{0, 1, 7, 8, 9, 100} {
+			msg := make([]byte, n)
+			rand.Read(msg)
+
+			ai, ct, err := EncryptPBES2(rand.Reader, msg, password, &params)
+			if err != nil {
+				t.Fatalf("pbes2 encrypt failed: %v\n", err)
+			}
+			if len(ct) != n+8-n%8 {
+				t.Errorf("pbes2 ciphertext length failed: got %d for %d\n", len(ct), n)
+			}
+
+			pt, err := DecryptPBES2(ai, ct, password)
+			if err != nil || !bytes.Equal(pt, msg) {
+				t.Errorf("pbes2 round trip failed: got %x wanted %x (%v)\n", pt, msg, err)
+			}
+
+			if pt, err := DecryptPBES2(ai, ct, []byte("wrong")); err == nil && bytes.Equal(pt, msg) {
+				t.Errorf("pbes2 decrypted with the wrong password\n")
+			}
+		}
+	}
+}
+
+func TestPBES2Parameters(t *testing.T) {
+
+	password := []byte("password")
+
+	ai, ct, err := EncryptPBES2(rand.Reader, []byte("attack at dawn"), password, &testKDFParams[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p pbes2Params
+	if _, err := asn1.Unmarshal(ai.Parameters.FullBytes, &p); err != nil {
+		t.Fatal(err)
+	}
+	var kp pbkdf2Params
+	if _, err := asn1.Unmarshal(p.KeyDerivationFunc.Parameters.FullBytes, &kp); err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.KeyDerivationFunc.Algorithm.Equal(OIDPBKDF2) || !kp.PRF.Algorithm.Equal(OIDHMACWithSHA256) ||
+		kp.IterationCount != 1000 || kp.KeyLength != 10 || len(kp.Salt) != pbes2SaltSize {
+		t.Errorf("pbes2 pbkdf2 parameters failed: got %+v\n", kp)
+	}
+	if _, err := AlgorithmIV(p.EncryptionScheme); err != nil {
+		t.Errorf("pbes2 encryption scheme failed: %v\n", err)
+	}
+
+	// the default PRF, hmacWithSHA1, is not supported
+	kp.PRF = pkix.AlgorithmIdentifier{}
+	kdf, _ := asn1.Marshal(kp)
+	p.KeyDerivationFunc.Parameters = asn1.RawValue{FullBytes: kdf}
+	der, _ := asn1.Marshal(p)
+	sha1AI := pkix.AlgorithmIdentifier{Algorithm: OIDPBES2, Parameters: asn1.RawValue{FullBytes: der}}
+
+	if _, err := DecryptPBES2(sha1AI, ct, password); err != errPBES2PRF {
+		t.Errorf("pbes2 accepted hmacWithSHA1: %v\n", err)
+	}
+
+	if _, err := DecryptPBES2(pkix.AlgorithmIdentifier{Algorithm: OIDPBKDF2}, ct, password); err != errNotPBES2 {
+		t.Errorf("pbes2 accepted another algorithm: %v\n", err)
+	}
+
+	// an untrusted header may not ask for unbounded work
+	for _, params := range []*KDFParams{
+		{KDF: PBKDF2, Iterations: MaxIterations + 1},
+		{KDF: Scrypt, N: 1 << 24, R: 8, P: 1},
+	} {
+		kdf, err := kdfAlgorithm(params, make([]byte, pbes2SaltSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.KeyDerivationFunc = kdf
+		der, _ := asn1.Marshal(p)
+		big := pkix.AlgorithmIdentifier{Algorithm: OIDPBES2, Parameters: asn1.RawValue{FullBytes: der}}
+
+		if _, err := DecryptPBES2(big, ct, password); err != errKDFLimit {
+			t.Errorf("pbes2 accepted %+v: %v\n", params, err)
+		}
+	}
+}
+
+func TestPKCS8PrivateKey(t *testing.T) {
+
+	// a PrivateKeyInfo need only be DER here
+	pki, _ := asn1.Marshal(struct {
+		Version int
+		Algo    pkix.AlgorithmIdentifier
+		Key     []byte
+	}{0, pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 3}}, []byte("private")})
+
+	password := []byte("password")
+
+	for _, params := range testKDFParams {
+		der, err := EncryptPKCS8PrivateKey(rand.Reader, pki, password, &params)
+		if err != nil {
+			t.Fatalf("pkcs8 encrypt failed: %v\n", err)
+		}
+
+		got, err := DecryptPKCS8PrivateKey(der, password)
+		if err != nil || !bytes.Equal(got, pki) {
+			t.Errorf("pkcs8 round trip failed: got %x wanted %x (%v)\n", got, pki, err)
+		}
+
+		if _, err := DecryptPKCS8PrivateKey(der, []byte("wrong")); err != errPBES2Decrypt {
+			t.Errorf("pkcs8 decrypt with the wrong password failed: %v\n", err)
+		}
+	}
+}
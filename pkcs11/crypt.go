@@ -0,0 +1,255 @@
+package pkcs11
+
+import (
+	"crypto/cipher"
+	"io"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// operation is an encryption or decryption in progress.  Block modes
+// buffer input up to a whole block.
+type operation struct {
+	mode   cipher.BlockMode
+	stream cipher.Stream
+	buf    []byte
+}
+
+func (op *operation) update(data []byte) []byte {
+	if op.stream != nil {
+		out := make([]byte, len(data))
+		op.stream.XORKeyStream(out, data)
+		return out
+	}
+
+	op.buf = append(op.buf, data...)
+	n := len(op.buf) - len(op.buf)%op.mode.BlockSize()
+
+	out := make([]byte, n)
+	op.mode.CryptBlocks(out, op.buf[:n])
+	op.buf = append(op.buf[:0], op.buf[n:]...)
+
+	return out
+}
+
+// pending reports whether a partial block is left over
+func (op *operation) pending() bool {
+	return len(op.buf) != 0
+}
+
+// newOperation sets up mechanism m with key and the 8-byte SKIPJACK IV
+func newOperation(m uint, key, iv []byte, decrypt bool) (*operation, error) {
+	b, err := skipjack.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &operation{}
+
+	switch m {
+	case CKM_SKIPJACK_ECB64:
+		if decrypt {
+			op.mode = skipjack.NewECBDecrypter(b)
+		} else {
+			op.mode = skipjack.NewECBEncrypter(b)
+		}
+	case CKM_SKIPJACK_CBC64:
+		if decrypt {
+			op.mode = cipher.NewCBCDecrypter(b, iv)
+		} else {
+			op.mode = cipher.NewCBCEncrypter(b, iv)
+		}
+	case CKM_SKIPJACK_OFB64:
+		op.stream, err = skipjack.NewOFB(b, iv)
+	case CKM_SKIPJACK_CFB64, CKM_SKIPJACK_CFB32, CKM_SKIPJACK_CFB16, CKM_SKIPJACK_CFB8:
+		bits := 64 >> (m - CKM_SKIPJACK_CFB64)
+		if decrypt {
+			op.stream, err = skipjack.NewCFBDecrypter(b, iv, int(bits))
+		} else {
+			op.stream, err = skipjack.NewCFBEncrypter(b, iv, int(bits))
+		}
+	default:
+		return nil, CKR_MECHANISM_INVALID
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return op, nil
+}
+
+// EncryptInit starts an encryption with one of the SKIPJACK encryption
+// mechanisms.  The token generates the IV and writes it into the mechanism
+// parameter, which must be an IVSize-byte slice.
+func (t *Token) EncryptInit(sh SessionHandle, m *Mechanism, key ObjectHandle) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, err := t.session(sh)
+	if err != nil {
+		return err
+	}
+	if s.encrypt != nil {
+		return CKR_OPERATION_ACTIVE
+	}
+
+	k, err := t.key(key, CKO_SECRET_KEY, CKK_SKIPJACK, CKA_ENCRYPT, CKR_KEY_HANDLE_INVALID, CKR_KEY_TYPE_INCONSISTENT)
+	if err != nil {
+		return err
+	}
+
+	iv, ok := m.Parameter.([]byte)
+	if !ok || len(iv) != IVSize {
+		return CKR_MECHANISM_PARAM_INVALID
+	}
+
+	fresh := make([]byte, IVSize)
+	if _, err := io.ReadFull(t.rand(), fresh); err != nil {
+		return err
+	}
+
+	if s.encrypt, err = newOperation(m.Mechanism, k.attrs[CKA_VALUE], fresh[16:], false); err != nil {
+		return err
+	}
+
+	copy(iv, fresh)
+
+	return nil
+}
+
+// Encrypt encrypts data in a single part and ends the operation.
+func (t *Token) Encrypt(sh SessionHandle, data []byte) ([]byte, error) {
+	out, err := t.EncryptUpdate(sh, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := t.EncryptFinal(sh); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// EncryptUpdate continues a multiple-part encryption.
+func (t *Token) EncryptUpdate(sh SessionHandle, data []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, err := t.session(sh)
+	if err != nil {
+		return nil, err
+	}
+	if s.encrypt == nil {
+		return nil, CKR_OPERATION_NOT_INITIALIZED
+	}
+
+	return s.encrypt.update(data), nil
+}
+
+// EncryptFinal ends a multiple-part encryption.  ECB and CBC input must
+// have been a whole number of blocks.
+func (t *Token) EncryptFinal(sh SessionHandle) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, err := t.session(sh)
+	if err != nil {
+		return nil, err
+	}
+	if s.encrypt == nil {
+		return nil, CKR_OPERATION_NOT_INITIALIZED
+	}
+
+	op := s.encrypt
+	s.encrypt = nil
+
+	if op.pending() {
+		return nil, CKR_DATA_LEN_RANGE
+	}
+
+	return []byte{}, nil
+}
+
+// DecryptInit starts a decryption with one of the SKIPJACK encryption
+// mechanisms.  The parameter is the IV produced by EncryptInit.
+func (t *Token) DecryptInit(sh SessionHandle, m *Mechanism, key ObjectHandle) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, err := t.session(sh)
+	if err != nil {
+		return err
+	}
+	if s.decrypt != nil {
+		return CKR_OPERATION_ACTIVE
+	}
+
+	k, err := t.key(key, CKO_SECRET_KEY, CKK_SKIPJACK, CKA_DECRYPT, CKR_KEY_HANDLE_INVALID, CKR_KEY_TYPE_INCONSISTENT)
+	if err != nil {
+		return err
+	}
+
+	iv, ok := m.Parameter.([]byte)
+	if !ok || len(iv) != IVSize {
+		return CKR_MECHANISM_PARAM_INVALID
+	}
+
+	s.decrypt, err = newOperation(m.Mechanism, k.attrs[CKA_VALUE], iv[16:], true)
+
+	return err
+}
+
+// Decrypt decrypts data in a single part and ends the operation.
+func (t *Token) Decrypt(sh SessionHandle, data []byte) ([]byte, error) {
+	out, err := t.DecryptUpdate(sh, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := t.DecryptFinal(sh); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// DecryptUpdate continues a multiple-part decryption.
+func (t *Token) DecryptUpdate(sh SessionHandle, data []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, err := t.session(sh)
+	if err != nil {
+		return nil, err
+	}
+	if s.decrypt == nil {
+		return nil, CKR_OPERATION_NOT_INITIALIZED
+	}
+
+	return s.decrypt.update(data), nil
+}
+
+// DecryptFinal ends a multiple-part decryption.
+func (t *Token) DecryptFinal(sh SessionHandle) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, err := t.session(sh)
+	if err != nil {
+		return nil, err
+	}
+	if s.decrypt == nil {
+		return nil, CKR_OPERATION_NOT_INITIALIZED
+	}
+
+	op := s.decrypt
+	s.decrypt = nil
+
+	if op.pending() {
+		return nil, CKR_ENCRYPTED_DATA_LEN_RANGE
+	}
+
+	return []byte{}, nil
+}
@@ -0,0 +1,120 @@
+package pkcs11
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+func TestEncrypt(t *testing.T) {
+
+	tok := NewToken()
+	sh := tok.OpenSession()
+	h := secretKey(t, tok, sh, testKey)
+
+	b, _ := skipjack.New(testKey)
+
+	msg := make([]byte, 40)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+
+	for _, m := range []uint{
+		CKM_SKIPJACK_ECB64, CKM_SKIPJACK_CBC64, CKM_SKIPJACK_OFB64,
+		CKM_SKIPJACK_CFB64, CKM_SKIPJACK_CFB32, CKM_SKIPJACK_CFB16, CKM_SKIPJACK_CFB8,
+	} {
+		iv := make([]byte, IVSize)
+		if err := tok.EncryptInit(sh, &Mechanism{Mechanism: m, Parameter: iv}, h); err != nil {
+			t.Fatal(err)
+		}
+
+		ct, err := tok.Encrypt(sh, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// check against an independent computation
+		want := make([]byte, len(msg))
+		switch m {
+		case CKM_SKIPJACK_ECB64:
+			for i := 0; i < len(msg); i += 8 {
+				b.Encrypt(want[i:], msg[i:])
+			}
+		case CKM_SKIPJACK_CBC64:
+			cipher.NewCBCEncrypter(b, iv[16:]).CryptBlocks(want, msg)
+		case CKM_SKIPJACK_OFB64:
+			cipher.NewOFB(b, iv[16:]).XORKeyStream(want, msg)
+		default:
+			s, _ := skipjack.NewCFBEncrypter(b, iv[16:], 64>>(m-CKM_SKIPJACK_CFB64))
+			s.XORKeyStream(want, msg)
+		}
+
+		if !bytes.Equal(ct, want) {
+			t.Errorf("pkcs11 mechanism %x encrypt failed: got %x wanted %x\n", m, ct, want)
+		}
+
+		// multiple-part decryption in uneven pieces
+		if err := tok.DecryptInit(sh, &Mechanism{Mechanism: m, Parameter: iv}, h); err != nil {
+			t.Fatal(err)
+		}
+
+		var pt []byte
+		for _, n := range []int{3, 13, 24} {
+			out, err := tok.DecryptUpdate(sh, ct[:n])
+			if err != nil {
+				t.Fatal(err)
+			}
+			pt, ct = append(pt, out...), ct[n:]
+		}
+		if _, err := tok.DecryptFinal(sh); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(pt, msg) {
+			t.Errorf("pkcs11 mechanism %x decrypt failed: got %x wanted %x\n", m, pt, msg)
+		}
+	}
+
+	// block modes need whole blocks
+	iv := make([]byte, IVSize)
+	tok.EncryptInit(sh, &Mechanism{Mechanism: CKM_SKIPJACK_CBC64, Parameter: iv}, h)
+	if _, err := tok.Encrypt(sh, msg[:7]); err != CKR_DATA_LEN_RANGE {
+		t.Errorf("pkcs11 encrypted a partial block: %v\n", err)
+	}
+	if _, err := tok.Encrypt(sh, msg); err != CKR_OPERATION_NOT_INITIALIZED {
+		t.Errorf("pkcs11 failed encryption did not end the operation: %v\n", err)
+	}
+
+	// the IV is chosen by the token
+	iv2 := make([]byte, IVSize)
+	tok.EncryptInit(sh, &Mechanism{Mechanism: CKM_SKIPJACK_CBC64, Parameter: iv2}, h)
+	if bytes.Equal(iv, iv2) {
+		t.Errorf("pkcs11 repeated an IV\n")
+	}
+	if err := tok.EncryptInit(sh, &Mechanism{Mechanism: CKM_SKIPJACK_CBC64, Parameter: iv2}, h); err != CKR_OPERATION_ACTIVE {
+		t.Errorf("pkcs11 started a second encryption: %v\n", err)
+	}
+	tok.EncryptFinal(sh)
+
+	for _, m := range []*Mechanism{
+		{Mechanism: CKM_SKIPJACK_CBC64, Parameter: iv[:8]},
+		{Mechanism: CKM_SKIPJACK_CBC64},
+		{Mechanism: CKM_SKIPJACK_WRAP, Parameter: iv},
+	} {
+		if err := tok.EncryptInit(sh, m, h); err == nil {
+			t.Errorf("pkcs11 accepted mechanism %x with parameter %x\n", m.Mechanism, m.Parameter)
+			tok.EncryptFinal(sh)
+		}
+	}
+
+	// usage attributes are enforced
+	d := secretKey(t, tok, sh, testKey, NewAttribute(CKA_ENCRYPT, false))
+	if err := tok.EncryptInit(sh, &Mechanism{Mechanism: CKM_SKIPJACK_CBC64, Parameter: iv}, d); err != CKR_KEY_FUNCTION_NOT_PERMITTED {
+		t.Errorf("pkcs11 encrypted with a decrypt-only key: %v\n", err)
+	}
+	if err := tok.DecryptInit(sh, &Mechanism{Mechanism: CKM_SKIPJACK_CBC64, Parameter: iv}, d); err != nil {
+		t.Errorf("pkcs11 decrypt-only key failed: %v\n", err)
+	}
+}
@@ -0,0 +1,250 @@
+// Package pkcs11 is a software token exposing the PKCS #11 SKIPJACK
+// mechanisms, for testing middleware written against the FORTEZZA PKCS #11
+// modules.
+/*
+
+   References:
+   RSA Laboratories, "PKCS #11 v2.20: Cryptographic Token Interface
+   Standard", sections 12.35 (SKIPJACK) and 12.36 (KEA)
+   ftp://ftp.rsasecurity.com/pub/pkcs/pkcs-11/v2-20/pkcs-11v2-20.pdf
+
+   The token follows the C interface closely: functions take a session
+   handle and object handles, keys are described by attribute templates,
+   and failures are reported as CKR_ return values.  CK_BBOOL attributes
+   are one byte and CK_ULONG attributes are 8 bytes in host byte order, as
+   in the C interface on 64-bit platforms.
+
+   The SKIPJACK encryption mechanisms take a 24-byte FORTEZZA IV.  As on the
+   cards, the token chooses the IV when encrypting and writes it into the
+   mechanism parameter; the caller passes it back to decrypt.  Only the last
+   8 bytes are the SKIPJACK IV.  The first 16 carry card data, and are random
+   here and ignored on decryption.
+
+   CKM_SKIPJACK_WRAP is not supported: it is the FORTEZZA wrap80
+   algorithm, which was never published.  The format of keys wrapped with
+   CKM_SKIPJACK_PRIVATE_WRAP is card specific and was never published
+   either.
+   This token derives the key-encryption key as the first 80 bits of SHA-1
+   over the wrapping key and the length-prefixed password, public data and
+   random A, and wraps the 20-byte private value with SP 800-38F TKW.
+   CKM_SKIPJACK_RELAYX unwraps and rewraps such a key inside the token.
+
+   Only KEA private keys can be wrapped with CKM_SKIPJACK_PRIVATE_WRAP, and
+   there is no login: every object is visible to every session.
+
+*/
+package pkcs11
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// ObjectHandle identifies an object on the token.  Zero is never a valid
+// handle.
+type ObjectHandle uint
+
+// SessionHandle identifies an open session.  Zero is never a valid handle.
+type SessionHandle uint
+
+// Object classes.
+const (
+	CKO_PRIVATE_KEY = 0x3
+	CKO_SECRET_KEY  = 0x4
+)
+
+// Key types.
+const (
+	CKK_KEA      = 0x5
+	CKK_SKIPJACK = 0x1b
+)
+
+// Attribute types.
+const (
+	CKA_CLASS             = 0x0
+	CKA_TOKEN             = 0x1
+	CKA_PRIVATE           = 0x2
+	CKA_LABEL             = 0x3
+	CKA_VALUE             = 0x11
+	CKA_CHECK_VALUE       = 0x90
+	CKA_KEY_TYPE          = 0x100
+	CKA_ID                = 0x102
+	CKA_SENSITIVE         = 0x103
+	CKA_ENCRYPT           = 0x104
+	CKA_DECRYPT           = 0x105
+	CKA_WRAP              = 0x106
+	CKA_UNWRAP            = 0x107
+	CKA_DERIVE            = 0x10c
+	CKA_PRIME             = 0x130
+	CKA_SUBPRIME          = 0x131
+	CKA_BASE              = 0x132
+	CKA_VALUE_LEN         = 0x161
+	CKA_EXTRACTABLE       = 0x162
+	CKA_NEVER_EXTRACTABLE = 0x164
+	CKA_ALWAYS_SENSITIVE  = 0x165
+	CKA_MODIFIABLE        = 0x170
+)
+
+// SKIPJACK mechanisms.
+const (
+	CKM_SKIPJACK_KEY_GEN      = 0x1000
+	CKM_SKIPJACK_ECB64        = 0x1001
+	CKM_SKIPJACK_CBC64        = 0x1002
+	CKM_SKIPJACK_OFB64        = 0x1003
+	CKM_SKIPJACK_CFB64        = 0x1004
+	CKM_SKIPJACK_CFB32        = 0x1005
+	CKM_SKIPJACK_CFB16        = 0x1006
+	CKM_SKIPJACK_CFB8         = 0x1007
+	CKM_SKIPJACK_WRAP         = 0x1008
+	CKM_SKIPJACK_PRIVATE_WRAP = 0x1009
+	CKM_SKIPJACK_RELAYX       = 0x100a
+)
+
+// IVSize is the length of the parameter of the SKIPJACK encryption
+// mechanisms.
+const IVSize = 24
+
+// Error is a PKCS #11 return value.
+type Error uint
+
+// Return values.
+const (
+	CKR_ARGUMENTS_BAD                    Error = 0x7
+	CKR_ATTRIBUTE_READ_ONLY              Error = 0x10
+	CKR_ATTRIBUTE_SENSITIVE              Error = 0x11
+	CKR_ATTRIBUTE_TYPE_INVALID           Error = 0x12
+	CKR_ATTRIBUTE_VALUE_INVALID          Error = 0x13
+	CKR_DATA_LEN_RANGE                   Error = 0x21
+	CKR_ENCRYPTED_DATA_LEN_RANGE         Error = 0x41
+	CKR_KEY_HANDLE_INVALID               Error = 0x60
+	CKR_KEY_TYPE_INCONSISTENT            Error = 0x63
+	CKR_KEY_FUNCTION_NOT_PERMITTED       Error = 0x68
+	CKR_KEY_NOT_WRAPPABLE                Error = 0x69
+	CKR_KEY_UNEXTRACTABLE                Error = 0x6a
+	CKR_MECHANISM_INVALID                Error = 0x70
+	CKR_MECHANISM_PARAM_INVALID          Error = 0x71
+	CKR_OBJECT_HANDLE_INVALID            Error = 0x82
+	CKR_OPERATION_ACTIVE                 Error = 0x90
+	CKR_OPERATION_NOT_INITIALIZED        Error = 0x91
+	CKR_SESSION_HANDLE_INVALID           Error = 0xb3
+	CKR_TEMPLATE_INCOMPLETE              Error = 0xd0
+	CKR_TEMPLATE_INCONSISTENT            Error = 0xd1
+	CKR_UNWRAPPING_KEY_HANDLE_INVALID    Error = 0xf0
+	CKR_UNWRAPPING_KEY_TYPE_INCONSISTENT Error = 0xf2
+	CKR_WRAPPED_KEY_INVALID              Error = 0x110
+	CKR_WRAPPED_KEY_LEN_RANGE            Error = 0x112
+	CKR_WRAPPING_KEY_HANDLE_INVALID      Error = 0x113
+	CKR_WRAPPING_KEY_TYPE_INCONSISTENT   Error = 0x115
+)
+
+var errorNames = map[Error]string{
+	CKR_ARGUMENTS_BAD:                    "CKR_ARGUMENTS_BAD",
+	CKR_ATTRIBUTE_READ_ONLY:              "CKR_ATTRIBUTE_READ_ONLY",
+	CKR_ATTRIBUTE_SENSITIVE:              "CKR_ATTRIBUTE_SENSITIVE",
+	CKR_ATTRIBUTE_TYPE_INVALID:           "CKR_ATTRIBUTE_TYPE_INVALID",
+	CKR_ATTRIBUTE_VALUE_INVALID:          "CKR_ATTRIBUTE_VALUE_INVALID",
+	CKR_DATA_LEN_RANGE:                   "CKR_DATA_LEN_RANGE",
+	CKR_ENCRYPTED_DATA_LEN_RANGE:         "CKR_ENCRYPTED_DATA_LEN_RANGE",
+	CKR_KEY_HANDLE_INVALID:               "CKR_KEY_HANDLE_INVALID",
+	CKR_KEY_TYPE_INCONSISTENT:            "CKR_KEY_TYPE_INCONSISTENT",
+	CKR_KEY_FUNCTION_NOT_PERMITTED:       "CKR_KEY_FUNCTION_NOT_PERMITTED",
+	CKR_KEY_NOT_WRAPPABLE:                "CKR_KEY_NOT_WRAPPABLE",
+	CKR_KEY_UNEXTRACTABLE:                "CKR_KEY_UNEXTRACTABLE",
+	CKR_MECHANISM_INVALID:                "CKR_MECHANISM_INVALID",
+	CKR_MECHANISM_PARAM_INVALID:          "CKR_MECHANISM_PARAM_INVALID",
+	CKR_OBJECT_HANDLE_INVALID:            "CKR_OBJECT_HANDLE_INVALID",
+	CKR_OPERATION_ACTIVE:                 "CKR_OPERATION_ACTIVE",
+	CKR_OPERATION_NOT_INITIALIZED:        "CKR_OPERATION_NOT_INITIALIZED",
+	CKR_SESSION_HANDLE_INVALID:           "CKR_SESSION_HANDLE_INVALID",
+	CKR_TEMPLATE_INCOMPLETE:              "CKR_TEMPLATE_INCOMPLETE",
+	CKR_TEMPLATE_INCONSISTENT:            "CKR_TEMPLATE_INCONSISTENT",
+	CKR_UNWRAPPING_KEY_HANDLE_INVALID:    "CKR_UNWRAPPING_KEY_HANDLE_INVALID",
+	CKR_UNWRAPPING_KEY_TYPE_INCONSISTENT: "CKR_UNWRAPPING_KEY_TYPE_INCONSISTENT",
+	CKR_WRAPPED_KEY_INVALID:              "CKR_WRAPPED_KEY_INVALID",
+	CKR_WRAPPED_KEY_LEN_RANGE:            "CKR_WRAPPED_KEY_LEN_RANGE",
+	CKR_WRAPPING_KEY_HANDLE_INVALID:      "CKR_WRAPPING_KEY_HANDLE_INVALID",
+	CKR_WRAPPING_KEY_TYPE_INCONSISTENT:   "CKR_WRAPPING_KEY_TYPE_INCONSISTENT",
+}
+
+func (e Error) Error() string {
+	if s, ok := errorNames[e]; ok {
+		return "pkcs11: " + s
+	}
+	return fmt.Sprintf("pkcs11: CKR 0x%x", uint(e))
+}
+
+// Attribute is one entry of an object template.
+type Attribute struct {
+	Type  uint
+	Value []byte
+}
+
+// NewAttribute returns an attribute, encoding v as the C interface would.
+// v may be a bool, an int or uint, a string, a []byte or a *big.Int.
+func NewAttribute(typ uint, v interface{}) Attribute {
+	a := Attribute{Type: typ}
+
+	switch v := v.(type) {
+	case bool:
+		a.Value = boolValue(v)
+	case int:
+		a.Value = ulongValue(uint(v))
+	case uint:
+		a.Value = ulongValue(v)
+	case string:
+		a.Value = []byte(v)
+	case []byte:
+		a.Value = append([]byte(nil), v...)
+	case *big.Int:
+		a.Value = v.Bytes()
+	default:
+		panic(fmt.Sprintf("pkcs11: unsupported attribute value %T", v))
+	}
+
+	return a
+}
+
+func boolValue(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func ulongValue(v uint) []byte {
+	b := make([]byte, 8)
+	binary.NativeEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+// Mechanism selects a mechanism and its parameter.  The encryption
+// mechanisms take a []byte of IVSize bytes, CKM_SKIPJACK_PRIVATE_WRAP a
+// *PrivateWrapParams and CKM_SKIPJACK_RELAYX a *RelayXParams.  The others
+// take no parameter.
+type Mechanism struct {
+	Mechanism uint
+	Parameter interface{}
+}
+
+// PrivateWrapParams is CK_SKIPJACK_PRIVATE_WRAP_PARAMS.  PrimeP, BaseG and
+// SubprimeQ are needed only to unwrap.
+type PrivateWrapParams struct {
+	Password   []byte
+	PublicData []byte
+	RandomA    []byte
+	PrimeP     []byte
+	BaseG      []byte
+	SubprimeQ  []byte
+}
+
+// RelayXParams is CK_SKIPJACK_RELAYX_PARAMS.
+type RelayXParams struct {
+	OldWrappedX   []byte
+	OldPassword   []byte
+	OldPublicData []byte
+	OldRandomA    []byte
+	NewPassword   []byte
+	NewPublicData []byte
+	NewRandomA    []byte
+}
@@ -0,0 +1,528 @@
+package pkcs11
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/Phraxos/go-skipjack"
+	"github.com/Phraxos/go-skipjack/kea"
+)
+
+// how a key came to be on the token, which fixes CKA_ALWAYS_SENSITIVE and
+// CKA_NEVER_EXTRACTABLE
+const (
+	imported = iota
+	generated
+	unwrapped
+)
+
+type attributeKind int
+
+const (
+	kindBool attributeKind = iota
+	kindUlong
+	kindBytes
+)
+
+var attributeKinds = map[uint]attributeKind{
+	CKA_CLASS:             kindUlong,
+	CKA_TOKEN:             kindBool,
+	CKA_PRIVATE:           kindBool,
+	CKA_LABEL:             kindBytes,
+	CKA_VALUE:             kindBytes,
+	CKA_CHECK_VALUE:       kindBytes,
+	CKA_KEY_TYPE:          kindUlong,
+	CKA_ID:                kindBytes,
+	CKA_SENSITIVE:         kindBool,
+	CKA_ENCRYPT:           kindBool,
+	CKA_DECRYPT:           kindBool,
+	CKA_WRAP:              kindBool,
+	CKA_UNWRAP:            kindBool,
+	CKA_DERIVE:            kindBool,
+	CKA_PRIME:             kindBytes,
+	CKA_SUBPRIME:          kindBytes,
+	CKA_BASE:              kindBytes,
+	CKA_VALUE_LEN:         kindUlong,
+	CKA_EXTRACTABLE:       kindBool,
+	CKA_NEVER_EXTRACTABLE: kindBool,
+	CKA_ALWAYS_SENSITIVE:  kindBool,
+	CKA_MODIFIABLE:        kindBool,
+}
+
+// attributes which only the token sets
+var tokenSet = map[uint]bool{
+	CKA_NEVER_EXTRACTABLE: true,
+	CKA_ALWAYS_SENSITIVE:  true,
+}
+
+// attributes which cannot be changed after creation
+var fixed = map[uint]bool{
+	CKA_CLASS:             true,
+	CKA_TOKEN:             true,
+	CKA_PRIVATE:           true,
+	CKA_VALUE:             true,
+	CKA_CHECK_VALUE:       true,
+	CKA_KEY_TYPE:          true,
+	CKA_PRIME:             true,
+	CKA_SUBPRIME:          true,
+	CKA_BASE:              true,
+	CKA_VALUE_LEN:         true,
+	CKA_NEVER_EXTRACTABLE: true,
+	CKA_ALWAYS_SENSITIVE:  true,
+	CKA_MODIFIABLE:        true,
+}
+
+// the attributes each class may have, and their defaults
+var classDefaults = map[uint]map[uint][]byte{
+	CKO_SECRET_KEY: {
+		CKA_TOKEN:       boolValue(false),
+		CKA_PRIVATE:     boolValue(false),
+		CKA_MODIFIABLE:  boolValue(true),
+		CKA_LABEL:       {},
+		CKA_ID:          {},
+		CKA_SENSITIVE:   boolValue(false),
+		CKA_EXTRACTABLE: boolValue(true),
+		CKA_ENCRYPT:     boolValue(true),
+		CKA_DECRYPT:     boolValue(true),
+		CKA_WRAP:        boolValue(true),
+		CKA_UNWRAP:      boolValue(true),
+		CKA_VALUE_LEN:   ulongValue(keySize),
+		CKA_CHECK_VALUE: {},
+	},
+	CKO_PRIVATE_KEY: {
+		CKA_TOKEN:       boolValue(false),
+		CKA_PRIVATE:     boolValue(false),
+		CKA_MODIFIABLE:  boolValue(true),
+		CKA_LABEL:       {},
+		CKA_ID:          {},
+		CKA_SENSITIVE:   boolValue(false),
+		CKA_EXTRACTABLE: boolValue(true),
+		CKA_DERIVE:      boolValue(true),
+		CKA_PRIME:       nil,
+		CKA_SUBPRIME:    nil,
+		CKA_BASE:        nil,
+	},
+}
+
+var classKeyType = map[uint]uint{
+	CKO_SECRET_KEY:  CKK_SKIPJACK,
+	CKO_PRIVATE_KEY: CKK_KEA,
+}
+
+// the length of a SKIPJACK key
+const keySize = 10
+
+type object struct {
+	session SessionHandle // zero for token objects
+	attrs   map[uint][]byte
+}
+
+func (o *object) bool(typ uint) bool {
+	v := o.attrs[typ]
+	return len(v) == 1 && v[0] != 0
+}
+
+func (o *object) ulong(typ uint) uint {
+	return uint(binary.NativeEndian.Uint64(o.attrs[typ]))
+}
+
+func (o *object) is(class, keyType uint) bool {
+	return o.ulong(CKA_CLASS) == class && o.ulong(CKA_KEY_TYPE) == keyType
+}
+
+// keaKey rebuilds the KEA key pair of a private key object
+func (o *object) keaKey() *kea.PrivateKey {
+	k := &kea.PrivateKey{X: new(big.Int).SetBytes(o.attrs[CKA_VALUE])}
+	k.P = new(big.Int).SetBytes(o.attrs[CKA_PRIME])
+	k.Q = new(big.Int).SetBytes(o.attrs[CKA_SUBPRIME])
+	k.G = new(big.Int).SetBytes(o.attrs[CKA_BASE])
+	k.Y = new(big.Int).Exp(k.G, k.X, k.P)
+	return k
+}
+
+type session struct {
+	encrypt *operation
+	decrypt *operation
+}
+
+// Token is a software token.  It is safe for concurrent use.
+type Token struct {
+	// Rand is the source of generated keys and IVs.  If nil, crypto/rand
+	// is used.
+	Rand io.Reader
+
+	mu          sync.Mutex
+	objects     map[ObjectHandle]*object
+	sessions    map[SessionHandle]*session
+	nextObject  ObjectHandle
+	nextSession SessionHandle
+}
+
+// NewToken returns an empty token.
+func NewToken() *Token {
+	return &Token{
+		objects:  make(map[ObjectHandle]*object),
+		sessions: make(map[SessionHandle]*session),
+	}
+}
+
+func (t *Token) rand() io.Reader {
+	if t.Rand == nil {
+		return rand.Reader
+	}
+	return t.Rand
+}
+
+// GetMechanismList returns the mechanisms the token supports.
+func (t *Token) GetMechanismList() []uint {
+	return []uint{
+		CKM_SKIPJACK_KEY_GEN,
+		CKM_SKIPJACK_ECB64,
+		CKM_SKIPJACK_CBC64,
+		CKM_SKIPJACK_OFB64,
+		CKM_SKIPJACK_CFB64,
+		CKM_SKIPJACK_CFB32,
+		CKM_SKIPJACK_CFB16,
+		CKM_SKIPJACK_CFB8,
+		CKM_SKIPJACK_PRIVATE_WRAP,
+		CKM_SKIPJACK_RELAYX,
+	}
+}
+
+// OpenSession opens a session.
+func (t *Token) OpenSession() SessionHandle {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextSession++
+	t.sessions[t.nextSession] = &session{}
+
+	return t.nextSession
+}
+
+// CloseSession closes a session and destroys its session objects.
+func (t *Token) CloseSession(sh SessionHandle) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.sessions[sh]; !ok {
+		return CKR_SESSION_HANDLE_INVALID
+	}
+
+	delete(t.sessions, sh)
+	for h, o := range t.objects {
+		if o.session == sh {
+			delete(t.objects, h)
+		}
+	}
+
+	return nil
+}
+
+func (t *Token) session(sh SessionHandle) (*session, error) {
+	s, ok := t.sessions[sh]
+	if !ok {
+		return nil, CKR_SESSION_HANDLE_INVALID
+	}
+	return s, nil
+}
+
+// key looks up a key for an operation, returning invalid if there is no
+// such object and inconsistent if it is not of the given class and type.
+// The usage attribute must be set.
+func (t *Token) key(h ObjectHandle, class, keyType, usage uint, invalid, inconsistent Error) (*object, error) {
+	o, ok := t.objects[h]
+	if !ok {
+		return nil, invalid
+	}
+	if !o.is(class, keyType) {
+		return nil, inconsistent
+	}
+	if !o.bool(usage) {
+		return nil, CKR_KEY_FUNCTION_NOT_PERMITTED
+	}
+	return o, nil
+}
+
+// newObject checks the template for a key of the given class and stores
+// it.  values holds attributes computed by the token, such as a generated
+// key value.
+func (t *Token) newObject(sh SessionHandle, class uint, origin int, tmpl []Attribute, values map[uint][]byte) (ObjectHandle, error) {
+	defaults, ok := classDefaults[class]
+	if !ok {
+		return 0, CKR_TEMPLATE_INCONSISTENT
+	}
+
+	o := &object{attrs: map[uint][]byte{
+		CKA_CLASS:    ulongValue(class),
+		CKA_KEY_TYPE: ulongValue(classKeyType[class]),
+		CKA_VALUE:    nil,
+	}}
+	for typ, v := range defaults {
+		o.attrs[typ] = v
+	}
+
+	for _, a := range tmpl {
+		if err := checkAttribute(a); err != nil {
+			return 0, err
+		}
+		if _, ok := o.attrs[a.Type]; !ok {
+			return 0, CKR_ATTRIBUTE_TYPE_INVALID
+		}
+		if tokenSet[a.Type] {
+			return 0, CKR_ATTRIBUTE_READ_ONLY
+		}
+		if (a.Type == CKA_CLASS || a.Type == CKA_KEY_TYPE || a.Type == CKA_VALUE_LEN) && !bytes.Equal(a.Value, o.attrs[a.Type]) {
+			return 0, CKR_TEMPLATE_INCONSISTENT
+		}
+		if _, ok := values[a.Type]; ok {
+			return 0, CKR_TEMPLATE_INCONSISTENT
+		}
+		o.attrs[a.Type] = append([]byte(nil), a.Value...)
+	}
+
+	for typ, v := range values {
+		o.attrs[typ] = v
+	}
+
+	for _, v := range o.attrs {
+		if v == nil {
+			return 0, CKR_TEMPLATE_INCOMPLETE
+		}
+	}
+
+	if err := checkKey(o); err != nil {
+		return 0, err
+	}
+
+	o.attrs[CKA_ALWAYS_SENSITIVE] = boolValue(origin == generated && o.bool(CKA_SENSITIVE))
+	o.attrs[CKA_NEVER_EXTRACTABLE] = boolValue(origin == generated && !o.bool(CKA_EXTRACTABLE))
+
+	if !o.bool(CKA_TOKEN) {
+		o.session = sh
+	}
+
+	t.nextObject++
+	t.objects[t.nextObject] = o
+
+	return t.nextObject, nil
+}
+
+// checkAttribute checks the encoding of a template entry
+func checkAttribute(a Attribute) error {
+	kind, ok := attributeKinds[a.Type]
+	if !ok {
+		return CKR_ATTRIBUTE_TYPE_INVALID
+	}
+
+	switch kind {
+	case kindBool:
+		if len(a.Value) != 1 || a.Value[0] > 1 {
+			return CKR_ATTRIBUTE_VALUE_INVALID
+		}
+	case kindUlong:
+		if len(a.Value) != 8 {
+			return CKR_ATTRIBUTE_VALUE_INVALID
+		}
+	}
+
+	return nil
+}
+
+// checkKey checks the key material of a new object.  A secret key must
+// match any CKA_CHECK_VALUE given in the template, and gets its check value
+// set.
+func checkKey(o *object) error {
+	if o.ulong(CKA_CLASS) == CKO_SECRET_KEY {
+		key := o.attrs[CKA_VALUE]
+		if len(key) != keySize {
+			return CKR_ATTRIBUTE_VALUE_INVALID
+		}
+		if kcv := o.attrs[CKA_CHECK_VALUE]; len(kcv) != 0 && skipjack.VerifyKCV(key, kcv) != nil {
+			return CKR_ATTRIBUTE_VALUE_INVALID
+		}
+		o.attrs[CKA_CHECK_VALUE], _ = skipjack.KCV(key)
+		return nil
+	}
+
+	k := o.keaKey()
+	if k.Parameters.Validate() != nil || k.X.Sign() <= 0 || k.X.Cmp(k.Q) >= 0 {
+		return CKR_ATTRIBUTE_VALUE_INVALID
+	}
+
+	return nil
+}
+
+// CreateObject imports a SKIPJACK secret key or a KEA private key.  The
+// template must give CKA_CLASS, and CKA_VALUE; KEA keys also need
+// CKA_PRIME, CKA_SUBPRIME and CKA_BASE.  If a SKIPJACK key's template
+// gives CKA_CHECK_VALUE, the key must match it.
+func (t *Token) CreateObject(sh SessionHandle, tmpl []Attribute) (ObjectHandle, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.session(sh); err != nil {
+		return 0, err
+	}
+
+	for _, a := range tmpl {
+		if a.Type == CKA_CLASS {
+			if len(a.Value) != 8 {
+				return 0, CKR_ATTRIBUTE_VALUE_INVALID
+			}
+			return t.newObject(sh, uint(binary.NativeEndian.Uint64(a.Value)), imported, tmpl, nil)
+		}
+	}
+
+	return 0, CKR_TEMPLATE_INCOMPLETE
+}
+
+// DestroyObject destroys an object.
+func (t *Token) DestroyObject(sh SessionHandle, h ObjectHandle) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.session(sh); err != nil {
+		return err
+	}
+
+	if _, ok := t.objects[h]; !ok {
+		return CKR_OBJECT_HANDLE_INVALID
+	}
+
+	delete(t.objects, h)
+
+	return nil
+}
+
+// FindObjects returns the objects whose attributes match every entry of
+// the template, in handle order.
+func (t *Token) FindObjects(sh SessionHandle, tmpl []Attribute) ([]ObjectHandle, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.session(sh); err != nil {
+		return nil, err
+	}
+
+	var hs []ObjectHandle
+
+next:
+	for h, o := range t.objects {
+		for _, a := range tmpl {
+			if v, ok := o.attrs[a.Type]; !ok || !bytes.Equal(v, a.Value) {
+				continue next
+			}
+		}
+		hs = append(hs, h)
+	}
+
+	sort.Slice(hs, func(i, j int) bool { return hs[i] < hs[j] })
+
+	return hs, nil
+}
+
+// GetAttributeValue returns the requested attributes of an object.  If some
+// cannot be returned, their values are nil and the error says why.  The
+// value of a sensitive or unextractable key cannot be read.
+func (t *Token) GetAttributeValue(sh SessionHandle, h ObjectHandle, types []uint) ([]Attribute, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.session(sh); err != nil {
+		return nil, err
+	}
+
+	o, ok := t.objects[h]
+	if !ok {
+		return nil, CKR_OBJECT_HANDLE_INVALID
+	}
+
+	var err error
+	attrs := make([]Attribute, len(types))
+
+	for i, typ := range types {
+		attrs[i].Type = typ
+
+		v, ok := o.attrs[typ]
+		switch {
+		case !ok:
+			err = CKR_ATTRIBUTE_TYPE_INVALID
+		case typ == CKA_VALUE && (o.bool(CKA_SENSITIVE) || !o.bool(CKA_EXTRACTABLE)):
+			err = CKR_ATTRIBUTE_SENSITIVE
+		default:
+			attrs[i].Value = append([]byte(nil), v...)
+		}
+	}
+
+	return attrs, err
+}
+
+// SetAttributeValue changes attributes of an object.  CKA_SENSITIVE can
+// only be turned on and CKA_EXTRACTABLE only turned off.
+func (t *Token) SetAttributeValue(sh SessionHandle, h ObjectHandle, tmpl []Attribute) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.session(sh); err != nil {
+		return err
+	}
+
+	o, ok := t.objects[h]
+	if !ok {
+		return CKR_OBJECT_HANDLE_INVALID
+	}
+
+	for _, a := range tmpl {
+		if err := checkAttribute(a); err != nil {
+			return err
+		}
+		if _, ok := o.attrs[a.Type]; !ok {
+			return CKR_ATTRIBUTE_TYPE_INVALID
+		}
+		if !o.bool(CKA_MODIFIABLE) || fixed[a.Type] {
+			return CKR_ATTRIBUTE_READ_ONLY
+		}
+		if a.Type == CKA_SENSITIVE && o.bool(CKA_SENSITIVE) && a.Value[0] == 0 {
+			return CKR_ATTRIBUTE_READ_ONLY
+		}
+		if a.Type == CKA_EXTRACTABLE && !o.bool(CKA_EXTRACTABLE) && a.Value[0] == 1 {
+			return CKR_ATTRIBUTE_READ_ONLY
+		}
+	}
+
+	for _, a := range tmpl {
+		o.attrs[a.Type] = append([]byte(nil), a.Value...)
+	}
+
+	return nil
+}
+
+// GenerateKey generates a SKIPJACK key with CKM_SKIPJACK_KEY_GEN.
+func (t *Token) GenerateKey(sh SessionHandle, m *Mechanism, tmpl []Attribute) (ObjectHandle, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.session(sh); err != nil {
+		return 0, err
+	}
+
+	if m.Mechanism != CKM_SKIPJACK_KEY_GEN {
+		return 0, CKR_MECHANISM_INVALID
+	}
+	if m.Parameter != nil {
+		return 0, CKR_MECHANISM_PARAM_INVALID
+	}
+
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(t.rand(), key); err != nil {
+		return 0, err
+	}
+
+	return t.newObject(sh, CKO_SECRET_KEY, generated, tmpl, map[uint][]byte{CKA_VALUE: key})
+}
@@ -0,0 +1,171 @@
+package pkcs11
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/Phraxos/go-skipjack"
+	"github.com/Phraxos/go-skipjack/kea"
+)
+
+func fromHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("bad hex: " + s)
+	}
+	return n
+}
+
+var testParameters = kea.Parameters{
+	P: fromHex("a07377e4d4eae2231e2329aad6e0ad41015d12b4791fd3fb1ca22c4d3667be43d09c91917f4106b9843247182c6662a7db0f529a0a184a6b7f2b6f4e53e9c30471b5adeaed57f2f4d494f839978fe245a4a00a9a9e18e32f5ad8a66a9bd45a41b30fa9acda5dcad72df214bc64cf43ff5483721f2d5aa6b809da64e963863b7f"),
+	Q: fromHex("e9d6762f5173237c26b61ee6efa8a4df7cddc11b"),
+	G: fromHex("23afd9da2f7e1337006c5d32fcc28502263442bfbf07e967d0e9b8adce6f7f013986c5900a5dbc8daae7a3a02d6e06680bd476315c47f8d521c3e060879d93656405dddf19f800078ccf68cf798e493dba27775de1100179c0ab0c5144361a1b0ca438e3f2ac99b821308e03f3f723c2fa9bbe00201aa82f0c9ba90ab5969e78"),
+}
+
+var testKey = []byte{0x00, 0x99, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11}
+
+func secretKey(t *testing.T, tok *Token, sh SessionHandle, value []byte, attrs ...Attribute) ObjectHandle {
+	tmpl := append([]Attribute{
+		NewAttribute(CKA_CLASS, CKO_SECRET_KEY),
+		NewAttribute(CKA_KEY_TYPE, CKK_SKIPJACK),
+		NewAttribute(CKA_VALUE, value),
+	}, attrs...)
+
+	h, err := tok.CreateObject(sh, tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func keaKey(t *testing.T, tok *Token, sh SessionHandle, attrs ...Attribute) (ObjectHandle, *kea.PrivateKey) {
+	k, err := kea.GenerateKey(&testParameters, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := append([]Attribute{
+		NewAttribute(CKA_CLASS, CKO_PRIVATE_KEY),
+		NewAttribute(CKA_KEY_TYPE, CKK_KEA),
+		NewAttribute(CKA_PRIME, k.P),
+		NewAttribute(CKA_SUBPRIME, k.Q),
+		NewAttribute(CKA_BASE, k.G),
+		NewAttribute(CKA_VALUE, k.X),
+	}, attrs...)
+
+	h, err := tok.CreateObject(sh, tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, k
+}
+
+func TestObjects(t *testing.T) {
+
+	tok := NewToken()
+	sh := tok.OpenSession()
+
+	h := secretKey(t, tok, sh, testKey, NewAttribute(CKA_LABEL, "test"))
+
+	attrs, err := tok.GetAttributeValue(sh, h, []uint{CKA_VALUE, CKA_LABEL, CKA_VALUE_LEN, CKA_ALWAYS_SENSITIVE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(attrs[0].Value, testKey) || string(attrs[1].Value) != "test" ||
+		!bytes.Equal(attrs[2].Value, ulongValue(10)) || attrs[3].Value[0] != 0 {
+		t.Errorf("pkcs11 attributes failed: got %x\n", attrs)
+	}
+
+	// sensitive keys cannot be read, and stay sensitive
+	if err := tok.SetAttributeValue(sh, h, []Attribute{NewAttribute(CKA_SENSITIVE, true)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tok.GetAttributeValue(sh, h, []uint{CKA_VALUE}); err != CKR_ATTRIBUTE_SENSITIVE {
+		t.Errorf("pkcs11 read a sensitive key: %v\n", err)
+	}
+	if err := tok.SetAttributeValue(sh, h, []Attribute{NewAttribute(CKA_SENSITIVE, false)}); err != CKR_ATTRIBUTE_READ_ONLY {
+		t.Errorf("pkcs11 cleared CKA_SENSITIVE: %v\n", err)
+	}
+	if err := tok.SetAttributeValue(sh, h, []Attribute{NewAttribute(CKA_VALUE, testKey)}); err != CKR_ATTRIBUTE_READ_ONLY {
+		t.Errorf("pkcs11 changed CKA_VALUE: %v\n", err)
+	}
+
+	// but their check value can, and is checked on import
+	kcv, _ := skipjack.KCV(testKey)
+	if attrs, err := tok.GetAttributeValue(sh, h, []uint{CKA_CHECK_VALUE}); err != nil || !bytes.Equal(attrs[0].Value, kcv) {
+		t.Errorf("pkcs11 check value failed: got %x wanted %x (%v)\n", attrs[0].Value, kcv, err)
+	}
+	secretKey(t, tok, sh, testKey, NewAttribute(CKA_CHECK_VALUE, kcv))
+
+	kcv[0] ^= 1
+	if _, err := tok.CreateObject(sh, []Attribute{
+		NewAttribute(CKA_CLASS, CKO_SECRET_KEY),
+		NewAttribute(CKA_VALUE, testKey),
+		NewAttribute(CKA_CHECK_VALUE, kcv),
+	}); err != CKR_ATTRIBUTE_VALUE_INVALID {
+		t.Errorf("pkcs11 imported a key with the wrong check value: %v\n", err)
+	}
+
+	// generated keys
+	g, err := tok.GenerateKey(sh, &Mechanism{Mechanism: CKM_SKIPJACK_KEY_GEN}, []Attribute{
+		NewAttribute(CKA_SENSITIVE, true),
+		NewAttribute(CKA_EXTRACTABLE, false),
+		NewAttribute(CKA_TOKEN, true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs, _ = tok.GetAttributeValue(sh, g, []uint{CKA_ALWAYS_SENSITIVE, CKA_NEVER_EXTRACTABLE})
+	if attrs[0].Value[0] != 1 || attrs[1].Value[0] != 1 {
+		t.Errorf("pkcs11 generated key attributes failed: got %x\n", attrs)
+	}
+	if err := tok.SetAttributeValue(sh, g, []Attribute{NewAttribute(CKA_EXTRACTABLE, true)}); err != CKR_ATTRIBUTE_READ_ONLY {
+		t.Errorf("pkcs11 set CKA_EXTRACTABLE: %v\n", err)
+	}
+
+	// templates
+	for _, tmpl := range [][]Attribute{
+		{NewAttribute(CKA_KEY_TYPE, CKK_KEA)},
+		{NewAttribute(CKA_ALWAYS_SENSITIVE, true)},
+		{NewAttribute(CKA_VALUE, testKey)},
+		{NewAttribute(CKA_PRIME, 7)},
+		{{Type: CKA_SENSITIVE, Value: []byte{2}}},
+	} {
+		if _, err := tok.GenerateKey(sh, &Mechanism{Mechanism: CKM_SKIPJACK_KEY_GEN}, tmpl); err == nil {
+			t.Errorf("pkcs11 generated a key with template %x\n", tmpl)
+		}
+	}
+	if _, err := tok.CreateObject(sh, []Attribute{NewAttribute(CKA_CLASS, CKO_SECRET_KEY)}); err != CKR_TEMPLATE_INCOMPLETE {
+		t.Errorf("pkcs11 created a key with no value: %v\n", err)
+	}
+	if _, err := tok.CreateObject(sh, []Attribute{NewAttribute(CKA_CLASS, CKO_SECRET_KEY), NewAttribute(CKA_VALUE, testKey[:8])}); err != CKR_ATTRIBUTE_VALUE_INVALID {
+		t.Errorf("pkcs11 created a short key: %v\n", err)
+	}
+
+	p, _ := keaKey(t, tok, sh, NewAttribute(CKA_LABEL, "test"))
+
+	if hs, _ := tok.FindObjects(sh, []Attribute{NewAttribute(CKA_LABEL, "test")}); len(hs) != 2 || hs[0] != h || hs[1] != p {
+		t.Errorf("pkcs11 find failed: got %v\n", hs)
+	}
+
+	// session objects go with the session, token objects stay
+	tok.CloseSession(sh)
+	sh = tok.OpenSession()
+
+	if hs, _ := tok.FindObjects(sh, nil); len(hs) != 1 || hs[0] != g {
+		t.Errorf("pkcs11 close session failed: got %v\n", hs)
+	}
+
+	if err := tok.DestroyObject(sh, g); err != nil {
+		t.Fatal(err)
+	}
+	if err := tok.DestroyObject(sh, g); err != CKR_OBJECT_HANDLE_INVALID {
+		t.Errorf("pkcs11 destroyed an object twice: %v\n", err)
+	}
+	if _, err := tok.FindObjects(sh+1, nil); err != CKR_SESSION_HANDLE_INVALID {
+		t.Errorf("pkcs11 accepted a bad session: %v\n", err)
+	}
+}
@@ -0,0 +1,161 @@
+package pkcs11
+
+import (
+	"crypto/sha1"
+	"math/big"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// the length of a KEA private value, and so of its TKW plaintext
+const privateValueSize = 20
+
+// privateKEK derives the key-encryption key for CKM_SKIPJACK_PRIVATE_WRAP
+func privateKEK(key, password, publicData, randomA []byte) []byte {
+	h := sha1.New()
+	h.Write(key)
+	for _, v := range [][]byte{password, publicData, randomA} {
+		h.Write([]byte{byte(len(v) >> 8), byte(len(v))})
+		h.Write(v)
+	}
+	return h.Sum(nil)[:keySize]
+}
+
+func wrapPrivate(key, password, publicData, randomA []byte, x *big.Int) ([]byte, error) {
+	b := make([]byte, privateValueSize)
+	return skipjack.WrapTKW(privateKEK(key, password, publicData, randomA), x.FillBytes(b))
+}
+
+func unwrapPrivate(key, password, publicData, randomA, wrapped []byte) ([]byte, error) {
+	if len(wrapped) != privateValueSize+4 {
+		return nil, CKR_WRAPPED_KEY_LEN_RANGE
+	}
+
+	x, err := skipjack.UnwrapTKW(privateKEK(key, password, publicData, randomA), wrapped)
+	if err != nil {
+		return nil, CKR_WRAPPED_KEY_INVALID
+	}
+
+	return x, nil
+}
+
+// WrapKey wraps key under wrappingKey.  With CKM_SKIPJACK_PRIVATE_WRAP key
+// is a KEA private key, and the parameter's PublicData must be its public
+// value.  With CKM_SKIPJACK_RELAYX key is ignored, and the result is the
+// parameter's OldWrappedX rewrapped with the new password, public data and
+// random A.  CKM_SKIPJACK_WRAP gives CKR_MECHANISM_INVALID.
+func (t *Token) WrapKey(sh SessionHandle, m *Mechanism, wrappingKey, key ObjectHandle) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.session(sh); err != nil {
+		return nil, err
+	}
+
+	w, err := t.key(wrappingKey, CKO_SECRET_KEY, CKK_SKIPJACK, CKA_WRAP, CKR_WRAPPING_KEY_HANDLE_INVALID, CKR_WRAPPING_KEY_TYPE_INCONSISTENT)
+	if err != nil {
+		return nil, err
+	}
+	kek := w.attrs[CKA_VALUE]
+
+	if m.Mechanism == CKM_SKIPJACK_RELAYX {
+		p, ok := m.Parameter.(*RelayXParams)
+		if !ok {
+			return nil, CKR_MECHANISM_PARAM_INVALID
+		}
+		if !w.bool(CKA_UNWRAP) {
+			return nil, CKR_KEY_FUNCTION_NOT_PERMITTED
+		}
+
+		x, err := unwrapPrivate(kek, p.OldPassword, p.OldPublicData, p.OldRandomA, p.OldWrappedX)
+		if err != nil {
+			return nil, err
+		}
+
+		return skipjack.WrapTKW(privateKEK(kek, p.NewPassword, p.NewPublicData, p.NewRandomA), x)
+	}
+
+	k, ok := t.objects[key]
+	if !ok {
+		return nil, CKR_KEY_HANDLE_INVALID
+	}
+	if !k.bool(CKA_EXTRACTABLE) {
+		return nil, CKR_KEY_UNEXTRACTABLE
+	}
+
+	switch m.Mechanism {
+	case CKM_SKIPJACK_PRIVATE_WRAP:
+		p, ok := m.Parameter.(*PrivateWrapParams)
+		if !ok {
+			return nil, CKR_MECHANISM_PARAM_INVALID
+		}
+		if !k.is(CKO_PRIVATE_KEY, CKK_KEA) {
+			return nil, CKR_KEY_NOT_WRAPPABLE
+		}
+
+		priv := k.keaKey()
+		if new(big.Int).SetBytes(p.PublicData).Cmp(priv.Y) != 0 {
+			return nil, CKR_MECHANISM_PARAM_INVALID
+		}
+
+		return wrapPrivate(kek, p.Password, p.PublicData, p.RandomA, priv.X)
+	}
+
+	return nil, CKR_MECHANISM_INVALID
+}
+
+// UnwrapKey unwraps a key wrapped by WrapKey and creates an object for it
+// from the template.  With CKM_SKIPJACK_PRIVATE_WRAP the parameter must
+// also give the domain parameters, and the unwrapped key must match the
+// public data.
+func (t *Token) UnwrapKey(sh SessionHandle, m *Mechanism, unwrappingKey ObjectHandle, wrapped []byte, tmpl []Attribute) (ObjectHandle, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.session(sh); err != nil {
+		return 0, err
+	}
+
+	w, err := t.key(unwrappingKey, CKO_SECRET_KEY, CKK_SKIPJACK, CKA_UNWRAP, CKR_UNWRAPPING_KEY_HANDLE_INVALID, CKR_UNWRAPPING_KEY_TYPE_INCONSISTENT)
+	if err != nil {
+		return 0, err
+	}
+	kek := w.attrs[CKA_VALUE]
+
+	switch m.Mechanism {
+	case CKM_SKIPJACK_PRIVATE_WRAP:
+		p, ok := m.Parameter.(*PrivateWrapParams)
+		if !ok {
+			return 0, CKR_MECHANISM_PARAM_INVALID
+		}
+
+		x, err := unwrapPrivate(kek, p.Password, p.PublicData, p.RandomA, wrapped)
+		if err != nil {
+			return 0, err
+		}
+
+		values := map[uint][]byte{
+			CKA_VALUE:    x,
+			CKA_PRIME:    p.PrimeP,
+			CKA_SUBPRIME: p.SubprimeQ,
+			CKA_BASE:     p.BaseG,
+		}
+
+		h, err := t.newObject(sh, CKO_PRIVATE_KEY, unwrapped, tmpl, values)
+		if err == CKR_ATTRIBUTE_VALUE_INVALID {
+			return 0, CKR_MECHANISM_PARAM_INVALID
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if t.objects[h].keaKey().Y.Cmp(new(big.Int).SetBytes(p.PublicData)) != 0 {
+			delete(t.objects, h)
+			return 0, CKR_WRAPPED_KEY_INVALID
+		}
+
+		return h, nil
+	}
+
+	return 0, CKR_MECHANISM_INVALID
+}
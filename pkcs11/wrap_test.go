@@ -0,0 +1,121 @@
+package pkcs11
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+func TestWrapKey(t *testing.T) {
+
+	tok := NewToken()
+	sh := tok.OpenSession()
+
+	kek := secretKey(t, tok, sh, testKey)
+	k := secretKey(t, tok, sh, []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23})
+
+	// the FORTEZZA wrap80 behind CKM_SKIPJACK_WRAP is not public
+	m := &Mechanism{Mechanism: CKM_SKIPJACK_WRAP}
+
+	for _, v := range tok.GetMechanismList() {
+		if v == CKM_SKIPJACK_WRAP {
+			t.Errorf("pkcs11 lists CKM_SKIPJACK_WRAP\n")
+		}
+	}
+
+	if _, err := tok.WrapKey(sh, m, kek, k); err != CKR_MECHANISM_INVALID {
+		t.Errorf("pkcs11 wrapped with CKM_SKIPJACK_WRAP: %v\n", err)
+	}
+	if _, err := tok.UnwrapKey(sh, m, kek, make([]byte, 12), nil); err != CKR_MECHANISM_INVALID {
+		t.Errorf("pkcs11 unwrapped with CKM_SKIPJACK_WRAP: %v\n", err)
+	}
+
+	// the keys are checked before the mechanism
+	u := secretKey(t, tok, sh, testKey, NewAttribute(CKA_WRAP, false))
+	if _, err := tok.WrapKey(sh, m, u, k); err != CKR_KEY_FUNCTION_NOT_PERMITTED {
+		t.Errorf("pkcs11 wrapped with a key without CKA_WRAP: %v\n", err)
+	}
+
+	tok.SetAttributeValue(sh, k, []Attribute{NewAttribute(CKA_EXTRACTABLE, false)})
+	if _, err := tok.WrapKey(sh, m, kek, k); err != CKR_KEY_UNEXTRACTABLE {
+		t.Errorf("pkcs11 wrapped an unextractable key: %v\n", err)
+	}
+}
+
+func TestPrivateWrap(t *testing.T) {
+
+	tok := NewToken()
+	sh := tok.OpenSession()
+
+	kek := secretKey(t, tok, sh, testKey)
+	h, k := keaKey(t, tok, sh, NewAttribute(CKA_SENSITIVE, true))
+
+	params := &PrivateWrapParams{
+		Password:   []byte("password"),
+		PublicData: k.Y.Bytes(),
+		RandomA:    bytes.Repeat([]byte{0x5a}, 20),
+		PrimeP:     k.P.Bytes(),
+		BaseG:      k.G.Bytes(),
+		SubprimeQ:  k.Q.Bytes(),
+	}
+	m := &Mechanism{Mechanism: CKM_SKIPJACK_PRIVATE_WRAP, Parameter: params}
+
+	wrapped, err := tok.WrapKey(sh, m, kek, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := tok.UnwrapKey(sh, m, kek, wrapped, []Attribute{NewAttribute(CKA_LABEL, "unwrapped")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs, _ := tok.GetAttributeValue(sh, u, []uint{CKA_VALUE, CKA_PRIME})
+	if k.X.Cmp(new(big.Int).SetBytes(attrs[0].Value)) != 0 || !bytes.Equal(attrs[1].Value, params.PrimeP) {
+		t.Errorf("pkcs11 private unwrap failed: got %x\n", attrs)
+	}
+
+	// the password is bound in
+	bad := *params
+	bad.Password = []byte("Password")
+	if _, err := tok.UnwrapKey(sh, &Mechanism{Mechanism: CKM_SKIPJACK_PRIVATE_WRAP, Parameter: &bad}, kek, wrapped, nil); err != CKR_WRAPPED_KEY_INVALID {
+		t.Errorf("pkcs11 unwrapped with the wrong password: %v\n", err)
+	}
+
+	// as is the public key
+	bad = *params
+	bad.PublicData = testParameters.G.Bytes()
+	if _, err := tok.WrapKey(sh, &Mechanism{Mechanism: CKM_SKIPJACK_PRIVATE_WRAP, Parameter: &bad}, kek, h); err != CKR_MECHANISM_PARAM_INVALID {
+		t.Errorf("pkcs11 wrapped with the wrong public data: %v\n", err)
+	}
+
+	// relay to a new password
+	relay := &RelayXParams{
+		OldWrappedX:   wrapped,
+		OldPassword:   params.Password,
+		OldPublicData: params.PublicData,
+		OldRandomA:    params.RandomA,
+		NewPassword:   []byte("new password"),
+		NewPublicData: params.PublicData,
+		NewRandomA:    bytes.Repeat([]byte{0xa5}, 20),
+	}
+
+	relayed, err := tok.WrapKey(sh, &Mechanism{Mechanism: CKM_SKIPJACK_RELAYX, Parameter: relay}, kek, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moved := *params
+	moved.Password, moved.RandomA = relay.NewPassword, relay.NewRandomA
+	if _, err := tok.UnwrapKey(sh, &Mechanism{Mechanism: CKM_SKIPJACK_PRIVATE_WRAP, Parameter: &moved}, kek, relayed, nil); err != nil {
+		t.Errorf("pkcs11 relayed key failed to unwrap: %v\n", err)
+	}
+	if _, err := tok.UnwrapKey(sh, m, kek, relayed, nil); err != CKR_WRAPPED_KEY_INVALID {
+		t.Errorf("pkcs11 relayed key unwrapped with the old password: %v\n", err)
+	}
+
+	relay.OldPassword = relay.NewPassword
+	if _, err := tok.WrapKey(sh, &Mechanism{Mechanism: CKM_SKIPJACK_RELAYX, Parameter: relay}, kek, 0); err != CKR_WRAPPED_KEY_INVALID {
+		t.Errorf("pkcs11 relayed with the wrong password: %v\n", err)
+	}
+}
@@ -0,0 +1,51 @@
+package skipjack
+
+/*
+
+   Skip32, from:
+   Greg Rose, skip32.c, the public domain reference implementation
+
+   Skip32 is a 24-round Feistel network on two 16-bit words, with the
+   SKIPJACK G permutation, F table and 80-bit key schedule as its round
+   function.  Round k XORs G_k of one word and the round counter k into
+   the other.  A 32-bit block is far too small for general encryption, but
+   it makes a keyed permutation of uint32 values, such as database IDs.
+
+*/
+
+// Skip32 is an instance of Skip32 with a particular key.
+type Skip32 struct {
+	key []byte
+}
+
+// NewSkip32 returns a Skip32 permutation.  The key argument must be 10
+// bytes.
+func NewSkip32(key []byte) (*Skip32, error) {
+	if klen := len(key); klen != 10 {
+		return nil, KeySizeError(klen)
+	}
+
+	return &Skip32{key: append([]byte(nil), key...)}, nil
+}
+
+func (s *Skip32) crypt(x uint32, k, kstep int) uint32 {
+
+	wl := uint16(x >> 16)
+	wr := uint16(x)
+
+	for i := 0; i < 24/2; i++ {
+		wr ^= g(&ftable, s.key, k, wl) ^ uint16(k)
+		k += kstep
+		wl ^= g(&ftable, s.key, k, wr) ^ uint16(k)
+		k += kstep
+	}
+
+	// the halves are swapped after the last round
+	return uint32(wr)<<16 | uint32(wl)
+}
+
+// Obfuscate encrypts x.
+func (s *Skip32) Obfuscate(x uint32) uint32 { return s.crypt(x, 0, 1) }
+
+// Deobfuscate decrypts x.
+func (s *Skip32) Deobfuscate(x uint32) uint32 { return s.crypt(x, 23, -1) }
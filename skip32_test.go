@@ -0,0 +1,33 @@
+package skipjack
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSkip32(t *testing.T) {
+
+	// from skip32.c
+	s, err := NewSkip32(unhex("00998877665544332211"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.Obfuscate(0x33221100); got != 0x819d5f1f {
+		t.Errorf("skip32 failed: got %08x wanted %08x\n", got, 0x819d5f1f)
+	}
+	if got := s.Deobfuscate(0x819d5f1f); got != 0x33221100 {
+		t.Errorf("skip32 decrypt failed: got %08x wanted %08x\n", got, 0x33221100)
+	}
+
+	for i := 0; i < 1000; i++ {
+		x := rand.Uint32()
+		if got := s.Deobfuscate(s.Obfuscate(x)); got != x {
+			t.Errorf("skip32 round trip failed: got %08x wanted %08x\n", got, x)
+		}
+	}
+
+	if _, err := NewSkip32(make([]byte, 8)); err == nil {
+		t.Errorf("skip32 accepted an 8-byte key\n")
+	}
+}
@@ -38,6 +38,7 @@ var ftable = [...]byte{
 // skipjackCipher is an instance of SKIPJACK encryption with a particular key
 type skipjackCipher struct {
 	key []byte
+	f   *[256]byte
 }
 
 type KeySizeError int
@@ -49,7 +50,7 @@ func (k KeySizeError) Error() string {
 // New creates and returns a new cipher.Block implementing the SKIPJACK cipher.
 // The key argument must be 10 bytes.
 func New(key []byte) (cipher.Block, error) {
-	c := new(skipjackCipher)
+	c := &skipjackCipher{f: &ftable}
 
 	if klen := len(key); klen != 10 {
 		return nil, KeySizeError(klen)
@@ -66,28 +67,28 @@ func New(key []byte) (cipher.Block, error) {
 // BlockSize returns the SKIPJACK block size
 func (c *skipjackCipher) BlockSize() int { return 8 }
 
-func g(key []byte, k int, w uint16) uint16 {
+func g(f *[256]byte, key []byte, k int, w uint16) uint16 {
 
 	g1 := byte((w >> 8) & 0xff)
 	g2 := byte(w & 0xff)
 
-	g3 := ftable[g2^key[(4*k+0)%10]] ^ g1
-	g4 := ftable[g3^key[(4*k+1)%10]] ^ g2
-	g5 := ftable[g4^key[(4*k+2)%10]] ^ g3
-	g6 := ftable[g5^key[(4*k+3)%10]] ^ g4
+	g3 := f[g2^key[(4*k+0)%10]] ^ g1
+	g4 := f[g3^key[(4*k+1)%10]] ^ g2
+	g5 := f[g4^key[(4*k+2)%10]] ^ g3
+	g6 := f[g5^key[(4*k+3)%10]] ^ g4
 
 	return (uint16(g5) << 8) + uint16(g6)
 }
 
-func ginv(key []byte, k int, w uint16) uint16 {
+func ginv(f *[256]byte, key []byte, k int, w uint16) uint16 {
 
 	g5 := byte((w >> 8) & 0xff)
 	g6 := byte(w & 0xff)
 
-	g4 := ftable[g5^key[(4*k+3)%10]] ^ g6
-	g3 := ftable[g4^key[(4*k+2)%10]] ^ g5
-	g2 := ftable[g3^key[(4*k+1)%10]] ^ g4
-	g1 := ftable[g2^key[(4*k+0)%10]] ^ g3
+	g4 := f[g5^key[(4*k+3)%10]] ^ g6
+	g3 := f[g4^key[(4*k+2)%10]] ^ g5
+	g2 := f[g3^key[(4*k+1)%10]] ^ g4
+	g1 := f[g2^key[(4*k+0)%10]] ^ g3
 
 	return (uint16(g1) << 8) + uint16(g2)
 }
@@ -105,14 +106,14 @@ func (c *skipjackCipher) Encrypt(dst, src []byte) {
 	for t := 0; t < 2; t++ {
 		// A
 		for i := 0; i < 8; i++ {
-			gw1 := g(c.key, k, w1)
+			gw1 := g(c.f, c.key, k, w1)
 			w1, w2, w3, w4 = gw1^w4^(uint16(k)+1), gw1, w2, w3
 			k++
 		}
 
 		// B
 		for i := 0; i < 8; i++ {
-			gw1 := g(c.key, k, w1)
+			gw1 := g(c.f, c.key, k, w1)
 			w1, w2, w3, w4 = w4, gw1, w1^w2^uint16(k+1), w3
 			k++
 		}
@@ -141,14 +142,14 @@ func (c *skipjackCipher) Decrypt(dst, src []byte) {
 	for t := 0; t < 2; t++ {
 		// B^-1
 		for i := 0; i < 8; i++ {
-			gw2 := ginv(c.key, k-1, w2)
+			gw2 := ginv(c.f, c.key, k-1, w2)
 			w1, w2, w3, w4 = gw2, gw2^w3^uint16(k), w4, w1
 			k--
 		}
 
 		// A^-1
 		for i := 0; i < 8; i++ {
-			w1, w2, w3, w4 = ginv(c.key, k-1, w2), w3, w4, w1^w2^uint16(k)
+			w1, w2, w3, w4 = ginv(c.f, c.key, k-1, w2), w3, w4, w1^w2^uint16(k)
 			k--
 		}
 	}
@@ -0,0 +1,695 @@
+package ssl3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Phraxos/go-skipjack/kea"
+)
+
+// Alert descriptions used by the emulation.
+const (
+	alertCloseNotify       uint8 = 0
+	alertUnexpectedMessage uint8 = 10
+	alertBadRecordMAC      uint8 = 20
+	alertHandshakeFailure  uint8 = 40
+	alertIllegalParameter  uint8 = 47
+)
+
+const (
+	alertLevelWarning uint8 = 1
+	alertLevelFatal   uint8 = 2
+)
+
+// AlertError is returned when the peer sends a fatal alert.
+type AlertError uint8
+
+func (e AlertError) Error() string {
+	return fmt.Sprintf("ssl3: received alert %d", uint8(e))
+}
+
+var (
+	errUnexpectedMessage = errors.New("ssl3: unexpected message")
+	errNoKey             = errors.New("ssl3: no static KEA key configured")
+	errNoPeerKey         = errors.New("ssl3: peer's static KEA key unknown")
+	errPeerKeyMismatch   = errors.New("ssl3: client KEA key does not match the configured key")
+	errNoCipherSuite     = errors.New("ssl3: no FORTEZZA cipher suite in common")
+	errFinished          = errors.New("ssl3: Finished verification failed")
+	errVersion           = errors.New("ssl3: unsupported protocol version")
+	errRecordTooLong     = errors.New("ssl3: record too long")
+)
+
+// Conn is an SSL 3.0 connection using the FORTEZZA cipher suite.  Read and
+// Write may be called concurrently; the handshake runs on the first call
+// of either.
+type Conn struct {
+	conn     net.Conn
+	config   *Config
+	isClient bool
+
+	handshakeMu  sync.Mutex
+	handshakeErr error
+	handshakeRun bool
+
+	// handshakeDone is set once the handshake has succeeded, and is read
+	// by Close without handshakeMu
+	handshakeDone atomic.Bool
+
+	inMu       sync.Mutex
+	in         *CipherState
+	hs         bytes.Buffer // buffered handshake data
+	input      []byte       // buffered application data
+	readErr    error
+	transcript []byte
+
+	outMu    sync.Mutex
+	out      *CipherState
+	writeErr error
+
+	pendingIn, pendingOut *CipherState
+	master                []byte
+
+	// writeDeadline is the caller's write deadline, which sendAlert
+	// shortens and then restores
+	deadlineMu    sync.Mutex
+	writeDeadline time.Time
+}
+
+// Client returns a client connection over conn.
+func Client(conn net.Conn, config *Config) *Conn {
+	return &Conn{conn: conn, config: config, isClient: true}
+}
+
+// Server returns a server connection over conn.
+func Server(conn net.Conn, config *Config) *Conn {
+	return &Conn{conn: conn, config: config}
+}
+
+// readRecord reads and opens the next record.  Alerts are returned as
+// errors; a close_notify is io.EOF.
+func (c *Conn) readRecord() (uint8, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+
+	typ, payload, err := c.readRecordOnce()
+	if err != nil {
+		c.readErr = err
+	}
+	return typ, payload, err
+}
+
+func (c *Conn) readRecordOnce() (uint8, []byte, error) {
+	var hdr [recordHeaderLen]byte
+	if _, err := io.ReadFull(c.conn, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+
+	typ := hdr[0]
+	if vers := uint16(hdr[1])<<8 | uint16(hdr[2]); vers != VersionSSL30 {
+		c.sendAlert(alertIllegalParameter)
+		return 0, nil, errVersion
+	}
+
+	n := int(hdr[3])<<8 | int(hdr[4])
+	if n > maxCiphertext {
+		c.sendAlert(alertIllegalParameter)
+		return 0, nil, errRecordTooLong
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.conn, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+
+	if c.in != nil {
+		var err error
+		if payload, err = c.in.Open(typ, payload); err != nil {
+			c.sendAlert(alertBadRecordMAC)
+			return 0, nil, err
+		}
+	}
+
+	if typ == RecordTypeAlert {
+		if len(payload) != 2 {
+			return 0, nil, errUnexpectedMessage
+		}
+		if payload[1] == alertCloseNotify {
+			return 0, nil, io.EOF
+		}
+		return 0, nil, AlertError(payload[1])
+	}
+
+	return typ, payload, nil
+}
+
+// writeRecord sends payload as one or more records
+func (c *Conn) writeRecord(typ uint8, payload []byte) error {
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+
+	if len(payload) == 0 && typ == RecordTypeApplicationData {
+		return nil
+	}
+
+	for {
+		n := min(len(payload), maxPlaintext)
+
+		fragment := payload[:n]
+		if c.out != nil {
+			fragment = c.out.Seal(typ, fragment)
+		}
+
+		rec := make([]byte, recordHeaderLen, recordHeaderLen+len(fragment))
+		rec[0] = typ
+		rec[1], rec[2] = VersionSSL30>>8, VersionSSL30&0xff
+		rec[3], rec[4] = byte(len(fragment)>>8), byte(len(fragment))
+		rec = append(rec, fragment...)
+
+		if _, err := c.conn.Write(rec); err != nil {
+			c.writeErr = err
+			return err
+		}
+
+		if payload = payload[n:]; len(payload) == 0 {
+			break
+		}
+	}
+
+	return nil
+}
+
+// alertTimeout bounds the wait to send an alert
+var alertTimeout = time.Second
+
+// sendAlert sends an alert on a best-effort basis.  As in crypto/tls, a
+// peer that is not reading must not block it: a write deadline, alertTimeout
+// from now or the caller's if that is sooner, bounds the wait, and also
+// releases a Write blocked while holding outMu.  The caller's deadline is
+// restored afterwards.
+func (c *Conn) sendAlert(desc uint8) {
+	c.deadlineMu.Lock()
+	d := time.Now().Add(alertTimeout)
+	if !c.writeDeadline.IsZero() && c.writeDeadline.Before(d) {
+		d = c.writeDeadline
+	}
+	c.conn.SetWriteDeadline(d)
+	c.deadlineMu.Unlock()
+
+	defer func() {
+		c.deadlineMu.Lock()
+		c.conn.SetWriteDeadline(c.writeDeadline)
+		c.deadlineMu.Unlock()
+	}()
+
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+
+	level := alertLevelFatal
+	if desc == alertCloseNotify {
+		level = alertLevelWarning
+	}
+
+	c.writeRecord(RecordTypeAlert, []byte{level, desc})
+}
+
+// readHandshake returns the body of the next handshake message, which must
+// be of type want
+func (c *Conn) readHandshake(want uint8) ([]byte, error) {
+	for {
+		if b := c.hs.Bytes(); len(b) >= 4 {
+			n := int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+			if len(b) >= 4+n {
+				break
+			}
+		}
+
+		typ, payload, err := c.readRecord()
+		if err != nil {
+			return nil, err
+		}
+		if typ != RecordTypeHandshake {
+			c.sendAlert(alertUnexpectedMessage)
+			return nil, errUnexpectedMessage
+		}
+
+		c.hs.Write(payload)
+	}
+
+	b := c.hs.Bytes()
+	n := int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+	msg := append([]byte(nil), c.hs.Next(4+n)...)
+
+	if msg[0] != want {
+		c.sendAlert(alertUnexpectedMessage)
+		return nil, errUnexpectedMessage
+	}
+
+	c.transcript = append(c.transcript, msg...)
+
+	return msg[4:], nil
+}
+
+func (c *Conn) writeHandshake(typ uint8, body []byte) error {
+	msg := []byte{typ, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	msg = append(msg, body...)
+
+	c.transcript = append(c.transcript, msg...)
+
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+
+	return c.writeRecord(RecordTypeHandshake, msg)
+}
+
+func (c *Conn) readChangeCipherSpec() error {
+	typ, payload, err := c.readRecord()
+	if err != nil {
+		return err
+	}
+
+	if typ != RecordTypeChangeCipherSpec || len(payload) != 1 || payload[0] != 1 || c.hs.Len() != 0 {
+		c.sendAlert(alertUnexpectedMessage)
+		return errUnexpectedMessage
+	}
+
+	c.in = c.pendingIn
+
+	return nil
+}
+
+func (c *Conn) writeChangeCipherSpec() error {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+
+	if err := c.writeRecord(RecordTypeChangeCipherSpec, []byte{1}); err != nil {
+		return err
+	}
+
+	c.out = c.pendingOut
+
+	return nil
+}
+
+func (c *Conn) readFinished(sender []byte) error {
+	want := finishedHash(c.master, c.transcript, sender)
+
+	body, err := c.readHandshake(typeFinished)
+	if err != nil {
+		return err
+	}
+
+	if len(body) != finishedSize || !hmac.Equal(body, want) {
+		c.sendAlert(alertHandshakeFailure)
+		return errFinished
+	}
+
+	return nil
+}
+
+func (c *Conn) writeFinished(sender []byte) error {
+	return c.writeHandshake(typeFinished, finishedHash(c.master, c.transcript, sender))
+}
+
+// establishKeys derives the master and MAC secrets and sets up the pending
+// cipher states
+func (c *Conn) establishKeys(preMaster, clientRandom, serverRandom []byte, k *FortezzaKeys, clientWriteKey, serverWriteKey []byte) error {
+	c.master = MasterSecret(preMaster, clientRandom, serverRandom)
+	clientMAC, serverMAC := MACSecrets(c.master, clientRandom, serverRandom)
+
+	var err error
+
+	if c.isClient {
+		if c.pendingOut, err = NewSealer(clientWriteKey, k.ClientWriteIV, clientMAC); err != nil {
+			return err
+		}
+		c.pendingIn, err = NewOpener(serverWriteKey, k.ServerWriteIV, serverMAC)
+	} else {
+		if c.pendingOut, err = NewSealer(serverWriteKey, k.ServerWriteIV, serverMAC); err != nil {
+			return err
+		}
+		c.pendingIn, err = NewOpener(clientWriteKey, k.ClientWriteIV, clientMAC)
+	}
+
+	return err
+}
+
+func (c *Conn) random() ([]byte, error) {
+	r := make([]byte, randomSize)
+	if _, err := io.ReadFull(c.config.rand(), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func keaValue(pub *kea.PublicKey) []byte {
+	return pub.Y.FillBytes(make([]byte, keaValueSize))
+}
+
+func (c *Conn) clientHandshake() error {
+	cfg := c.config
+	if cfg.Key == nil {
+		return errNoKey
+	}
+	if cfg.PeerKey == nil {
+		return errNoPeerKey
+	}
+
+	clientRandom, err := c.random()
+	if err != nil {
+		return err
+	}
+
+	hello := &clientHello{
+		vers:               VersionSSL30,
+		random:             clientRandom,
+		cipherSuites:       []uint16{FORTEZZA_KEA_WITH_FORTEZZA_CBC_SHA},
+		compressionMethods: []uint8{0},
+	}
+	if err := c.writeHandshake(typeClientHello, hello.marshal()); err != nil {
+		return err
+	}
+
+	body, err := c.readHandshake(typeServerHello)
+	if err != nil {
+		return err
+	}
+
+	sh, err := parseServerHello(body)
+	if err != nil {
+		c.sendAlert(alertIllegalParameter)
+		return err
+	}
+	if sh.vers != VersionSSL30 {
+		c.sendAlert(alertHandshakeFailure)
+		return errVersion
+	}
+	if sh.cipherSuite != FORTEZZA_KEA_WITH_FORTEZZA_CBC_SHA || sh.compressionMethod != 0 {
+		c.sendAlert(alertIllegalParameter)
+		return errNoCipherSuite
+	}
+
+	body, err = c.readHandshake(typeServerKeyExchange)
+	if err != nil {
+		return err
+	}
+	if len(body) != keaValueSize {
+		c.sendAlert(alertIllegalParameter)
+		return errMessage
+	}
+	rs := &kea.PublicKey{Parameters: cfg.Key.Parameters, Y: new(big.Int).SetBytes(body)}
+
+	if _, err := c.readHandshake(typeServerHelloDone); err != nil {
+		return err
+	}
+
+	rc, err := kea.GenerateKey(&cfg.Key.Parameters, cfg.rand())
+	if err != nil {
+		return err
+	}
+
+	tek, err := kea.Agree(cfg.Key, rc, cfg.PeerKey, rs)
+	if err != nil {
+		c.sendAlert(alertHandshakeFailure)
+		return err
+	}
+
+	// the pre-master secret and both write keys
+	secrets := make([]byte, PreMasterSecretSize+2*kea.KeySize)
+	if _, err := io.ReadFull(cfg.rand(), secrets); err != nil {
+		return err
+	}
+	preMaster := secrets[:PreMasterSecretSize]
+	clientWriteKey := secrets[PreMasterSecretSize : PreMasterSecretSize+kea.KeySize]
+	serverWriteKey := secrets[PreMasterSecretSize+kea.KeySize:]
+
+	keys, err := sealFortezzaKeys(cfg.rand(), tek, preMaster, clientWriteKey, serverWriteKey)
+	if err != nil {
+		return err
+	}
+	keys.RC = keaValue(&rc.PublicKey)
+
+	if err := c.writeHandshake(typeClientKeyExchange, keys.marshal()); err != nil {
+		return err
+	}
+
+	if err := c.establishKeys(preMaster, clientRandom, sh.random, keys, clientWriteKey, serverWriteKey); err != nil {
+		return err
+	}
+
+	if err := c.writeChangeCipherSpec(); err != nil {
+		return err
+	}
+	if err := c.writeFinished(senderClient); err != nil {
+		return err
+	}
+
+	if err := c.readChangeCipherSpec(); err != nil {
+		return err
+	}
+	return c.readFinished(senderServer)
+}
+
+func (c *Conn) serverHandshake() error {
+	cfg := c.config
+	if cfg.Key == nil {
+		return errNoKey
+	}
+
+	body, err := c.readHandshake(typeClientHello)
+	if err != nil {
+		return err
+	}
+
+	hello, err := parseClientHello(body)
+	if err != nil {
+		c.sendAlert(alertIllegalParameter)
+		return err
+	}
+	if hello.vers < VersionSSL30 {
+		c.sendAlert(alertHandshakeFailure)
+		return errVersion
+	}
+	if !bytes.Contains(hello.compressionMethods, []byte{0}) || !hasSuite(hello.cipherSuites) {
+		c.sendAlert(alertHandshakeFailure)
+		return errNoCipherSuite
+	}
+
+	serverRandom, err := c.random()
+	if err != nil {
+		return err
+	}
+
+	rs, err := kea.GenerateKey(&cfg.Key.Parameters, cfg.rand())
+	if err != nil {
+		return err
+	}
+
+	sh := &serverHello{vers: VersionSSL30, random: serverRandom, cipherSuite: FORTEZZA_KEA_WITH_FORTEZZA_CBC_SHA}
+	if err := c.writeHandshake(typeServerHello, sh.marshal()); err != nil {
+		return err
+	}
+	if err := c.writeHandshake(typeServerKeyExchange, keaValue(&rs.PublicKey)); err != nil {
+		return err
+	}
+	if err := c.writeHandshake(typeServerHelloDone, nil); err != nil {
+		return err
+	}
+
+	body, err = c.readHandshake(typeClientKeyExchange)
+	if err != nil {
+		return err
+	}
+
+	keys, err := ParseFortezzaKeys(body)
+	if err != nil {
+		c.sendAlert(alertIllegalParameter)
+		return err
+	}
+
+	yc, err := c.clientKey(keys.YC)
+	if err != nil {
+		c.sendAlert(alertHandshakeFailure)
+		return err
+	}
+
+	rc := &kea.PublicKey{Parameters: cfg.Key.Parameters, Y: new(big.Int).SetBytes(keys.RC)}
+
+	tek, err := kea.Agree(cfg.Key, rs, yc, rc)
+	if err != nil {
+		c.sendAlert(alertHandshakeFailure)
+		return err
+	}
+
+	preMaster, clientWriteKey, serverWriteKey, err := keys.Open(tek)
+	if err != nil {
+		c.sendAlert(alertHandshakeFailure)
+		return err
+	}
+
+	if err := c.establishKeys(preMaster, hello.random, serverRandom, keys, clientWriteKey, serverWriteKey); err != nil {
+		return err
+	}
+
+	if err := c.readChangeCipherSpec(); err != nil {
+		return err
+	}
+	if err := c.readFinished(senderClient); err != nil {
+		return err
+	}
+
+	if err := c.writeChangeCipherSpec(); err != nil {
+		return err
+	}
+	return c.writeFinished(senderServer)
+}
+
+// clientKey returns the client's static key, from ClientKeyExchange if it
+// sent one and from the configuration otherwise
+func (c *Conn) clientKey(yc []byte) (*kea.PublicKey, error) {
+	cfg := c.config
+
+	if len(yc) == 0 {
+		if cfg.PeerKey == nil {
+			return nil, errNoPeerKey
+		}
+		return cfg.PeerKey, nil
+	}
+
+	pub := &kea.PublicKey{Parameters: cfg.Key.Parameters, Y: new(big.Int).SetBytes(yc)}
+	if cfg.PeerKey != nil && cfg.PeerKey.Y.Cmp(pub.Y) != 0 {
+		return nil, errPeerKeyMismatch
+	}
+
+	return pub, nil
+}
+
+func hasSuite(suites []uint16) bool {
+	for _, s := range suites {
+		if s == FORTEZZA_KEA_WITH_FORTEZZA_CBC_SHA {
+			return true
+		}
+	}
+	return false
+}
+
+// Handshake runs the handshake if it has not yet been run.
+func (c *Conn) Handshake() error {
+	c.handshakeMu.Lock()
+	defer c.handshakeMu.Unlock()
+
+	if c.handshakeRun {
+		return c.handshakeErr
+	}
+	c.handshakeRun = true
+
+	c.inMu.Lock()
+	defer c.inMu.Unlock()
+
+	if c.isClient {
+		c.handshakeErr = c.clientHandshake()
+	} else {
+		c.handshakeErr = c.serverHandshake()
+	}
+	if c.handshakeErr == nil {
+		c.handshakeDone.Store(true)
+	}
+
+	return c.handshakeErr
+}
+
+// Read reads application data.
+func (c *Conn) Read(p []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.inMu.Lock()
+	defer c.inMu.Unlock()
+
+	for len(c.input) == 0 {
+		typ, payload, err := c.readRecord()
+		if err != nil {
+			return 0, err
+		}
+
+		if typ != RecordTypeApplicationData {
+			c.sendAlert(alertUnexpectedMessage)
+			c.readErr = errUnexpectedMessage
+			return 0, c.readErr
+		}
+
+		c.input = payload
+	}
+
+	n := copy(p, c.input)
+	c.input = c.input[n:]
+
+	return n, nil
+}
+
+// Write writes application data.
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+
+	if err := c.writeRecord(RecordTypeApplicationData, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close sends a close_notify alert, if the handshake completed, and closes
+// the underlying connection.  It does not wait for a handshake in progress,
+// which fails once the connection is closed.
+func (c *Conn) Close() error {
+	if c.handshakeDone.Load() {
+		c.sendAlert(alertCloseNotify)
+	}
+
+	return c.conn.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// SetDeadline sets the read and write deadlines of the underlying connection.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+
+	c.writeDeadline = t
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the underlying connection.
+func (c *Conn) SetReadDeadline(t time.Time) error { return c.conn.SetReadDeadline(t) }
+
+// SetWriteDeadline sets the write deadline of the underlying connection.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+
+	c.writeDeadline = t
+	return c.conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,317 @@
+package ssl3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Phraxos/go-skipjack/kea"
+)
+
+func fromHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("bad hex: " + s)
+	}
+	return n
+}
+
+var testParameters = kea.Parameters{
+	P: fromHex("a07377e4d4eae2231e2329aad6e0ad41015d12b4791fd3fb1ca22c4d3667be43d09c91917f4106b9843247182c6662a7db0f529a0a184a6b7f2b6f4e53e9c30471b5adeaed57f2f4d494f839978fe245a4a00a9a9e18e32f5ad8a66a9bd45a41b30fa9acda5dcad72df214bc64cf43ff5483721f2d5aa6b809da64e963863b7f"),
+	Q: fromHex("e9d6762f5173237c26b61ee6efa8a4df7cddc11b"),
+	G: fromHex("23afd9da2f7e1337006c5d32fcc28502263442bfbf07e967d0e9b8adce6f7f013986c5900a5dbc8daae7a3a02d6e06680bd476315c47f8d521c3e060879d93656405dddf19f800078ccf68cf798e493dba27775de1100179c0ab0c5144361a1b0ca438e3f2ac99b821308e03f3f723c2fa9bbe00201aa82f0c9ba90ab5969e78"),
+}
+
+// the tests' alerts often go to a peer that is not reading, so give up on
+// them sooner
+func init() {
+	alertTimeout = 100 * time.Millisecond
+}
+
+func generate(t *testing.T) *kea.PrivateKey {
+	k, err := kea.GenerateKey(&testParameters, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// pipe returns a connected client and server
+func pipe(clientConfig, serverConfig *Config) (*Conn, *Conn) {
+	c, s := net.Pipe()
+	return Client(c, clientConfig), Server(s, serverConfig)
+}
+
+// handshake runs both handshakes and returns their errors
+func handshake(client, server *Conn) (clientErr, serverErr error) {
+	done := make(chan error, 1)
+	go func() {
+		err := server.Handshake()
+		if err != nil {
+			server.Close()
+		}
+		done <- err
+	}()
+
+	clientErr = client.Handshake()
+	if clientErr != nil {
+		client.Close()
+	}
+
+	return clientErr, <-done
+}
+
+func TestHandshake(t *testing.T) {
+
+	ck, sk := generate(t), generate(t)
+
+	client, server := pipe(
+		&Config{Key: ck, PeerKey: &sk.PublicKey},
+		&Config{Key: sk, PeerKey: &ck.PublicKey},
+	)
+
+	if cerr, serr := handshake(client, server); cerr != nil || serr != nil {
+		t.Fatalf("ssl3 handshake failed: client %v, server %v\n", cerr, serr)
+	}
+
+	if !bytes.Equal(client.master, server.master) {
+		t.Errorf("ssl3 master secrets differ\n")
+	}
+
+	// more than one record each way
+	msg := make([]byte, 40000)
+	rand.Read(msg)
+
+	done := make(chan struct{})
+	go func() {
+		client.Write(msg)
+		client.Close()
+		close(done)
+	}()
+
+	got, err := io.ReadAll(server)
+	if err != nil || !bytes.Equal(got, msg) {
+		t.Errorf("ssl3 client to server failed: %d bytes (%v)\n", len(got), err)
+	}
+	<-done
+
+	client, server = pipe(&Config{Key: ck, PeerKey: &sk.PublicKey}, &Config{Key: sk, PeerKey: &ck.PublicKey})
+	handshake(client, server)
+
+	done = make(chan struct{})
+	go func() {
+		server.Write([]byte("hello from the server"))
+		server.Close()
+		close(done)
+	}()
+
+	if got, err := io.ReadAll(client); err != nil || string(got) != "hello from the server" {
+		t.Errorf("ssl3 server to client failed: %q (%v)\n", got, err)
+	}
+	<-done
+}
+
+func TestHandshakeWrongKey(t *testing.T) {
+
+	ck, sk, other := generate(t), generate(t), generate(t)
+
+	// the client believes the server has a different static key
+	client, server := pipe(
+		&Config{Key: ck, PeerKey: &other.PublicKey},
+		&Config{Key: sk, PeerKey: &ck.PublicKey},
+	)
+
+	if cerr, serr := handshake(client, server); cerr == nil || serr == nil {
+		t.Errorf("ssl3 handshake succeeded with the wrong server key: client %v, server %v\n", cerr, serr)
+	}
+
+	// the server has no way to learn the client's key
+	client, server = pipe(&Config{Key: ck, PeerKey: &sk.PublicKey}, &Config{Key: sk})
+
+	if _, serr := handshake(client, server); serr != errNoPeerKey {
+		t.Errorf("ssl3 server accepted an unknown client: %v\n", serr)
+	}
+}
+
+// flipper corrupts the last byte of the nth write
+type flipper struct {
+	net.Conn
+	n int
+}
+
+func (f *flipper) Write(b []byte) (int, error) {
+	if f.n--; f.n == 0 {
+		b = append([]byte(nil), b...)
+		b[len(b)-1] ^= 1
+	}
+	return f.Conn.Write(b)
+}
+
+func TestTamperedRecord(t *testing.T) {
+
+	ck, sk := generate(t), generate(t)
+
+	c, s := net.Pipe()
+
+	// ClientHello, ClientKeyExchange, ChangeCipherSpec, Finished, data
+	client := Client(&flipper{Conn: c, n: 5}, &Config{Key: ck, PeerKey: &sk.PublicKey})
+	server := Server(s, &Config{Key: sk, PeerKey: &ck.PublicKey})
+
+	if cerr, serr := handshake(client, server); cerr != nil || serr != nil {
+		t.Fatalf("ssl3 handshake failed: client %v, server %v\n", cerr, serr)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		client.Write([]byte("attack at dawn"))
+		close(done)
+	}()
+
+	if _, err := server.Read(make([]byte, 64)); err != errBadRecordMAC {
+		t.Errorf("ssl3 accepted a tampered record: %v\n", err)
+	}
+	<-done
+
+	// a tampered Finished fails the handshake
+	c, s = net.Pipe()
+	client = Client(&flipper{Conn: c, n: 4}, &Config{Key: ck, PeerKey: &sk.PublicKey})
+	server = Server(s, &Config{Key: sk, PeerKey: &ck.PublicKey})
+
+	if _, serr := handshake(client, server); serr == nil {
+		t.Errorf("ssl3 accepted a tampered Finished\n")
+	}
+}
+
+// writing signals on started, if it is not nil, as each write to the
+// underlying connection begins
+type writing struct {
+	net.Conn
+	started chan struct{}
+}
+
+func (w *writing) Write(b []byte) (int, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	return w.Conn.Write(b)
+}
+
+// closes reports whether f returns within the timeout
+func closes(f func() error, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestCloseUnreadPeer(t *testing.T) {
+
+	ck, sk := generate(t), generate(t)
+
+	client, server := pipe(&Config{Key: ck, PeerKey: &sk.PublicKey}, &Config{Key: sk, PeerKey: &ck.PublicKey})
+	if cerr, serr := handshake(client, server); cerr != nil || serr != nil {
+		t.Fatalf("ssl3 handshake failed: client %v, server %v\n", cerr, serr)
+	}
+
+	// the server never reads the close_notify
+	if !closes(client.Close, 5*time.Second) {
+		t.Errorf("ssl3 Close blocked on a peer that is not reading\n")
+	}
+
+	// nor the data of a blocked Write
+	c, s := net.Pipe()
+	w := &writing{Conn: c}
+	client = Client(w, &Config{Key: ck, PeerKey: &sk.PublicKey})
+	server = Server(s, &Config{Key: sk, PeerKey: &ck.PublicKey})
+	if cerr, serr := handshake(client, server); cerr != nil || serr != nil {
+		t.Fatalf("ssl3 handshake failed: client %v, server %v\n", cerr, serr)
+	}
+
+	w.started = make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		client.Write([]byte("never read"))
+		close(done)
+	}()
+	<-w.started
+
+	if !closes(client.Close, 5*time.Second) {
+		t.Errorf("ssl3 Close blocked behind a Write\n")
+	}
+	<-done
+	server.Close()
+}
+
+func TestCloseDuringHandshake(t *testing.T) {
+
+	ck, sk := generate(t), generate(t)
+
+	// the server never answers, so the client handshake stalls
+	c, s := net.Pipe()
+	defer s.Close()
+
+	w := &writing{Conn: c, started: make(chan struct{}, 1)}
+	client := Client(w, &Config{Key: ck, PeerKey: &sk.PublicKey})
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.Handshake() }()
+
+	// the ClientHello is waiting to be read
+	<-w.started
+
+	if !closes(client.Close, 5*time.Second) {
+		t.Fatalf("ssl3 Close blocked behind a stalled handshake\n")
+	}
+
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Errorf("ssl3 handshake succeeded after Close\n")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("ssl3 handshake did not fail after Close\n")
+	}
+}
+
+func TestAlertDeadline(t *testing.T) {
+
+	c, s := net.Pipe()
+	defer s.Close()
+
+	client := Client(c, &Config{})
+	defer client.conn.Close()
+
+	// an unread alert waits out alertTimeout, after which the caller's
+	// later deadline is back in force
+	client.SetWriteDeadline(time.Now().Add(time.Hour))
+	client.sendAlert(alertHandshakeFailure)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(s, make([]byte, 1))
+		errc <- err
+	}()
+	if _, err := c.Write([]byte{0}); err != nil {
+		t.Errorf("ssl3 alert left its deadline in place: %v\n", err)
+	}
+	<-errc
+
+	// a caller's deadline sooner than alertTimeout bounds the alert
+	client.SetWriteDeadline(time.Now().Add(-time.Second))
+	if !closes(func() error { client.sendAlert(alertHandshakeFailure); return nil }, alertTimeout/2) {
+		t.Errorf("ssl3 alert ignored the caller's deadline\n")
+	}
+}
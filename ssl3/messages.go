@@ -0,0 +1,263 @@
+package ssl3
+
+import (
+	"crypto/cipher"
+	"errors"
+	"io"
+
+	"github.com/Phraxos/go-skipjack"
+	"github.com/Phraxos/go-skipjack/internal/keywrap"
+)
+
+// Handshake message types.
+const (
+	typeClientHello       uint8 = 1
+	typeServerHello       uint8 = 2
+	typeServerKeyExchange uint8 = 12
+	typeServerHelloDone   uint8 = 14
+	typeClientKeyExchange uint8 = 16
+	typeFinished          uint8 = 20
+)
+
+const (
+	randomSize    = 32
+	keaValueSize  = 128
+	signatureSize = 40
+	finishedSize  = 16 + 20
+)
+
+var errMessage = errors.New("ssl3: malformed handshake message")
+
+// reader walks a handshake message body
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errMessage
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) u8() int {
+	if v := r.next(1); v != nil {
+		return int(v[0])
+	}
+	return 0
+}
+
+func (r *reader) u16() int {
+	if v := r.next(2); v != nil {
+		return int(v[0])<<8 | int(v[1])
+	}
+	return 0
+}
+
+// done reports an error unless the whole body was consumed
+func (r *reader) done() error {
+	if r.err == nil && len(r.b) != 0 {
+		r.err = errMessage
+	}
+	return r.err
+}
+
+type clientHello struct {
+	vers               uint16
+	random             []byte
+	sessionID          []byte
+	cipherSuites       []uint16
+	compressionMethods []uint8
+}
+
+func (m *clientHello) marshal() []byte {
+	b := []byte{byte(m.vers >> 8), byte(m.vers)}
+	b = append(b, m.random...)
+	b = append(b, byte(len(m.sessionID)))
+	b = append(b, m.sessionID...)
+	n := 2 * len(m.cipherSuites)
+	b = append(b, byte(n>>8), byte(n))
+	for _, s := range m.cipherSuites {
+		b = append(b, byte(s>>8), byte(s))
+	}
+	b = append(b, byte(len(m.compressionMethods)))
+	return append(b, m.compressionMethods...)
+}
+
+func parseClientHello(body []byte) (*clientHello, error) {
+	r := &reader{b: body}
+	m := &clientHello{}
+
+	m.vers = uint16(r.u16())
+	m.random = r.next(randomSize)
+	m.sessionID = r.next(r.u8())
+
+	suites := r.next(r.u16())
+	if len(suites)%2 != 0 {
+		return nil, errMessage
+	}
+	for i := 0; i < len(suites); i += 2 {
+		m.cipherSuites = append(m.cipherSuites, uint16(suites[i])<<8|uint16(suites[i+1]))
+	}
+
+	m.compressionMethods = r.next(r.u8())
+
+	// SSL 3.0 allows extra data after the compression methods
+	if r.err != nil || len(m.sessionID) > 32 || len(m.cipherSuites) == 0 || len(m.compressionMethods) == 0 {
+		return nil, errMessage
+	}
+
+	return m, nil
+}
+
+type serverHello struct {
+	vers              uint16
+	random            []byte
+	sessionID         []byte
+	cipherSuite       uint16
+	compressionMethod uint8
+}
+
+func (m *serverHello) marshal() []byte {
+	b := []byte{byte(m.vers >> 8), byte(m.vers)}
+	b = append(b, m.random...)
+	b = append(b, byte(len(m.sessionID)))
+	b = append(b, m.sessionID...)
+	return append(b, byte(m.cipherSuite>>8), byte(m.cipherSuite), m.compressionMethod)
+}
+
+func parseServerHello(body []byte) (*serverHello, error) {
+	r := &reader{b: body}
+	m := &serverHello{}
+
+	m.vers = uint16(r.u16())
+	m.random = r.next(randomSize)
+	m.sessionID = r.next(r.u8())
+	m.cipherSuite = uint16(r.u16())
+	m.compressionMethod = uint8(r.u8())
+
+	if err := r.done(); err != nil || len(m.sessionID) > 32 {
+		return nil, errMessage
+	}
+
+	return m, nil
+}
+
+// FortezzaKeys is the body of a FORTEZZA ClientKeyExchange message.
+type FortezzaKeys struct {
+	YC                       []byte // 0 or 128 bytes
+	RC                       []byte // 128 bytes
+	YSignature               []byte // 40 bytes
+	WrappedClientWriteKey    []byte // 12 bytes
+	WrappedServerWriteKey    []byte // 12 bytes
+	ClientWriteIV            []byte // 24 bytes
+	ServerWriteIV            []byte // 24 bytes
+	MasterSecretIV           []byte // 24 bytes
+	EncryptedPreMasterSecret []byte // 48 bytes
+}
+
+func (k *FortezzaKeys) marshal() []byte {
+	b := []byte{byte(len(k.YC))}
+	for _, f := range [][]byte{
+		k.YC, k.RC, k.YSignature, k.WrappedClientWriteKey, k.WrappedServerWriteKey,
+		k.ClientWriteIV, k.ServerWriteIV, k.MasterSecretIV, k.EncryptedPreMasterSecret,
+	} {
+		b = append(b, f...)
+	}
+	return b
+}
+
+// ParseFortezzaKeys parses the body of a FORTEZZA ClientKeyExchange
+// message.
+func ParseFortezzaKeys(body []byte) (*FortezzaKeys, error) {
+	r := &reader{b: body}
+	k := &FortezzaKeys{}
+
+	yc := r.u8()
+	if yc != 0 && yc != keaValueSize {
+		return nil, errMessage
+	}
+
+	k.YC = r.next(yc)
+	k.RC = r.next(keaValueSize)
+	k.YSignature = r.next(signatureSize)
+	k.WrappedClientWriteKey = r.next(keywrap.Size)
+	k.WrappedServerWriteKey = r.next(keywrap.Size)
+	k.ClientWriteIV = r.next(FortezzaIVSize)
+	k.ServerWriteIV = r.next(FortezzaIVSize)
+	k.MasterSecretIV = r.next(FortezzaIVSize)
+	k.EncryptedPreMasterSecret = r.next(PreMasterSecretSize)
+
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// sealFortezzaKeys wraps the write keys and encrypts the pre-master secret
+// under tek, generating the IVs from rand.
+func sealFortezzaKeys(rand io.Reader, tek, preMaster, clientWriteKey, serverWriteKey []byte) (*FortezzaKeys, error) {
+	k := &FortezzaKeys{
+		YSignature:               make([]byte, signatureSize),
+		ClientWriteIV:            make([]byte, FortezzaIVSize),
+		ServerWriteIV:            make([]byte, FortezzaIVSize),
+		MasterSecretIV:           make([]byte, FortezzaIVSize),
+		EncryptedPreMasterSecret: make([]byte, PreMasterSecretSize),
+	}
+
+	for _, iv := range [][]byte{k.ClientWriteIV, k.ServerWriteIV, k.MasterSecretIV} {
+		if _, err := io.ReadFull(rand, iv); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+
+	if k.WrappedClientWriteKey, err = keywrap.Wrap(tek, clientWriteKey); err != nil {
+		return nil, err
+	}
+	if k.WrappedServerWriteKey, err = keywrap.Wrap(tek, serverWriteKey); err != nil {
+		return nil, err
+	}
+
+	b, err := skipjack.New(tek)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher.NewCBCEncrypter(b, k.MasterSecretIV[16:]).CryptBlocks(k.EncryptedPreMasterSecret, preMaster)
+
+	return k, nil
+}
+
+// Open recovers the pre-master secret and the write keys with the TEK,
+// the key agreed by KEA between the client's static and ephemeral keys and
+// the server's static and ephemeral keys.
+func (k *FortezzaKeys) Open(tek []byte) (preMaster, clientWriteKey, serverWriteKey []byte, err error) {
+	if clientWriteKey, err = keywrap.Unwrap(tek, k.WrappedClientWriteKey); err != nil {
+		return nil, nil, nil, err
+	}
+	if serverWriteKey, err = keywrap.Unwrap(tek, k.WrappedServerWriteKey); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(k.MasterSecretIV) != FortezzaIVSize {
+		return nil, nil, nil, errIVSize
+	}
+	if len(k.EncryptedPreMasterSecret) != PreMasterSecretSize {
+		return nil, nil, nil, errMessage
+	}
+
+	// tek has been checked by Unwrap
+	b, _ := skipjack.New(tek)
+
+	preMaster = make([]byte, PreMasterSecretSize)
+	cipher.NewCBCDecrypter(b, k.MasterSecretIV[16:]).CryptBlocks(preMaster, k.EncryptedPreMasterSecret)
+
+	return preMaster, clientWriteKey, serverWriteKey, nil
+}
@@ -0,0 +1,98 @@
+package ssl3
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+)
+
+var (
+	pad1 = [48]byte{
+		0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36,
+		0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36,
+		0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36, 0x36,
+	}
+	pad2 = [48]byte{
+		0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c,
+		0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c,
+		0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c, 0x5c,
+	}
+)
+
+// SHA-1 uses 40 bytes of each pad, MD5 all 48
+const shaPadLen = 40
+
+var (
+	senderClient = []byte{0x43, 0x4c, 0x4e, 0x54}
+	senderServer = []byte{0x53, 0x52, 0x56, 0x52}
+)
+
+// prf is the SSL 3.0 key expansion:
+// MD5(secret + SHA('A' + secret + seed)) + MD5(secret + SHA('BB' + secret + seed)) + ...
+func prf(secret, seed []byte, n int) []byte {
+	out := make([]byte, 0, n+md5.Size)
+
+	for i := 0; len(out) < n; i++ {
+		label := make([]byte, i+1)
+		for j := range label {
+			label[j] = 'A' + byte(i)
+		}
+
+		s := sha1.New()
+		s.Write(label)
+		s.Write(secret)
+		s.Write(seed)
+
+		m := md5.New()
+		m.Write(secret)
+		m.Write(s.Sum(nil))
+		out = m.Sum(out)
+	}
+
+	return out[:n]
+}
+
+// MasterSecret returns the 48-byte master secret for the pre-master secret
+// and the client and server hello randoms.
+func MasterSecret(preMaster, clientRandom, serverRandom []byte) []byte {
+	seed := append(append([]byte(nil), clientRandom...), serverRandom...)
+	return prf(preMaster, seed, 48)
+}
+
+// MACSecrets returns the client and server write MAC secrets, the only part
+// of the key block FORTEZZA uses.
+func MACSecrets(master, clientRandom, serverRandom []byte) (client, server []byte) {
+	seed := append(append([]byte(nil), serverRandom...), clientRandom...)
+	kb := prf(master, seed, 2*sha1.Size)
+	return kb[:sha1.Size], kb[sha1.Size:]
+}
+
+// finishedHash returns the Finished message body for the handshake messages
+// so far.
+func finishedHash(master, transcript, sender []byte) []byte {
+	m := md5.New()
+	m.Write(transcript)
+	m.Write(sender)
+	m.Write(master)
+	m.Write(pad1[:])
+	inner := m.Sum(nil)
+
+	m.Reset()
+	m.Write(master)
+	m.Write(pad2[:])
+	m.Write(inner)
+	out := m.Sum(nil)
+
+	s := sha1.New()
+	s.Write(transcript)
+	s.Write(sender)
+	s.Write(master)
+	s.Write(pad1[:shaPadLen])
+	inner = s.Sum(nil)
+
+	s.Reset()
+	s.Write(master)
+	s.Write(pad2[:shaPadLen])
+	s.Write(inner)
+
+	return s.Sum(out)
+}
@@ -0,0 +1,146 @@
+package ssl3
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+
+	"github.com/Phraxos/go-skipjack"
+)
+
+// Record content types.
+const (
+	RecordTypeChangeCipherSpec uint8 = 20
+	RecordTypeAlert            uint8 = 21
+	RecordTypeHandshake        uint8 = 22
+	RecordTypeApplicationData  uint8 = 23
+)
+
+const (
+	recordHeaderLen = 5
+	maxPlaintext    = 1 << 14
+
+	// a ciphertext may expand the plaintext by at most 2048 bytes
+	maxCiphertext = maxPlaintext + 2048
+)
+
+var (
+	errBadRecordMAC = errors.New("ssl3: bad record MAC")
+	errIVSize       = errors.New("ssl3: invalid FORTEZZA IV length")
+)
+
+// CipherState protects one direction of a connection: SKIPJACK-CBC under
+// a write key, chained from record to record, and the SSL 3.0 SHA-1 MAC
+// under a write MAC secret.
+type CipherState struct {
+	mode      cipher.BlockMode
+	macSecret []byte
+	seq       uint64
+}
+
+func newCipherState(key, iv, macSecret []byte, encrypt bool) (*CipherState, error) {
+	if len(iv) != FortezzaIVSize {
+		return nil, errIVSize
+	}
+
+	b, err := skipjack.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &CipherState{macSecret: append([]byte(nil), macSecret...)}
+
+	if encrypt {
+		s.mode = cipher.NewCBCEncrypter(b, iv[16:])
+	} else {
+		s.mode = cipher.NewCBCDecrypter(b, iv[16:])
+	}
+
+	return s, nil
+}
+
+// NewSealer returns the CipherState for sending records under the 10-byte
+// write key, 24-byte FORTEZZA IV and write MAC secret.
+func NewSealer(key, iv, macSecret []byte) (*CipherState, error) {
+	return newCipherState(key, iv, macSecret, true)
+}
+
+// NewOpener returns the CipherState for receiving records under the 10-byte
+// write key, 24-byte FORTEZZA IV and write MAC secret.
+func NewOpener(key, iv, macSecret []byte) (*CipherState, error) {
+	return newCipherState(key, iv, macSecret, false)
+}
+
+// mac computes
+// SHA(secret + pad_2 + SHA(secret + pad_1 + seq_num + type + length + content))
+func (s *CipherState) mac(typ uint8, payload []byte) []byte {
+	var hdr [11]byte
+	binary.BigEndian.PutUint64(hdr[0:8], s.seq)
+	hdr[8] = typ
+	binary.BigEndian.PutUint16(hdr[9:11], uint16(len(payload)))
+
+	h := sha1.New()
+	h.Write(s.macSecret)
+	h.Write(pad1[:shaPadLen])
+	h.Write(hdr[:])
+	h.Write(payload)
+	inner := h.Sum(nil)
+
+	h.Reset()
+	h.Write(s.macSecret)
+	h.Write(pad2[:shaPadLen])
+	h.Write(inner)
+
+	return h.Sum(nil)
+}
+
+// Seal returns the protected fragment for a record of type typ.
+func (s *CipherState) Seal(typ uint8, payload []byte) []byte {
+	m := s.mac(typ, payload)
+	s.seq++
+
+	bs := s.mode.BlockSize()
+	n := len(payload) + len(m) + 1
+	padLen := (bs - n%bs) % bs
+
+	out := make([]byte, n+padLen)
+	copy(out, payload)
+	copy(out[len(payload):], m)
+	out[len(out)-1] = byte(padLen)
+
+	s.mode.CryptBlocks(out, out)
+
+	return out
+}
+
+// Open decrypts and checks the protected fragment of a record of type typ.
+func (s *CipherState) Open(typ uint8, fragment []byte) ([]byte, error) {
+	bs := s.mode.BlockSize()
+	if len(fragment) == 0 || len(fragment)%bs != 0 {
+		return nil, errBadRecordMAC
+	}
+
+	pt := make([]byte, len(fragment))
+	s.mode.CryptBlocks(pt, fragment)
+
+	// SSL 3.0 padding is shorter than a block and its contents are
+	// arbitrary
+	padLen := int(pt[len(pt)-1])
+	if padLen >= bs || len(pt) < padLen+1+sha1.Size {
+		return nil, errBadRecordMAC
+	}
+
+	end := len(pt) - padLen - 1 - sha1.Size
+	payload, m := pt[:end], pt[end:end+sha1.Size]
+
+	want := s.mac(typ, payload)
+	s.seq++
+
+	if !hmac.Equal(m, want) {
+		return nil, errBadRecordMAC
+	}
+
+	return payload, nil
+}
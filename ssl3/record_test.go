@@ -0,0 +1,159 @@
+package ssl3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"testing"
+)
+
+func TestPRF(t *testing.T) {
+
+	pre := bytes.Repeat([]byte{0x03}, 48)
+	cr := bytes.Repeat([]byte{0xc1}, 32)
+	sr := bytes.Repeat([]byte{0x5e}, 32)
+
+	master := MasterSecret(pre, cr, sr)
+
+	// the first 16 bytes are MD5(pre + SHA('A' + pre + client + server))
+	s := sha1.New()
+	s.Write([]byte("A"))
+	s.Write(pre)
+	s.Write(cr)
+	s.Write(sr)
+	m := md5.New()
+	m.Write(pre)
+	m.Write(s.Sum(nil))
+
+	if len(master) != 48 || !bytes.Equal(master[:16], m.Sum(nil)) {
+		t.Errorf("ssl3 master secret failed: got %x\n", master)
+	}
+
+	// the third uses 'CCC'
+	s.Reset()
+	s.Write([]byte("CCC"))
+	s.Write(pre)
+	s.Write(cr)
+	s.Write(sr)
+	m.Reset()
+	m.Write(pre)
+	m.Write(s.Sum(nil))
+
+	if !bytes.Equal(master[32:], m.Sum(nil)) {
+		t.Errorf("ssl3 master secret third block failed: got %x\n", master[32:])
+	}
+
+	cm, sm := MACSecrets(master, cr, sr)
+	kb := prf(master, append(append([]byte(nil), sr...), cr...), 40)
+	if !bytes.Equal(cm, kb[:20]) || !bytes.Equal(sm, kb[20:]) || bytes.Equal(cm, sm) {
+		t.Errorf("ssl3 mac secrets failed: %x %x\n", cm, sm)
+	}
+}
+
+func testStates(t *testing.T) (*CipherState, *CipherState) {
+	key := []byte{0x00, 0x99, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11}
+	iv := bytes.Repeat([]byte{0xa5}, FortezzaIVSize)
+	mac := bytes.Repeat([]byte{0x4d}, 20)
+
+	sealer, err := NewSealer(key, iv, mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opener, err := NewOpener(key, iv, mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sealer, opener
+}
+
+func TestCipherState(t *testing.T) {
+
+	sealer, opener := testStates(t)
+
+	for n := 0; n < 20; n++ {
+		msg := bytes.Repeat([]byte{byte(n)}, n)
+
+		ct := sealer.Seal(RecordTypeApplicationData, msg)
+		if len(ct)%8 != 0 || len(ct) < n+21 || len(ct) > n+28 {
+			t.Errorf("ssl3 seal of %d bytes gave %d bytes\n", n, len(ct))
+		}
+
+		if pt, err := opener.Open(RecordTypeApplicationData, ct); err != nil || !bytes.Equal(pt, msg) {
+			t.Errorf("ssl3 open failed for %d bytes: %v\n", n, err)
+		}
+	}
+
+	// the MAC covers the record type
+	sealer, opener = testStates(t)
+	ct := sealer.Seal(RecordTypeApplicationData, []byte("attack at dawn"))
+	if _, err := opener.Open(RecordTypeHandshake, ct); err != errBadRecordMAC {
+		t.Errorf("ssl3 opened a record with the wrong type: %v\n", err)
+	}
+
+	// and the sequence number, so records cannot be replayed
+	sealer, opener = testStates(t)
+	ct = sealer.Seal(RecordTypeApplicationData, []byte("attack at dawn"))
+	opener.Open(RecordTypeApplicationData, ct)
+
+	ct2 := sealer.Seal(RecordTypeApplicationData, []byte("attack at dawn"))
+	if bytes.Equal(ct, ct2) {
+		t.Errorf("ssl3 records are not chained\n")
+	}
+
+	if _, err := opener.Open(RecordTypeApplicationData, ct); err != errBadRecordMAC {
+		t.Errorf("ssl3 opened a replayed record: %v\n", err)
+	}
+
+	if _, err := NewSealer(make([]byte, 10), make([]byte, 8), nil); err == nil {
+		t.Errorf("ssl3 accepted an 8-byte FORTEZZA IV\n")
+	}
+}
+
+func TestFortezzaKeys(t *testing.T) {
+
+	tek := []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23}
+	pre := bytes.Repeat([]byte{0x03}, PreMasterSecretSize)
+	cw := []byte{0xc0, 0xc1, 0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9}
+	sw := []byte{0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59}
+
+	k, err := sealFortezzaKeys(bytes.NewReader(bytes.Repeat([]byte{0x77}, 72)), tek, pre, cw, sw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.RC = bytes.Repeat([]byte{0xee}, keaValueSize)
+
+	body := k.marshal()
+	if len(body) != 1+128+40+12+12+24+24+24+48 {
+		t.Errorf("ssl3 FortezzaKeys is %d bytes\n", len(body))
+	}
+
+	parsed, err := ParseFortezzaKeys(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, c, s, err := parsed.Open(tek)
+	if err != nil || !bytes.Equal(p, pre) || !bytes.Equal(c, cw) || !bytes.Equal(s, sw) {
+		t.Errorf("ssl3 FortezzaKeys round trip failed: %v\n", err)
+	}
+
+	if _, _, _, err := parsed.Open(cw); err == nil {
+		t.Errorf("ssl3 FortezzaKeys opened under the wrong TEK\n")
+	}
+
+	// with y_c
+	k.YC = bytes.Repeat([]byte{0x11}, keaValueSize)
+	if parsed, err := ParseFortezzaKeys(k.marshal()); err != nil || !bytes.Equal(parsed.YC, k.YC) {
+		t.Errorf("ssl3 FortezzaKeys with y_c failed: %v\n", err)
+	}
+
+	for _, n := range []int{0, 1, 100, len(body) - 1} {
+		if _, err := ParseFortezzaKeys(body[:n]); err == nil {
+			t.Errorf("ssl3 parsed FortezzaKeys truncated to %d bytes\n", n)
+		}
+	}
+	if _, err := ParseFortezzaKeys(append(body, 0)); err == nil {
+		t.Errorf("ssl3 parsed FortezzaKeys with trailing data\n")
+	}
+}
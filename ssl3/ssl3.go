@@ -0,0 +1,80 @@
+// Package ssl3 emulates the SSL 3.0 FORTEZZA_KEA_WITH_FORTEZZA_CBC_SHA
+// cipher suite: the KEA key exchange messages and SKIPJACK-CBC record
+// protection with the SSL 3.0 SHA-1 MAC.
+/*
+
+   References:
+   RFC 6101, "The Secure Sockets Layer (SSL) Protocol Version 3.0"
+   http://tools.ietf.org/html/rfc6101
+
+   The server sends its ephemeral KEA public key r_s in ServerKeyExchange.
+   The client answers with FortezzaKeys in ClientKeyExchange: its ephemeral
+   key r_c, the client and server write keys wrapped under the KEA token
+   encryption key (TEK), the write IVs, and the 48-byte pre-master secret
+   encrypted under the TEK in CBC mode.  The master secret and the MAC
+   secrets are derived from the pre-master secret as for the other suites,
+   but the write keys and IVs come from FortezzaKeys rather than the key
+   block.
+
+   The card's wrap80 algorithm for the write keys is not public, so they
+   are wrapped with the module's own 12-byte wrap.  The emulation talks to
+   itself, but cannot open FortezzaKeys from real clients or captured
+   sessions.
+
+   FORTEZZA IVs are 24 bytes.  Only the last 8 bytes are the SKIPJACK IV;
+   the first 16 carry card data, and are random here and ignored on
+   receipt.
+
+   The emulation does not send or check certificates: each end is given
+   the other's static KEA key in its Config, and y_signature is zero.  Only
+   the one cipher suite and null compression are offered or accepted, and
+   sessions are not resumed.
+
+*/
+package ssl3
+
+import (
+	"crypto/rand"
+	"io"
+
+	"github.com/Phraxos/go-skipjack/kea"
+)
+
+// VersionSSL30 is the protocol version.
+const VersionSSL30 = 0x0300
+
+// Cipher suites from the SSL 3.0 specification.  Only
+// FORTEZZA_KEA_WITH_FORTEZZA_CBC_SHA is implemented.
+const (
+	FORTEZZA_KEA_WITH_NULL_SHA         uint16 = 0x001c
+	FORTEZZA_KEA_WITH_FORTEZZA_CBC_SHA uint16 = 0x001d
+	FORTEZZA_KEA_WITH_RC4_128_SHA      uint16 = 0x001e
+)
+
+// FortezzaIVSize is the length of a FORTEZZA IV.
+const FortezzaIVSize = 24
+
+// PreMasterSecretSize is the length of the pre-master secret.
+const PreMasterSecretSize = 48
+
+// Config configures a client or server.
+type Config struct {
+	// Key is this end's static KEA key pair.
+	Key *kea.PrivateKey
+
+	// PeerKey is the other end's static KEA public key, normally taken
+	// from its certificate.  A server may leave it nil if clients send
+	// their key in ClientKeyExchange.
+	PeerKey *kea.PublicKey
+
+	// Rand is the source of ephemeral keys, randoms and IVs.  If nil,
+	// crypto/rand is used.
+	Rand io.Reader
+}
+
+func (c *Config) rand() io.Reader {
+	if c.Rand == nil {
+		return rand.Reader
+	}
+	return c.Rand
+}
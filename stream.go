@@ -0,0 +1,314 @@
+package skipjack
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+/*
+
+   Streaming encryption follows the STREAM construction from:
+   Hoang, Reyhanitabar, Rogaway, Vizár: "Online Authenticated-Encryption and
+   its Nonce-Reuse Misuse-Resistance"
+   https://eprint.iacr.org/2015/189.pdf
+
+   The stream starts with a random 7-byte nonce prefix.  The plaintext is
+   split into fixed-size segments, each sealed with SKIPJACK-EAX under the
+   nonce prefix || 32-bit big-endian segment counter || last-segment flag.
+   Dropping, reordering or truncating segments makes decryption fail.
+
+   SKIPJACK has a 64-bit block, so a single key should not be used to encrypt
+   more than a few gigabytes in total.
+
+*/
+
+// DefaultSegmentSize is the plaintext segment size used by the stream
+// encryption functions unless overridden with WithSegmentSize.
+const DefaultSegmentSize = 64 * 1024
+
+const (
+	streamPrefixSize = 7
+	streamNonceSize  = streamPrefixSize + 4 + 1
+)
+
+var errStreamClosed = errors.New("skipjack: write to closed stream")
+var errStreamTooLong = errors.New("skipjack: stream segment counter overflow")
+
+type streamConfig struct {
+	ctx         context.Context
+	segmentSize int
+	rand        io.Reader
+	ad          []byte
+}
+
+// A StreamOption configures NewEncryptWriter and NewDecryptReader.  Both
+// sides of a stream must agree on the segment size and associated data.
+type StreamOption func(*streamConfig)
+
+// WithContext makes the stream check ctx before processing each segment.
+func WithContext(ctx context.Context) StreamOption {
+	return func(c *streamConfig) { c.ctx = ctx }
+}
+
+// WithSegmentSize sets the plaintext segment size.
+func WithSegmentSize(n int) StreamOption {
+	return func(c *streamConfig) { c.segmentSize = n }
+}
+
+// WithRand sets the source of randomness for the nonce prefix.
+func WithRand(r io.Reader) StreamOption {
+	return func(c *streamConfig) { c.rand = r }
+}
+
+// WithAssociatedData authenticates ad along with every segment.
+func WithAssociatedData(ad []byte) StreamOption {
+	return func(c *streamConfig) { c.ad = ad }
+}
+
+func newStream(key []byte, opts []StreamOption) (cipher.AEAD, *streamConfig, error) {
+	c := &streamConfig{
+		ctx:         context.Background(),
+		segmentSize: DefaultSegmentSize,
+		rand:        rand.Reader,
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	if c.segmentSize <= 0 {
+		return nil, nil, errors.New("skipjack: invalid stream segment size")
+	}
+
+	b, err := New(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := NewEAXWithNonceSize(b, streamNonceSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return aead, c, nil
+}
+
+func streamNonce(nonce, prefix []byte, counter uint32, last bool) {
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixSize:], counter)
+	if last {
+		nonce[streamNonceSize-1] = 1
+	} else {
+		nonce[streamNonceSize-1] = 0
+	}
+}
+
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	cfg     *streamConfig
+	prefix  []byte
+	nonce   []byte
+	counter uint32
+	buf     []byte
+	ct      []byte
+	err     error
+}
+
+// NewEncryptWriter returns a WriteCloser that encrypts everything written to
+// it under key and writes the ciphertext to w.  Close must be called to seal
+// the final segment; it does not close w.
+func NewEncryptWriter(w io.Writer, key []byte, opts ...StreamOption) (io.WriteCloser, error) {
+	aead, cfg, err := newStream(key, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, streamPrefixSize)
+	if _, err := io.ReadFull(cfg.rand, prefix); err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		cfg:    cfg,
+		prefix: prefix,
+		nonce:  make([]byte, streamNonceSize),
+		buf:    make([]byte, 0, cfg.segmentSize),
+		ct:     make([]byte, 0, cfg.segmentSize+aead.Overhead()),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	var n int
+
+	for len(p) > 0 {
+		if e.err != nil {
+			return n, e.err
+		}
+
+		// only seal a full buffer once we know more data follows, so the
+		// final segment is never sealed as an intermediate one
+		if len(e.buf) == cap(e.buf) {
+			e.err = e.seal(false)
+			continue
+		}
+
+		c := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+
+	return n, nil
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	if err := e.cfg.ctx.Err(); err != nil {
+		return err
+	}
+
+	streamNonce(e.nonce, e.prefix, e.counter, last)
+	e.ct = e.aead.Seal(e.ct[:0], e.nonce, e.buf, e.cfg.ad)
+
+	if _, err := e.w.Write(e.ct); err != nil {
+		return err
+	}
+
+	e.buf = e.buf[:0]
+
+	if e.counter++; e.counter == 0 && !last {
+		return errStreamTooLong
+	}
+
+	return nil
+}
+
+// Close seals and writes the final segment.
+func (e *encryptWriter) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	if e.err = e.seal(true); e.err == nil {
+		e.err = errStreamClosed
+		return nil
+	}
+
+	return e.err
+}
+
+type decryptReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	cfg     *streamConfig
+	prefix  []byte
+	nonce   []byte
+	counter uint32
+	in      []byte
+	pending int
+	plain   []byte
+	out     []byte
+	done    bool
+	err     error
+}
+
+// NewDecryptReader returns a Reader that decrypts and authenticates a stream
+// produced by NewEncryptWriter.  Data is only returned once the segment
+// holding it has been verified; a truncated stream yields an error rather
+// than io.EOF.
+func NewDecryptReader(r io.Reader, key []byte, opts ...StreamOption) (io.Reader, error) {
+	aead, cfg, err := newStream(key, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, streamPrefixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return &decryptReader{
+		r:      r,
+		aead:   aead,
+		cfg:    cfg,
+		prefix: prefix,
+		nonce:  make([]byte, streamNonceSize),
+		// one byte of look-ahead tells us whether a segment is the last
+		in:    make([]byte, cfg.segmentSize+aead.Overhead()+1),
+		plain: make([]byte, 0, cfg.segmentSize),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	if err := d.cfg.ctx.Err(); err != nil {
+		return err
+	}
+
+	n, err := io.ReadFull(d.r, d.in[d.pending:])
+	total := d.pending + n
+
+	last := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+
+	seg := total
+	if !last {
+		seg--
+	}
+
+	streamNonce(d.nonce, d.prefix, d.counter, last)
+
+	pt, err := d.aead.Open(d.plain[:0], d.nonce, d.in[:seg], d.cfg.ad)
+	if err != nil {
+		return err
+	}
+
+	if !last {
+		d.in[0] = d.in[total-1]
+		d.pending = 1
+
+		if d.counter++; d.counter == 0 {
+			return errStreamTooLong
+		}
+	}
+
+	d.out = pt
+	d.done = last
+
+	return nil
+}
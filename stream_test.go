@@ -0,0 +1,129 @@
+package skipjack
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+var streamKey = []byte{0x00, 0x99, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11}
+
+func encryptStream(t *testing.T, msg []byte, opts ...StreamOption) []byte {
+	var buf bytes.Buffer
+
+	w, err := NewEncryptWriter(&buf, streamKey, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// write in odd-sized pieces to exercise the buffering
+	for p := msg; len(p) > 0; {
+		n := 7
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func decryptStream(c []byte, opts ...StreamOption) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(c), streamKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+
+	const seg = 16
+
+	for _, n := range []int{0, 1, seg - 1, seg, seg + 1, 2 * seg, 5*seg + 3} {
+		msg := make([]byte, n)
+		for i := range msg {
+			msg[i] = byte(i)
+		}
+
+		c := encryptStream(t, msg, WithSegmentSize(seg))
+
+		p, err := decryptStream(c, WithSegmentSize(seg))
+		if err != nil || !bytes.Equal(p, msg) {
+			t.Errorf("stream round trip failed for length %d: %v\n", n, err)
+		}
+	}
+}
+
+func TestStreamTamper(t *testing.T) {
+
+	const seg = 16
+
+	msg := bytes.Repeat([]byte("skipjack"), 8)
+	c := encryptStream(t, msg, WithSegmentSize(seg), WithAssociatedData([]byte("ad")))
+
+	full := seg + 8
+	hdr := streamPrefixSize
+
+	// drop the whole final segment, leaving a stream that ends on a segment
+	// boundary
+	last := (len(c) - hdr) % full
+	if last == 0 {
+		last = full
+	}
+	if _, err := decryptStream(c[:len(c)-last], WithSegmentSize(seg), WithAssociatedData([]byte("ad"))); err == nil {
+		t.Errorf("stream accepted a stream without its final segment\n")
+	}
+
+	// drop the tag of the final segment
+	if _, err := decryptStream(c[:len(c)-8], WithSegmentSize(seg), WithAssociatedData([]byte("ad"))); err == nil {
+		t.Errorf("stream accepted a truncated final tag\n")
+	}
+
+	// swap the first two segments
+	swapped := append([]byte{}, c...)
+	copy(swapped[hdr:], c[hdr+full:hdr+2*full])
+	copy(swapped[hdr+full:], c[hdr:hdr+full])
+	if _, err := decryptStream(swapped, WithSegmentSize(seg), WithAssociatedData([]byte("ad"))); err == nil {
+		t.Errorf("stream accepted reordered segments\n")
+	}
+
+	flipped := append([]byte{}, c...)
+	flipped[hdr+3] ^= 0x40
+	if _, err := decryptStream(flipped, WithSegmentSize(seg), WithAssociatedData([]byte("ad"))); err == nil {
+		t.Errorf("stream accepted a modified segment\n")
+	}
+
+	if _, err := decryptStream(c, WithSegmentSize(seg)); err == nil {
+		t.Errorf("stream accepted missing associated data\n")
+	}
+
+	if _, err := decryptStream(c[:hdr-1], WithSegmentSize(seg)); err == nil {
+		t.Errorf("stream accepted a short header\n")
+	}
+}
+
+func TestStreamContext(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	w, _ := NewEncryptWriter(&buf, streamKey, WithContext(ctx))
+	if err := w.Close(); err != context.Canceled {
+		t.Errorf("stream writer ignored cancellation: got %v\n", err)
+	}
+
+	c := encryptStream(t, []byte("attack at dawn"))
+	if _, err := decryptStream(c, WithContext(ctx)); err != context.Canceled {
+		t.Errorf("stream reader ignored cancellation: got %v\n", err)
+	}
+}
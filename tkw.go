@@ -0,0 +1,211 @@
+package skipjack
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+
+   Key wrapping with a 64-bit block cipher, from:
+   NIST SP 800-38F, "Recommendation for Block Cipher Modes of Operation:
+   Methods for Key Wrapping"
+   http://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-38F.pdf
+
+   TKW is specified there for TDEA; the algorithm depends only on the block
+   size, so it carries over to SKIPJACK unchanged.  SP 800-38F has no padded
+   variant for 64-bit blocks.  TKWP is KWP scaled down to 32-bit semiblocks:
+   the 32-bit KWP ICV and the 32-bit message length each take a semiblock,
+   and the plaintext is zero padded to a multiple of 4 bytes.
+
+*/
+
+const semiblock = 4
+
+// maximum number of semiblocks in a TKW plaintext, so that the step
+// counter 6n fits in 32 bits
+const tkwMaxSemiblocks = 1<<28 - 1
+
+// maximum length of a TKWP plaintext: with the length semiblock it may
+// take up no more than tkwMaxSemiblocks
+const tkwpMaxSize = semiblock * (tkwMaxSemiblocks - 1)
+
+var (
+	tkwICV  = []byte{0xa6, 0xa6, 0xa6, 0xa6}
+	tkwpICV = []byte{0xa6, 0x59, 0x59, 0xa6}
+)
+
+var errUnwrap = errors.New("skipjack: key unwrap integrity check failed")
+
+// WrapTKW wraps plaintext under the 10-byte kek with SP 800-38F TKW.  The
+// plaintext must be a multiple of 4 bytes and at least 8 bytes long.
+func WrapTKW(kek, plaintext []byte) ([]byte, error) {
+	if len(plaintext)%semiblock != 0 || len(plaintext) < 2*semiblock || len(plaintext)/semiblock > tkwMaxSemiblocks {
+		return nil, errors.New("skipjack: invalid TKW plaintext length")
+	}
+
+	b, err := New(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	s := make([]byte, semiblock+len(plaintext))
+	copy(s, tkwICV)
+	copy(s[semiblock:], plaintext)
+
+	tkwW(b, s)
+
+	return s, nil
+}
+
+// UnwrapTKW reverses WrapTKW, returning an error if the integrity check fails.
+func UnwrapTKW(kek, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext)%semiblock != 0 || len(ciphertext) < 3*semiblock || len(ciphertext)/semiblock > tkwMaxSemiblocks+1 {
+		return nil, errors.New("skipjack: invalid TKW ciphertext length")
+	}
+
+	b, err := New(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	s := make([]byte, len(ciphertext))
+	copy(s, ciphertext)
+
+	tkwWinv(b, s)
+
+	if subtle.ConstantTimeCompare(s[:semiblock], tkwICV) != 1 {
+		return nil, errUnwrap
+	}
+
+	return s[semiblock:], nil
+}
+
+// tkwpPlaintextLen reports whether n is a valid TKWP plaintext length
+func tkwpPlaintextLen(n int) bool {
+	return n > 0 && n <= tkwpMaxSize
+}
+
+// tkwpCiphertextLen reports whether n is a valid TKWP ciphertext length
+func tkwpCiphertextLen(n int) bool {
+	return n%semiblock == 0 && n >= 3*semiblock && n/semiblock <= tkwMaxSemiblocks+1
+}
+
+// WrapTKWP wraps plaintext of any non-zero length up to 1 GiB less 8 bytes
+// under the 10-byte kek.
+func WrapTKWP(kek, plaintext []byte) ([]byte, error) {
+	if !tkwpPlaintextLen(len(plaintext)) {
+		return nil, errors.New("skipjack: invalid TKWP plaintext length")
+	}
+
+	b, err := New(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	padded := (len(plaintext) + semiblock - 1) / semiblock * semiblock
+
+	s := make([]byte, 2*semiblock+padded)
+	copy(s, tkwpICV)
+	binary.BigEndian.PutUint32(s[semiblock:], uint32(len(plaintext)))
+	copy(s[2*semiblock:], plaintext)
+
+	tkwW(b, s)
+
+	return s, nil
+}
+
+// UnwrapTKWP reverses WrapTKWP, returning an error if the integrity check
+// fails.
+func UnwrapTKWP(kek, ciphertext []byte) ([]byte, error) {
+	if !tkwpCiphertextLen(len(ciphertext)) {
+		return nil, errors.New("skipjack: invalid TKWP ciphertext length")
+	}
+
+	b, err := New(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	s := make([]byte, len(ciphertext))
+	copy(s, ciphertext)
+
+	tkwWinv(b, s)
+
+	padded := len(s) - 2*semiblock
+	mli := int(binary.BigEndian.Uint32(s[semiblock:]))
+
+	if subtle.ConstantTimeCompare(s[:semiblock], tkwpICV) != 1 || mli <= padded-semiblock || mli > padded {
+		return nil, errUnwrap
+	}
+
+	var pad byte
+	for _, v := range s[2*semiblock+mli:] {
+		pad |= v
+	}
+
+	if pad != 0 {
+		return nil, errUnwrap
+	}
+
+	return s[2*semiblock : 2*semiblock+mli], nil
+}
+
+// tkwW is the wrapping function W from SP 800-38F.  Semiblocks are half the
+// cipher's block size, so this is TKW for SKIPJACK and KW for a 128-bit
+// cipher.  s is overwritten with the result.
+func tkwW(b cipher.Block, s []byte) {
+	h := b.BlockSize() / 2
+	n := len(s)/h - 1
+
+	buf := make([]byte, 2*h)
+	copy(buf[:h], s)
+
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			r := s[i*h : (i+1)*h]
+
+			copy(buf[h:], r)
+			b.Encrypt(buf, buf)
+
+			xorCounter(buf[:h], uint32(n*j+i))
+
+			copy(r, buf[h:])
+		}
+	}
+
+	copy(s, buf[:h])
+}
+
+// tkwWinv is the unwrapping function W^-1 from SP 800-38F.  s is overwritten
+// with the result.
+func tkwWinv(b cipher.Block, s []byte) {
+	h := b.BlockSize() / 2
+	n := len(s)/h - 1
+
+	buf := make([]byte, 2*h)
+	copy(buf[:h], s)
+
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			r := s[i*h : (i+1)*h]
+
+			xorCounter(buf[:h], uint32(n*j+i))
+
+			copy(buf[h:], r)
+			b.Decrypt(buf, buf)
+
+			copy(r, buf[h:])
+		}
+	}
+
+	copy(s, buf[:h])
+}
+
+// xorCounter xors the step counter t into the big-endian semiblock a
+func xorCounter(a []byte, t uint32) {
+	tail := a[len(a)-4:]
+	binary.BigEndian.PutUint32(tail, binary.BigEndian.Uint32(tail)^t)
+}
@@ -0,0 +1,116 @@
+package skipjack
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+// http://tools.ietf.org/html/rfc3394#section-4.1
+// W only depends on the block size, so check it against the AES KW vector.
+func TestTKWAgainstKW(t *testing.T) {
+
+	b, _ := aes.NewCipher(unhex("000102030405060708090A0B0C0D0E0F"))
+
+	s := unhex("A6A6A6A6A6A6A6A600112233445566778899AABBCCDDEEFF")
+	want := unhex("1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5")
+
+	tkwW(b, s)
+	if !bytes.Equal(s, want) {
+		t.Errorf("kw wrap failed: got %X wanted %X\n", s, want)
+	}
+
+	tkwWinv(b, s)
+	if !bytes.Equal(s[8:], unhex("00112233445566778899AABBCCDDEEFF")) {
+		t.Errorf("kw unwrap failed: got %X\n", s)
+	}
+}
+
+func TestTKW(t *testing.T) {
+
+	kek := skipjackTestVectors[0].key
+
+	for n := 8; n <= 40; n += 4 {
+		p := bytes.Repeat([]byte{0x5a}, n)
+
+		c, err := WrapTKW(kek, p)
+		if err != nil || len(c) != n+4 {
+			t.Fatalf("tkw wrap failed for length %d: %v\n", n, err)
+		}
+
+		u, err := UnwrapTKW(kek, c)
+		if err != nil || !bytes.Equal(u, p) {
+			t.Errorf("tkw unwrap failed for length %d: %v\n", n, err)
+		}
+
+		c[0] ^= 1
+		if _, err := UnwrapTKW(kek, c); err == nil {
+			t.Errorf("tkw unwrap accepted modified ciphertext for length %d\n", n)
+		}
+	}
+
+	for _, n := range []int{0, 4, 9} {
+		if _, err := WrapTKW(kek, make([]byte, n)); err == nil {
+			t.Errorf("tkw wrap accepted plaintext of length %d\n", n)
+		}
+	}
+}
+
+func TestTKWP(t *testing.T) {
+
+	kek := skipjackTestVectors[0].key
+
+	for n := 1; n <= 33; n++ {
+		p := make([]byte, n)
+		for i := range p {
+			p[i] = byte(i + 1)
+		}
+
+		c, err := WrapTKWP(kek, p)
+		if err != nil {
+			t.Fatalf("tkwp wrap failed for length %d: %v\n", n, err)
+		}
+
+		if want := 8 + (n+3)/4*4; len(c) != want {
+			t.Errorf("tkwp wrap length for %d: got %d wanted %d\n", n, len(c), want)
+		}
+
+		u, err := UnwrapTKWP(kek, c)
+		if err != nil || !bytes.Equal(u, p) {
+			t.Errorf("tkwp unwrap failed for length %d: %v\n", n, err)
+		}
+
+		c[len(c)-1] ^= 1
+		if _, err := UnwrapTKWP(kek, c); err == nil {
+			t.Errorf("tkwp unwrap accepted modified ciphertext for length %d\n", n)
+		}
+	}
+
+	// a TKW ciphertext must not unwrap as TKWP
+	c, _ := WrapTKW(kek, make([]byte, 16))
+	if _, err := UnwrapTKWP(kek, c); err == nil {
+		t.Errorf("tkwp unwrap accepted a tkw ciphertext\n")
+	}
+
+	if _, err := WrapTKWP(kek, nil); err == nil {
+		t.Errorf("tkwp wrap accepted an empty plaintext\n")
+	}
+
+	// the longest plaintext has n = max/4 + 1 semiblocks after the ICV, and
+	// its step counter 6n must not wrap
+	if !tkwpPlaintextLen(tkwpMaxSize) || tkwpPlaintextLen(tkwpMaxSize+1) {
+		t.Errorf("tkwp plaintext length limit is not %d\n", tkwpMaxSize)
+	}
+	if n := uint64(tkwpMaxSize/semiblock + 1); 6*n > 1<<32-1 {
+		t.Errorf("tkwp length limit allows %d semiblocks\n", n)
+	}
+
+	longest := 2*semiblock + tkwpMaxSize
+	if !tkwpCiphertextLen(longest) || tkwpCiphertextLen(longest+semiblock) {
+		t.Errorf("tkwp ciphertext length limit is not %d\n", longest)
+	}
+
+	if _, err := WrapTKWP(make([]byte, 16), []byte{1}); err == nil {
+		t.Errorf("tkwp wrap accepted a 16-byte kek\n")
+	}
+}
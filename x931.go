@@ -0,0 +1,135 @@
+package skipjack
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+
+   Deterministic random bit generation, from:
+   ANSI X9.31-1998, Appendix A.2.4, "Generating Pseudo Random Numbers
+   Using the DEA"
+   ANSI X9.17-1985, Appendix C
+   NIST, "Recommended Random Number Generator Based on ANSI X9.31
+   Appendix A.2.4 Using the 3-Key Triple DES and AES Algorithms", 2005
+   http://csrc.nist.gov/groups/STM/cavp/documents/rng/931rngext.pdf
+
+   With K the key, V the seed and DT a date/time vector that changes
+   for every block, each 8-byte output block R is
+
+      I = E_K(DT)
+      R = E_K(I ^ V)
+      V = E_K(R ^ I)
+
+   The standards use two-key triple DES (EDE); here E is SKIPJACK.  DT is
+   normally the time in nanoseconds, made strictly increasing; a fixed
+   sequence can be supplied to reproduce old output.
+
+   As in FIPS 140-2, each block is compared with the one before and the
+   generator fails if they are equal.
+
+*/
+
+// X931 is an ANSI X9.31 random number generator.  It is safe for
+// concurrent use.
+type X931 struct {
+	// DateTime returns DT for each block.  If nil, the current time in
+	// nanoseconds is used, increased where needed so that it never
+	// repeats.
+	DateTime func() uint64
+
+	mu   sync.Mutex
+	b    cipher.Block
+	v    [8]byte
+	last uint64
+	prev []byte
+	buf  []byte
+	err  error
+}
+
+// ErrX931Repeat is returned once two successive blocks are equal.
+var ErrX931Repeat = errors.New("skipjack: X9.31 generator repeated a block")
+
+// NewX931 returns a generator with the 10-byte key and 8-byte seed, which
+// must not equal the first 8 bytes of the key.
+func NewX931(key, seed []byte) (*X931, error) {
+	b, err := New(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != 8 {
+		return nil, errors.New("skipjack: X9.31 seed must be 8 bytes")
+	}
+	if subtle.ConstantTimeCompare(seed, key[:8]) == 1 {
+		return nil, errors.New("skipjack: X9.31 seed equals the key")
+	}
+
+	x := &X931{b: b}
+	copy(x.v[:], seed)
+
+	return x, nil
+}
+
+func (x *X931) dateTime() uint64 {
+	if x.DateTime != nil {
+		return x.DateTime()
+	}
+
+	dt := uint64(time.Now().UnixNano())
+	if dt <= x.last {
+		dt = x.last + 1
+	}
+	x.last = dt
+
+	return dt
+}
+
+// block returns the next output block
+func (x *X931) block() []byte {
+	var i, r [8]byte
+
+	binary.BigEndian.PutUint64(i[:], x.dateTime())
+	x.b.Encrypt(i[:], i[:])
+
+	subtle.XORBytes(r[:], i[:], x.v[:])
+	x.b.Encrypt(r[:], r[:])
+
+	subtle.XORBytes(x.v[:], r[:], i[:])
+	x.b.Encrypt(x.v[:], x.v[:])
+
+	return r[:]
+}
+
+// Read fills p with random bytes.
+func (x *X931) Read(p []byte) (int, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if x.err != nil {
+			return n, x.err
+		}
+
+		if len(x.buf) == 0 {
+			r := x.block()
+			if x.prev != nil && subtle.ConstantTimeCompare(r, x.prev) == 1 {
+				x.err = ErrX931Repeat
+				continue
+			}
+			x.prev = r
+			x.buf = r
+		}
+
+		c := copy(p[n:], x.buf)
+		x.buf = x.buf[c:]
+		n += c
+	}
+
+	return n, nil
+}
@@ -0,0 +1,115 @@
+package skipjack
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// counter returns a DateTime starting at dt
+func counter(dt uint64) func() uint64 {
+	return func() uint64 {
+		dt++
+		return dt - 1
+	}
+}
+
+func TestX931(t *testing.T) {
+
+	key := unhex("00998877665544332211")
+	seed := unhex("0123456789abcdef")
+
+	x, err := NewX931(key, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.DateTime = counter(0x1122334455667788)
+
+	// odd read sizes cross block boundaries
+	var got []byte
+	for _, n := range []int{3, 8, 13, 0, 8} {
+		p := make([]byte, n)
+		if _, err := io.ReadFull(x, p); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p...)
+	}
+
+	// regression values, not a published vector
+	want := unhex("5df9b25ebc528f3e40cf6fbb037f0260" + "435ee0de6e4a5bc7146457ff3c96bf8a")
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("x931 failed: got %x wanted %x\n", got, want)
+	}
+
+	// the same key, seed and date/time give the same output
+	y, _ := NewX931(key, seed)
+	y.DateTime = counter(0)
+	p := make([]byte, 16)
+	y.Read(p)
+	q := make([]byte, 16)
+	z, _ := NewX931(key, seed)
+	z.DateTime = counter(0)
+	z.Read(q)
+	if !bytes.Equal(p, q) {
+		t.Errorf("x931 is not reproducible: %x %x\n", p, q)
+	}
+}
+
+func TestX931Time(t *testing.T) {
+
+	x, _ := NewX931(unhex("00998877665544332211"), unhex("0123456789abcdef"))
+
+	// the clock may not advance between blocks
+	prev := x.dateTime()
+	for i := 0; i < 1000; i++ {
+		dt := x.dateTime()
+		if dt <= prev {
+			t.Fatalf("x931 date/time did not increase: %d after %d\n", dt, prev)
+		}
+		prev = dt
+	}
+
+	p := make([]byte, 100)
+	if n, err := x.Read(p); n != 100 || err != nil {
+		t.Errorf("x931 read failed: %d (%v)\n", n, err)
+	}
+}
+
+func TestX931Repeat(t *testing.T) {
+
+	key, seed := unhex("00998877665544332211"), unhex("0123456789abcdef")
+
+	x, _ := NewX931(key, seed)
+	x.DateTime = counter(0)
+
+	// a twin generator knows the first block; pretend it came before
+	twin, _ := NewX931(key, seed)
+	twin.DateTime = counter(0)
+	p := make([]byte, 8)
+	twin.Read(p)
+
+	x.prev = p
+
+	if n, err := x.Read(make([]byte, 16)); n != 0 || err != ErrX931Repeat {
+		t.Errorf("x931 missed a repeated block: %d (%v)\n", n, err)
+	}
+	if _, err := x.Read(make([]byte, 1)); err != ErrX931Repeat {
+		t.Errorf("x931 recovered from a repeated block: %v\n", err)
+	}
+}
+
+func TestNewX931(t *testing.T) {
+
+	key := unhex("00998877665544332211")
+
+	if _, err := NewX931(key, key[:8]); err == nil {
+		t.Errorf("x931 accepted a seed equal to the key\n")
+	}
+	if _, err := NewX931(key, key[:7]); err == nil {
+		t.Errorf("x931 accepted a 7-byte seed\n")
+	}
+	if _, err := NewX931(key[:8], unhex("0123456789abcdef")); err == nil {
+		t.Errorf("x931 accepted an 8-byte key\n")
+	}
+}
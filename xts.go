@@ -0,0 +1,179 @@
+package skipjack
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+
+   XTS sector encryption, from:
+   IEEE Std 1619-2007, "Standard for Cryptographic Protection of Data on
+   Block-Oriented Storage Devices"
+   NIST SP 800-38E, "The XTS-AES Mode for Confidentiality on Storage Devices"
+   http://csrc.nist.gov/publications/nistpubs/800-38E/nist-sp-800-38E.pdf
+
+   This is XTS with SKIPJACK in place of AES and the field GF(2^64) in
+   place of GF(2^128).  The 20-byte key is the data key K1 followed by the
+   tweak key K2.  Block j of sector s is encrypted with the XEX tweakable
+   cipher as
+
+      T = E_K2(s) * alpha^j
+      C = E_K1(P ^ T) ^ T
+
+   where alpha is x in GF(2^64) modulo x^64 + x^4 + x^3 + x + 1, and the
+   sector number and T are little-endian as in the standard.  A sector
+   that is not a multiple of 8 bytes ends with ciphertext stealing.
+   EncryptBlock and DecryptBlock expose the XEX step for one block j, for
+   callers that update part of a sector in place; they cannot reach the
+   stolen tail of a partial sector.
+
+   A 64-bit block gives much less margin than AES: XTS loses its security
+   as the number of blocks under one key approaches 2^32, that is 32 GiB,
+   so large devices should be split between keys.
+
+*/
+
+// XTS encrypts sectors with SKIPJACK in XTS mode.
+type XTS struct {
+	k1, k2 cipher.Block
+}
+
+// NewXTS returns an XTS instance for the 20-byte key, the data key
+// followed by the tweak key, which must differ.
+func NewXTS(key []byte) (*XTS, error) {
+	if klen := len(key); klen != 20 {
+		return nil, KeySizeError(klen)
+	}
+	if subtle.ConstantTimeCompare(key[:10], key[10:]) == 1 {
+		return nil, errors.New("skipjack: XTS data and tweak keys are equal")
+	}
+
+	k1, _ := New(key[:10])
+	k2, _ := New(key[10:])
+
+	return &XTS{k1: k1, k2: k2}, nil
+}
+
+// mulAlpha multiplies the little-endian tweak t by alpha
+func mulAlpha(t *[8]byte) {
+	x := binary.LittleEndian.Uint64(t[:])
+	carry := x >> 63
+	x = x<<1 ^ 0x1b&-carry
+	binary.LittleEndian.PutUint64(t[:], x)
+}
+
+// xex encrypts or decrypts one block with the tweak t
+func (c *XTS) xex(dst, src []byte, t *[8]byte, decrypt bool) {
+	var b [8]byte
+	subtle.XORBytes(b[:], src, t[:])
+	if decrypt {
+		c.k1.Decrypt(b[:], b[:])
+	} else {
+		c.k1.Encrypt(b[:], b[:])
+	}
+	subtle.XORBytes(dst, b[:], t[:])
+}
+
+func (c *XTS) crypt(dst, src []byte, sector uint64, decrypt bool) {
+	if len(src) < 8 {
+		panic("skipjack: XTS sector shorter than one block")
+	}
+	if len(dst) < len(src) {
+		panic("skipjack: XTS output smaller than input")
+	}
+
+	var t [8]byte
+	c.tweak(&t, sector, 0)
+
+	// the last full block takes part in ciphertext stealing
+	full := len(src) / 8
+	r := len(src) % 8
+	if r != 0 {
+		full--
+	}
+
+	for i := 0; i < full; i++ {
+		c.xex(dst[8*i:8*i+8], src[8*i:8*i+8], &t, decrypt)
+		mulAlpha(&t)
+	}
+
+	if r == 0 {
+		return
+	}
+
+	// t is the tweak of the last full block; u that of the partial one
+	last := src[8*full:]
+	u := t
+	mulAlpha(&u)
+
+	first, second := &t, &u
+	if decrypt {
+		first, second = &u, &t
+	}
+
+	var cc [8]byte
+	c.xex(cc[:], last[:8], first, decrypt)
+
+	var pp [8]byte
+	copy(pp[:], last[8:])
+	copy(pp[r:], cc[r:])
+
+	copy(dst[8*full+8:], cc[:r])
+	c.xex(dst[8*full:8*full+8], pp[:], second, decrypt)
+}
+
+// Encrypt encrypts a sector of plaintext, at least 8 bytes long, into
+// ciphertext.  ciphertext and plaintext may overlap entirely or not at
+// all.
+func (c *XTS) Encrypt(ciphertext, plaintext []byte, sector uint64) {
+	c.crypt(ciphertext, plaintext, sector, false)
+}
+
+// Decrypt decrypts a sector of ciphertext into plaintext.
+func (c *XTS) Decrypt(plaintext, ciphertext []byte, sector uint64) {
+	c.crypt(plaintext, ciphertext, sector, true)
+}
+
+// tweak returns the tweak of block index of sector
+func (c *XTS) tweak(t *[8]byte, sector uint64, index int) {
+	if index < 0 {
+		panic("skipjack: negative XTS block index")
+	}
+
+	binary.LittleEndian.PutUint64(t[:], sector)
+	c.k2.Encrypt(t[:], t[:])
+	for i := 0; i < index; i++ {
+		mulAlpha(t)
+	}
+}
+
+// EncryptBlock encrypts the single 8-byte block at position index of a
+// sector, as Encrypt would for a sector of whole blocks, so that one block
+// can be rewritten without the rest of its sector.  The tweak takes index
+// multiplications to compute.  dst and src may overlap entirely or not at
+// all.
+func (c *XTS) EncryptBlock(dst, src []byte, sector uint64, index int) {
+	c.block(dst, src, sector, index, false)
+}
+
+// DecryptBlock decrypts the single 8-byte block at position index of a
+// sector.
+func (c *XTS) DecryptBlock(dst, src []byte, sector uint64, index int) {
+	c.block(dst, src, sector, index, true)
+}
+
+func (c *XTS) block(dst, src []byte, sector uint64, index int, decrypt bool) {
+	if len(src) < 8 {
+		panic("skipjack: XTS input not a full block")
+	}
+	if len(dst) < 8 {
+		panic("skipjack: XTS output not a full block")
+	}
+
+	var t [8]byte
+	c.tweak(&t, sector, index)
+	c.xex(dst[:8], src[:8], &t, decrypt)
+}
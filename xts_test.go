@@ -0,0 +1,154 @@
+package skipjack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+)
+
+func TestMulAlpha(t *testing.T) {
+
+	var tests = []struct {
+		in, want uint64
+	}{
+		{1, 2},
+		{0x4000000000000000, 0x8000000000000000},
+		{0x8000000000000000, 0x1b},
+		{0xffffffffffffffff, 0xffffffffffffffe5},
+	}
+
+	for _, tt := range tests {
+		var x [8]byte
+		binary.LittleEndian.PutUint64(x[:], tt.in)
+		mulAlpha(&x)
+		if got := binary.LittleEndian.Uint64(x[:]); got != tt.want {
+			t.Errorf("mulAlpha failed: got %016x wanted %016x\n", got, tt.want)
+		}
+	}
+}
+
+func TestXTS(t *testing.T) {
+
+	key := unhex("00998877665544332211" + "0123456789abcdef0123")
+
+	c, err := NewXTS(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// full blocks are XEX with T = E_K2(s) * alpha^j
+	k1, _ := New(key[:10])
+	k2, _ := New(key[10:])
+
+	pt := make([]byte, 64)
+	rand.Read(pt)
+
+	ct := make([]byte, len(pt))
+	c.Encrypt(ct, pt, 7)
+
+	var tw [8]byte
+	tw[0] = 7
+	k2.Encrypt(tw[:], tw[:])
+
+	for j := 0; j < len(pt)/8; j++ {
+		var b [8]byte
+		for i := range b {
+			b[i] = pt[8*j+i] ^ tw[i]
+		}
+		k1.Encrypt(b[:], b[:])
+		for i := range b {
+			b[i] ^= tw[i]
+		}
+		if !bytes.Equal(b[:], ct[8*j:8*j+8]) {
+			t.Errorf("xts block %d failed: got %x wanted %x\n", j, ct[8*j:8*j+8], b)
+		}
+		mulAlpha(&tw)
+	}
+
+	for _, n := range []int{8, 9, 15, 16, 17, 63, 512, 515} {
+		pt := make([]byte, n)
+		rand.Read(pt)
+
+		ct := make([]byte, n)
+		c.Encrypt(ct, pt, 1<<40)
+
+		got := make([]byte, n)
+		c.Decrypt(got, ct, 1<<40)
+		if !bytes.Equal(got, pt) {
+			t.Errorf("xts round trip failed for %d bytes: got %x wanted %x\n", n, got, pt)
+		}
+
+		// in place
+		buf := append([]byte(nil), pt...)
+		c.Encrypt(buf, buf, 1<<40)
+		if !bytes.Equal(buf, ct) {
+			t.Errorf("xts in place failed for %d bytes\n", n)
+		}
+		c.Decrypt(buf, buf, 1<<40)
+		if !bytes.Equal(buf, pt) {
+			t.Errorf("xts in place round trip failed for %d bytes\n", n)
+		}
+
+		// ciphertext stealing leaves the blocks before the last full one
+		// alone
+		if full := n/8 - 1; n%8 != 0 && full > 0 {
+			prefix := make([]byte, 8*full)
+			c.Encrypt(prefix, pt[:8*full], 1<<40)
+			if !bytes.Equal(prefix, ct[:8*full]) {
+				t.Errorf("xts stealing changed earlier blocks for %d bytes\n", n)
+			}
+		}
+
+		other := make([]byte, n)
+		c.Encrypt(other, pt, 1<<40+1)
+		if bytes.Equal(other, ct) {
+			t.Errorf("xts sectors encrypt alike\n")
+		}
+	}
+}
+
+func TestXTSBlock(t *testing.T) {
+
+	key := unhex("00998877665544332211" + "0123456789abcdef0123")
+	c, _ := NewXTS(key)
+
+	pt := make([]byte, 64)
+	rand.Read(pt)
+
+	ct := make([]byte, len(pt))
+	c.Encrypt(ct, pt, 99)
+
+	for j := 0; j < len(pt)/8; j++ {
+		b := make([]byte, 8)
+		c.EncryptBlock(b, pt[8*j:8*j+8], 99, j)
+		if !bytes.Equal(b, ct[8*j:8*j+8]) {
+			t.Errorf("xts encrypt block %d failed: got %x wanted %x\n", j, b, ct[8*j:8*j+8])
+		}
+
+		c.DecryptBlock(b, b, 99, j)
+		if !bytes.Equal(b, pt[8*j:8*j+8]) {
+			t.Errorf("xts decrypt block %d failed: got %x wanted %x\n", j, b, pt[8*j:8*j+8])
+		}
+	}
+
+	// rewriting one block leaves the rest of the sector decryptable
+	copy(pt[16:24], "replaced")
+	c.EncryptBlock(ct[16:24], pt[16:24], 99, 2)
+
+	got := make([]byte, len(ct))
+	c.Decrypt(got, ct, 99)
+	if !bytes.Equal(got, pt) {
+		t.Errorf("xts block update failed: got %x wanted %x\n", got, pt)
+	}
+}
+
+func TestXTSKeys(t *testing.T) {
+
+	if _, err := NewXTS(unhex("00998877665544332211")); err == nil {
+		t.Errorf("xts accepted a 10-byte key\n")
+	}
+	if _, err := NewXTS(unhex("0099887766554433221100998877665544332211")); err == nil {
+		t.Errorf("xts accepted equal data and tweak keys\n")
+	}
+}